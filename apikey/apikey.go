@@ -0,0 +1,103 @@
+// Package apikey authenticates API clients. Only the SHA-256 hashes of the
+// keys are configured, so the keys themselves are never stored.
+package apikey
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+var (
+	ErrMissingKey = errors.New("missing API key")
+	ErrInvalidKey = errors.New("invalid API key")
+)
+
+// Store maps the hashes of the keys to the names of their owners.
+type Store struct {
+	owners map[string]string
+}
+
+// New returns the store of the keys of cfg.APIKeys and cfg.APIKeysFile, or
+// nil when none is configured and authentication is disabled.
+func New(cfg config.Config) (*Store, error) {
+	entries := cfg.APIKeys
+	if cfg.APIKeysFile != "" {
+		fileEntries, err := readFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries[:len(entries):len(entries)], fileEntries...)
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	return NewStore(entries)
+}
+
+// NewStore parses entries of the form "name:sha256-hex-of-the-key".
+func NewStore(entries []string) (*Store, error) {
+	s := &Store{owners: make(map[string]string, len(entries))}
+	for _, entry := range entries {
+		name, hash, ok := strings.Cut(entry, ":")
+		name, hash = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(hash))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("api key entry %q is not name:hash", entry)
+		}
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("api key of %s is not a hex SHA-256 hash", name)
+		}
+
+		s.owners[hash] = name
+	}
+
+	return s, nil
+}
+
+// readFile reads one entry per line, skipping blank lines and # comments.
+func readFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+
+	return entries, scanner.Err()
+}
+
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate returns the name of the owner of key.
+func (s *Store) Authenticate(key string) (string, error) {
+	if key == "" {
+		return "", ErrMissingKey
+	}
+
+	name, ok := s.owners[HashKey(key)]
+	if !ok {
+		return "", ErrInvalidKey
+	}
+
+	return name, nil
+}
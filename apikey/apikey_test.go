@@ -0,0 +1,62 @@
+package apikey
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+func TestNew(t *testing.T) {
+	store, err := New(config.Config{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, store == nil)
+
+	keysFile := filepath.Join(t.TempDir(), "keys")
+	content := "# partner teams\n\nteam-b:" + HashKey("secret-b") + "\n"
+	if err := os.WriteFile(keysFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = New(config.Config{
+		APIKeys:     []string{"team-a:" + HashKey("secret-a")},
+		APIKeysFile: keysFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		wantName string
+		wantErr  error
+	}{
+		{name: "key from config", key: "secret-a", wantName: "team-a"},
+		{name: "key from file", key: "secret-b", wantName: "team-b"},
+		{name: "missing key", key: "", wantErr: ErrMissingKey},
+		{name: "unknown key", key: "secret-c", wantErr: ErrInvalidKey},
+		{name: "hash is not a key", key: HashKey("secret-a"), wantErr: ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := store.Authenticate(tt.key)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantName, name)
+		})
+	}
+}
+
+func TestNewStore_InvalidEntries(t *testing.T) {
+	for _, entry := range []string{
+		"team-a",
+		":" + HashKey("secret"),
+		"team-a:secret",
+		"team-a:" + HashKey("secret")[:10],
+	} {
+		_, err := NewStore([]string{entry})
+		assert.NotEqual(t, nil, err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package apperror defines the errors reported to API clients, each with a
+// stable machine-readable code and optionally the field and file at fault.
+package apperror
+
+import (
+	"errors"
+	"net/http"
+)
+
+type Code string
+
+const (
+	CodeInvalidRequest       Code = "INVALID_REQUEST"
+	CodeBodyTooLarge         Code = "BODY_TOO_LARGE"
+	CodeUnsupportedType      Code = "UNSUPPORTED_TYPE"
+	CodeReadFailed           Code = "READ_FAILED"
+	CodeDecodeFailed         Code = "DECODE_FAILED"
+	CodeDimensionTooLarge    Code = "DIMENSION_TOO_LARGE"
+	CodeArchiveLimitExceeded Code = "ARCHIVE_LIMIT_EXCEEDED"
+	CodeURLNotAllowed        Code = "URL_NOT_ALLOWED"
+	CodeUpstreamFailed       Code = "UPSTREAM_FAILED"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeConflict             Code = "CONFLICT"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodePreconditionFailed   Code = "PRECONDITION_FAILED"
+	CodeTimeout              Code = "TIMEOUT"
+	CodeCancelled            Code = "CANCELLED"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodeQuotaExceeded        Code = "QUOTA_EXCEEDED"
+	CodeServerBusy           Code = "SERVER_BUSY"
+	CodeEncodeFailed         Code = "ENCODE_FAILED"
+	CodeCodecUnavailable     Code = "CODEC_UNAVAILABLE"
+	CodeInternal             Code = "INTERNAL"
+)
+
+// StatusClientClosedRequest is reported for requests whose client went away
+// before the response was written.
+const StatusClientClosedRequest = 499
+
+var codeStatus = map[Code]int{
+	CodeInvalidRequest:       http.StatusBadRequest,
+	CodeBodyTooLarge:         http.StatusRequestEntityTooLarge,
+	CodeUnsupportedType:      http.StatusUnsupportedMediaType,
+	CodeReadFailed:           http.StatusBadRequest,
+	CodeDecodeFailed:         http.StatusUnprocessableEntity,
+	CodeDimensionTooLarge:    http.StatusUnprocessableEntity,
+	CodeArchiveLimitExceeded: http.StatusRequestEntityTooLarge,
+	CodeURLNotAllowed:        http.StatusBadRequest,
+	CodeUpstreamFailed:       http.StatusBadGateway,
+	CodeNotFound:             http.StatusNotFound,
+	CodeConflict:             http.StatusConflict,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodePreconditionFailed:   http.StatusPreconditionFailed,
+	CodeTimeout:              http.StatusGatewayTimeout,
+	CodeCancelled:            StatusClientClosedRequest,
+	CodeRateLimited:          http.StatusTooManyRequests,
+	CodeQuotaExceeded:        http.StatusTooManyRequests,
+	CodeServerBusy:           http.StatusServiceUnavailable,
+	CodeEncodeFailed:         http.StatusInternalServerError,
+	CodeCodecUnavailable:     http.StatusNotImplemented,
+	CodeInternal:             http.StatusInternalServerError,
+}
+
+// Status is the HTTP status code errors with code are reported with.
+func (c Code) Status() int {
+	if status, ok := codeStatus[c]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Error is an error reported to clients. Field names the request field at
+// fault and FileIndex and Filename the file, when known. An Error without a
+// Code only carries the field and file of Err, whose code is left to the
+// caller to decide.
+type Error struct {
+	Code      Code
+	Message   string
+	Field     string
+	FileIndex *int
+	Filename  string
+	Err       error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Message != "":
+		return e.Message
+	case e.Err != nil:
+		return e.Err.Error()
+	default:
+		return string(e.Code)
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) WithField(field string) *Error {
+	e.Field = field
+	return e
+}
+
+// WithFile returns err annotated with the file at index of field, keeping
+// the field and file already set on it. A negative index is omitted.
+func WithFile(err error, field string, index int, filename string) error {
+	if err == nil {
+		return nil
+	}
+
+	annotated := &Error{Err: err}
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		copied := *appErr
+		annotated = &copied
+	}
+
+	if annotated.Field == "" {
+		annotated.Field = field
+	}
+	if annotated.FileIndex == nil && index >= 0 {
+		annotated.FileIndex = &index
+	}
+	if annotated.Filename == "" {
+		annotated.Filename = filename
+	}
+
+	return annotated
+}
@@ -0,0 +1,57 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestWithFile(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	index := 2
+
+	var tests = []struct {
+		name string
+		err  error
+		want *Error
+	}{
+		{
+			name: "annotates an untyped error",
+			err:  fmt.Errorf("wrapped: %w", sentinel),
+			want: &Error{Field: "files[]", FileIndex: &index, Filename: "cat.jpg"},
+		},
+		{
+			name: "keeps the code and file of a typed error",
+			err:  &Error{Code: CodeDecodeFailed, Filename: "inner.jpg", Err: sentinel},
+			want: &Error{Code: CodeDecodeFailed, Field: "files[]", FileIndex: &index, Filename: "inner.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithFile(tt.err, "files[]", index, "cat.jpg")
+
+			var got *Error
+			if !errors.As(err, &got) {
+				t.Fatalf("WithFile() = %v, want an *Error", err)
+			}
+
+			assert.Equal(t, tt.want.Code, got.Code)
+			assert.Equal(t, tt.want.Field, got.Field)
+			assert.Equal(t, *tt.want.FileIndex, *got.FileIndex)
+			assert.Equal(t, tt.want.Filename, got.Filename)
+			assert.Equal(t, true, errors.Is(err, sentinel))
+		})
+	}
+
+	assert.Equal(t, nil, WithFile(nil, "files[]", 0, ""))
+}
+
+func TestCode_Status(t *testing.T) {
+	assert.Equal(t, http.StatusUnsupportedMediaType, CodeUnsupportedType.Status())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, CodeBodyTooLarge.Status())
+	assert.Equal(t, http.StatusInternalServerError, Code("UNKNOWN").Status())
+}
@@ -0,0 +1,222 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("archive must be a zip, tar or tar.gz file")
+	ErrTooManyEntries    = errors.New("archive has too many entries")
+	ErrTooLarge          = errors.New("archive uncompressed size exceeds the limit")
+	ErrCompressionRatio  = errors.New("archive compression ratio exceeds the limit")
+)
+
+// SkipError makes Walk record the entry it was returned for as skipped
+// instead of failing.
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return e.Reason
+}
+
+// Extractor reads archives with limits against decompression bombs: the
+// number of entries, their total uncompressed size and the ratio between
+// uncompressed and archive size.
+type Extractor struct {
+	maxEntries    int
+	maxTotalBytes int64
+	maxRatio      float64
+}
+
+func New(cfg config.Config) *Extractor {
+	return &Extractor{
+		maxEntries:    cfg.ArchiveMaxEntries,
+		maxTotalBytes: cfg.ArchiveMaxTotalBytes,
+		maxRatio:      cfg.ArchiveMaxRatio,
+	}
+}
+
+// Walk calls fn with the cleaned name and content of every regular file in
+// the zip, tar or gzipped tar archive r of the given size, in archive order.
+// Entries that are not regular files or whose path would escape the archive
+// root are not passed to fn but reported as skipped, as are those for which
+// fn returns a *SkipError.
+func (e *Extractor) Walk(r io.ReaderAt, size int64, fn func(name string, body io.Reader) error) ([]dto.SkippedFile, error) {
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	w := &walk{extractor: e, archiveSize: size, fn: fn}
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		err = w.zip(r, size)
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err == nil {
+			err = w.tar(gz)
+		}
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		err = w.tar(io.NewSectionReader(r, 0, size))
+	default:
+		err = ErrUnsupportedFormat
+	}
+
+	return w.skipped, err
+}
+
+type walk struct {
+	extractor   *Extractor
+	archiveSize int64
+	fn          func(name string, body io.Reader) error
+	entries     int
+	total       int64
+	skipped     []dto.SkippedFile
+}
+
+func (w *walk) zip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	for _, f := range zr.File {
+		if err := w.countEntry(); err != nil {
+			return err
+		}
+
+		// Declared sizes are checked up front so an obvious bomb is refused
+		// before inflating anything; the actual bytes are counted below.
+		if f.UncompressedSize64 > uint64(w.extractor.maxTotalBytes) {
+			return ErrTooLarge
+		}
+		if f.CompressedSize64 > 0 && float64(f.UncompressedSize64)/float64(f.CompressedSize64) > w.extractor.maxRatio {
+			return ErrCompressionRatio
+		}
+
+		if !f.Mode().IsRegular() {
+			w.skip(f.Name, f.Mode().IsDir(), "not a regular file")
+			continue
+		}
+
+		body, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		err = w.entry(f.Name, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walk) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+		}
+
+		if err := w.countEntry(); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			w.skip(hdr.Name, hdr.Typeflag == tar.TypeDir, "not a regular file")
+			continue
+		}
+
+		if err := w.entry(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *walk) countEntry() error {
+	w.entries++
+	if w.entries > w.extractor.maxEntries {
+		return ErrTooManyEntries
+	}
+
+	return nil
+}
+
+func (w *walk) skip(name string, isDir bool, reason string) {
+	if isDir {
+		return
+	}
+
+	w.skipped = append(w.skipped, dto.SkippedFile{Filename: name, Reason: reason})
+}
+
+func (w *walk) entry(name string, body io.Reader) error {
+	cleaned, ok := cleanName(name)
+	if !ok {
+		w.skip(name, false, "unsafe path")
+		return nil
+	}
+
+	err := w.fn(cleaned, &countingReader{walk: w, r: body})
+
+	var skipErr *SkipError
+	if errors.As(err, &skipErr) {
+		w.skip(cleaned, false, skipErr.Reason)
+		return nil
+	}
+
+	return err
+}
+
+// cleanName normalizes an entry name to a relative slash separated path and
+// reports whether it stays inside the archive root.
+func cleanName(name string) (string, bool) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+
+	return name, true
+}
+
+type countingReader struct {
+	walk *walk
+	r    io.Reader
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.walk.total += int64(n)
+
+	if c.walk.total > c.walk.extractor.maxTotalBytes {
+		return n, ErrTooLarge
+	}
+	if c.walk.archiveSize > 0 && float64(c.walk.total)/float64(c.walk.archiveSize) > c.walk.extractor.maxRatio {
+		return n, ErrCompressionRatio
+	}
+
+	return n, err
+}
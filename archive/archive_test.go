@@ -0,0 +1,187 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+type testEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+func createZip(t *testing.T, entries ...testEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		name := entry.name
+		if entry.dir {
+			name += "/"
+		}
+
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(w, entry.content)
+	}
+	zw.Close()
+
+	return buf.Bytes()
+}
+
+func createTar(t *testing.T, gzipped bool, entries ...testEntry) []byte {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.dir {
+			hdr = &tar.Header{Name: entry.name + "/", Mode: 0o755, Typeflag: tar.TypeDir}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(tw, entry.content)
+	}
+	tw.Close()
+	if gz != nil {
+		gz.Close()
+	}
+
+	return buf.Bytes()
+}
+
+func TestExtractor_Walk(t *testing.T) {
+	entries := []testEntry{
+		{name: "shoot", dir: true},
+		{name: "shoot/a.png", content: "image a"},
+		{name: "shoot/notes.txt", content: "skip me"},
+		{name: "../evil.png", content: "outside"},
+		{name: "b.png", content: "image b"},
+	}
+
+	cfg := config.Config{
+		ArchiveMaxEntries:    10,
+		ArchiveMaxTotalBytes: 1 << 20,
+		ArchiveMaxRatio:      100,
+	}
+
+	tests := []struct {
+		name        string
+		cfg         func(cfg config.Config) config.Config
+		archive     []byte
+		wantNames   []string
+		wantSkipped []dto.SkippedFile
+		wantErr     error
+	}{
+		{
+			name:      "zip",
+			archive:   createZip(t, entries...),
+			wantNames: []string{"shoot/a.png", "b.png"},
+			wantSkipped: []dto.SkippedFile{
+				{Filename: "shoot/notes.txt", Reason: "not a png"},
+				{Filename: "../evil.png", Reason: "unsafe path"},
+			},
+		},
+		{
+			name:      "tar",
+			archive:   createTar(t, false, entries...),
+			wantNames: []string{"shoot/a.png", "b.png"},
+			wantSkipped: []dto.SkippedFile{
+				{Filename: "shoot/notes.txt", Reason: "not a png"},
+				{Filename: "../evil.png", Reason: "unsafe path"},
+			},
+		},
+		{
+			name:      "tar.gz",
+			archive:   createTar(t, true, entries...),
+			wantNames: []string{"shoot/a.png", "b.png"},
+			wantSkipped: []dto.SkippedFile{
+				{Filename: "shoot/notes.txt", Reason: "not a png"},
+				{Filename: "../evil.png", Reason: "unsafe path"},
+			},
+		},
+		{
+			name:    "not an archive",
+			archive: []byte("plain text"),
+			wantErr: ErrUnsupportedFormat,
+		},
+		{
+			name: "too many entries",
+			cfg: func(cfg config.Config) config.Config {
+				cfg.ArchiveMaxEntries = 2
+				return cfg
+			},
+			archive: createZip(t, entries...),
+			wantErr: ErrTooManyEntries,
+		},
+		{
+			name: "too large",
+			cfg: func(cfg config.Config) config.Config {
+				cfg.ArchiveMaxTotalBytes = 10
+				return cfg
+			},
+			archive: createTar(t, true, entries...),
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "zip compression ratio",
+			archive: createZip(t, testEntry{name: "bomb.png", content: strings.Repeat("0", 1<<16)}),
+			wantErr: ErrCompressionRatio,
+		},
+		{
+			name:    "tar.gz compression ratio",
+			archive: createTar(t, true, testEntry{name: "bomb.png", content: strings.Repeat("0", 1<<16)}),
+			wantErr: ErrCompressionRatio,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCfg := cfg
+			if tt.cfg != nil {
+				testCfg = tt.cfg(cfg)
+			}
+
+			var names []string
+			skipped, err := New(testCfg).Walk(bytes.NewReader(tt.archive), int64(len(tt.archive)), func(name string, body io.Reader) error {
+				if !strings.HasSuffix(name, ".png") {
+					return &SkipError{Reason: "not a png"}
+				}
+
+				_, err := io.ReadAll(body)
+				names = append(names, name)
+				return err
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Extractor.Walk() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, tt.wantNames, names)
+			assert.Equal(t, tt.wantSkipped, skipped)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Package buildinfo describes the running binary.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is set at build time with
+// -ldflags "-X github.com/rizqo46/image-processing-go/buildinfo.Version=v1.2.3".
+var Version = "dev"
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Read returns the version of the binary, with the commit it was built from
+// when the go toolchain recorded it.
+func Read() Info {
+	info := Info{Version: Version, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	return info
+}
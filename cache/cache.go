@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// Entry is a fully rendered response body kept for replay.
+type Entry struct {
+	ContentType string
+	Body        []byte
+}
+
+func (e Entry) size() int64 {
+	return int64(len(e.ContentType) + len(e.Body))
+}
+
+type Cache interface {
+	Get(key string) (Entry, bool)
+	Set(key string, entry Entry)
+}
+
+// New builds the cache backend selected by cfg. Unknown backends and a
+// non-positive size limit disable caching.
+func New(cfg config.Config) (Cache, error) {
+	if cfg.CacheMaxBytes <= 0 {
+		return noopCache{}, nil
+	}
+
+	switch cfg.CacheBackend {
+	case config.CacheBackendMemory:
+		return NewMemoryCache(cfg.CacheMaxBytes, cfg.CacheTTL), nil
+	case config.CacheBackendDisk:
+		return NewDiskCache(cfg.CacheDir, cfg.CacheMaxBytes, cfg.CacheTTL)
+	default:
+		return noopCache{}, nil
+	}
+}
+
+// Key derives a content address from the operation, its parameters and the
+// Digest of every uploaded file.
+func Key(operation string, params any, digests []string) string {
+	h := sha256.New()
+	writeField(h, []byte(operation))
+
+	paramsJSON, _ := json.Marshal(params)
+	writeField(h, paramsJSON)
+
+	for _, digest := range digests {
+		writeField(h, []byte(digest))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Digest addresses an uploaded file, so that its bytes can be let go before
+// the Key of its batch is known. Filenames are part of it because they end
+// up in the response archive.
+func Digest(image dto.ImageData) string {
+	h := sha256.New()
+	writeField(h, []byte(image.Filename))
+	writeField(h, image.ImageBytes)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeField length-prefixes b so that adjacent fields can't be shifted into
+// each other to produce the same digest.
+func writeField(h interface{ Write([]byte) (int, error) }, b []byte) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(b)))
+	_, _ = h.Write(size[:])
+	_, _ = h.Write(b)
+}
+
+type noopCache struct{}
+
+func (noopCache) Get(string) (Entry, bool) { return Entry{}, false }
+func (noopCache) Set(string, Entry)        {}
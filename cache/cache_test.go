@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+func TestKey(t *testing.T) {
+	images := []dto.ImageData{{Filename: "a.png", ImageBytes: []byte("abc")}}
+
+	tests := []struct {
+		name      string
+		operation string
+		params    any
+		images    []dto.ImageData
+		wantSame  bool
+	}{
+		{
+			name:      "identical input",
+			operation: "compress",
+			images:    []dto.ImageData{{Filename: "a.png", ImageBytes: []byte("abc")}},
+			wantSame:  true,
+		},
+		{
+			name:      "different operation",
+			operation: "png-to-jpeg",
+			images:    images,
+		},
+		{
+			name:      "different params",
+			operation: "compress",
+			params:    dto.ResizeRequest{Height: []int{1}, Width: []int{1}},
+			images:    images,
+		},
+		{
+			name:      "different filename",
+			operation: "compress",
+			images:    []dto.ImageData{{Filename: "b.png", ImageBytes: []byte("abc")}},
+		},
+		{
+			name:      "shifted field boundary",
+			operation: "compress",
+			images:    []dto.ImageData{{Filename: "a.pngabc"}},
+		},
+	}
+
+	digests := func(images []dto.ImageData) []string {
+		var digests []string
+		for _, image := range images {
+			digests = append(digests, Digest(image))
+		}
+		return digests
+	}
+
+	want := Key("compress", nil, digests(images))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Key(tt.operation, tt.params, digests(tt.images))
+			assert.Equal(t, tt.wantSame, got == want)
+		})
+	}
+}
+
+func testCache(t *testing.T, newCache func(maxBytes int64, ttl time.Duration) Cache) {
+	entry := func(body string) Entry {
+		return Entry{ContentType: "application/zip", Body: []byte(body)}
+	}
+
+	t.Run("get after set", func(t *testing.T) {
+		c := newCache(1<<10, 0)
+		c.Set("a", entry("hello"))
+
+		got, ok := c.Get("a")
+		assert.Equal(t, true, ok)
+		assert.Equal(t, entry("hello"), got)
+
+		_, ok = c.Get("missing")
+		assert.Equal(t, false, ok)
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c := newCache(64, 0)
+		c.Set("a", entry("0123456789"))
+		c.Set("b", entry("0123456789"))
+		_, _ = c.Get("a")
+		c.Set("c", entry("0123456789"))
+
+		_, ok := c.Get("a")
+		assert.Equal(t, true, ok)
+		_, ok = c.Get("b")
+		assert.Equal(t, false, ok)
+		_, ok = c.Get("c")
+		assert.Equal(t, true, ok)
+	})
+
+	t.Run("replacing a key keeps it", func(t *testing.T) {
+		c := newCache(1<<10, 0)
+		c.Set("a", entry("old"))
+		c.Set("a", entry("new"))
+
+		got, ok := c.Get("a")
+		assert.Equal(t, true, ok)
+		assert.Equal(t, entry("new"), got)
+	})
+
+	t.Run("skips entries larger than the cache", func(t *testing.T) {
+		c := newCache(8, 0)
+		c.Set("a", entry("0123456789"))
+
+		_, ok := c.Get("a")
+		assert.Equal(t, false, ok)
+	})
+
+	t.Run("expires after ttl", func(t *testing.T) {
+		c := newCache(1<<10, time.Millisecond)
+		c.Set("a", entry("hello"))
+		time.Sleep(5 * time.Millisecond)
+
+		_, ok := c.Get("a")
+		assert.Equal(t, false, ok)
+	})
+}
+
+func TestMemoryCache(t *testing.T) {
+	testCache(t, NewMemoryCache)
+}
+
+func TestDiskCache(t *testing.T) {
+	testCache(t, func(maxBytes int64, ttl time.Duration) Cache {
+		c, err := NewDiskCache(t.TempDir(), maxBytes, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	})
+
+	t.Run("reloads entries from disk", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := NewDiskCache(dir, 1<<10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Set("a", Entry{ContentType: "application/zip", Body: []byte("hello")})
+
+		reopened, err := NewDiskCache(dir, 1<<10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := reopened.Get("a")
+		assert.Equal(t, true, ok)
+		assert.Equal(t, []byte("hello"), got.Body)
+	})
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type diskCache struct {
+	mu    sync.Mutex
+	dir   string
+	index *lru[struct{}]
+}
+
+// NewDiskCache stores responses as files under dir. Entries already present
+// in dir are picked up, oldest first, so the cache survives restarts.
+func NewDiskCache(dir string, maxBytes int64, ttl time.Duration) (Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &diskCache{dir: dir}
+	c.index = newLRU[struct{}](maxBytes, ttl, func(key string) {
+		_ = os.Remove(c.path(key))
+	})
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || filepath.Ext(info.Name()) != "" {
+			continue
+		}
+
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	now := time.Now()
+	for _, info := range files {
+		var expiresAt time.Time
+		if ttl > 0 {
+			expiresAt = info.ModTime().Add(ttl)
+			if now.After(expiresAt) {
+				_ = os.Remove(c.path(info.Name()))
+				continue
+			}
+		}
+
+		c.index.addWithExpiry(info.Name(), struct{}{}, info.Size(), expiresAt)
+	}
+
+	return c, nil
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c *diskCache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.index.get(key, time.Now()); !ok {
+		return Entry{}, false
+	}
+
+	raw, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.index.remove(c.index.items[key])
+		return Entry{}, false
+	}
+
+	contentType, body, found := bytes.Cut(raw, []byte("\n"))
+	if !found {
+		c.index.remove(c.index.items[key])
+		return Entry{}, false
+	}
+
+	return Entry{ContentType: string(contentType), Body: body}, true
+}
+
+func (c *diskCache) Set(key string, entry Entry) {
+	size := int64(len(entry.ContentType) + 1 + len(entry.Body))
+	if size > c.index.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Write to a temporary name first so a crash never leaves a truncated
+	// entry behind under a valid key.
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(append([]byte(entry.ContentType+"\n"), entry.Body...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	c.index.add(key, struct{}{}, size, time.Now())
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+type lruItem[V any] struct {
+	key       string
+	value     V
+	size      int64
+	expiresAt time.Time
+}
+
+// lru tracks entries by recency and total size. It is not safe for concurrent
+// use; callers hold their own lock.
+type lru[V any] struct {
+	maxBytes int64
+	ttl      time.Duration
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+	onEvict  func(key string)
+}
+
+func newLRU[V any](maxBytes int64, ttl time.Duration, onEvict func(key string)) *lru[V] {
+	return &lru[V]{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		onEvict:  onEvict,
+	}
+}
+
+func (l *lru[V]) get(key string, now time.Time) (V, bool) {
+	var zero V
+	el, ok := l.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	item := el.Value.(*lruItem[V])
+	if !item.expiresAt.IsZero() && now.After(item.expiresAt) {
+		l.remove(el)
+		return zero, false
+	}
+
+	l.ll.MoveToFront(el)
+	return item.value, true
+}
+
+func (l *lru[V]) add(key string, value V, size int64, now time.Time) {
+	var expiresAt time.Time
+	if l.ttl > 0 {
+		expiresAt = now.Add(l.ttl)
+	}
+
+	// Replacing an entry in place keeps onEvict from firing for a key that
+	// is still live.
+	if el, ok := l.items[key]; ok {
+		item := el.Value.(*lruItem[V])
+		l.size += size - item.size
+		item.value, item.size, item.expiresAt = value, size, expiresAt
+		l.ll.MoveToFront(el)
+		l.evict()
+		return
+	}
+
+	l.addWithExpiry(key, value, size, expiresAt)
+}
+
+func (l *lru[V]) addWithExpiry(key string, value V, size int64, expiresAt time.Time) {
+	l.items[key] = l.ll.PushFront(&lruItem[V]{
+		key:       key,
+		value:     value,
+		size:      size,
+		expiresAt: expiresAt,
+	})
+	l.size += size
+	l.evict()
+}
+
+func (l *lru[V]) evict() {
+	for l.size > l.maxBytes {
+		oldest := l.ll.Back()
+		if oldest == nil {
+			break
+		}
+
+		l.remove(oldest)
+	}
+}
+
+func (l *lru[V]) remove(el *list.Element) {
+	item := l.ll.Remove(el).(*lruItem[V])
+	delete(l.items, item.key)
+	l.size -= item.size
+
+	if l.onEvict != nil {
+		l.onEvict(item.key)
+	}
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryCache struct {
+	mu    sync.Mutex
+	index *lru[Entry]
+}
+
+// NewMemoryCache keeps up to maxBytes of responses in process memory, evicting
+// the least recently used ones first. A zero ttl never expires entries.
+func NewMemoryCache(maxBytes int64, ttl time.Duration) Cache {
+	return &memoryCache{index: newLRU[Entry](maxBytes, ttl, nil)}
+}
+
+func (c *memoryCache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.index.get(key, time.Now())
+}
+
+func (c *memoryCache) Set(key string, entry Entry) {
+	if entry.size() > c.index.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.index.add(key, entry, entry.size(), time.Now())
+}
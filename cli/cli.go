@@ -0,0 +1,465 @@
+// Package cli runs the image operations of the server on local files, for
+// batch processing without a server.
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+)
+
+// ErrUsage is returned for invalid command lines, after printing the usage.
+var ErrUsage = errors.New("invalid usage")
+
+// ErrFailed is returned when some files failed to be processed.
+var ErrFailed = errors.New("some files failed")
+
+// ErrOutputConflict fails the inputs whose output would overwrite the
+// output of another input.
+var ErrOutputConflict = errors.New("output conflict")
+
+const (
+	StatusProcessed = "processed"
+	StatusPlanned   = "planned"
+	StatusInspected = "inspected"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// Summary is the report of a run, printed as JSON with -report.
+type Summary struct {
+	Command         string       `json:"command"`
+	DryRun          bool         `json:"dry_run,omitempty"`
+	Processed       int          `json:"processed"`
+	Skipped         int          `json:"skipped"`
+	Failed          int          `json:"failed"`
+	InputBytes      int          `json:"input_bytes"`
+	OutputBytes     int          `json:"output_bytes"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	Files           []FileResult `json:"files"`
+}
+
+type FileResult struct {
+	Input       string `json:"input"`
+	Output      string `json:"output,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	InputBytes  int    `json:"input_bytes"`
+	OutputBytes int    `json:"output_bytes,omitempty"`
+}
+
+// command is a subcommand processing one image at a time. Its outputs are
+// converted to outputType, if set, and keep their format otherwise.
+type command struct {
+	name                string
+	description         string
+	allowedContentTypes []string
+	outputType          string
+	resize              bool
+	process             func(ctx context.Context, uc usecase.ImageUsecase, img *dto.ImageData, resize dto.ResizeRequest) error
+}
+
+var allImageTypes = []string{
+	constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+}
+
+var commands = []command{
+	{
+		name:                "convert",
+		description:         "convert png, tiff and bmp images to jpeg",
+		allowedContentTypes: []string{constants.ContentTypeImagePng, constants.ContentTypeImageTiff, constants.ContentTypeImageBmp},
+		outputType:          constants.ContentTypeImageJpeg,
+		process: func(ctx context.Context, uc usecase.ImageUsecase, img *dto.ImageData, _ dto.ResizeRequest) error {
+			req := dto.ImageDataEncode{ImageDatas: []dto.ImageData{*img}}
+			err := uc.ConvertPngToJpeg(ctx, req)
+			*img = req.ImageDatas[0]
+			return err
+		},
+	},
+	{
+		name:                "compress",
+		description:         "compress png, jpeg, tiff and bmp images",
+		allowedContentTypes: allImageTypes,
+		process: func(ctx context.Context, uc usecase.ImageUsecase, img *dto.ImageData, _ dto.ResizeRequest) error {
+			req := dto.ImageDataEncode{ImageDatas: []dto.ImageData{*img}}
+			err := uc.CompressImages(ctx, req)
+			*img = req.ImageDatas[0]
+			return err
+		},
+	},
+	{
+		name:                "resize",
+		description:         "resize png, jpeg, tiff and bmp images",
+		allowedContentTypes: allImageTypes,
+		resize:              true,
+		process: func(ctx context.Context, uc usecase.ImageUsecase, img *dto.ImageData, resize dto.ResizeRequest) error {
+			req := dto.ImageDataResize{ResizeRequest: resize, ImageDatas: []dto.ImageData{*img}}
+			err := uc.ResizeImages(ctx, req)
+			*img = req.ImageDatas[0]
+			return err
+		},
+	},
+	{
+		name:                "process",
+		description:         "resize png, jpeg, tiff and bmp images, then encode them as jpeg",
+		allowedContentTypes: allImageTypes,
+		outputType:          constants.ContentTypeImageJpeg,
+		resize:              true,
+		process: func(ctx context.Context, uc usecase.ImageUsecase, img *dto.ImageData, resize dto.ResizeRequest) error {
+			req := dto.ImageDataResize{ResizeRequest: resize, ImageDatas: []dto.ImageData{*img}}
+			err := uc.ProcessImages(ctx, req)
+			*img = req.ImageDatas[0]
+			return err
+		},
+	},
+	{
+		name:                "inspect",
+		description:         "print the type and size of png, jpeg, tiff and bmp images",
+		allowedContentTypes: allImageTypes,
+	},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: image-processing-go [serve | <command> [flags] <file, directory or glob>...]")
+	fmt.Fprintln(w, "\ncommands:")
+	fmt.Fprintf(w, "  %-10s %s\n", "serve", "run the HTTP server, the default")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(w, "\nrun image-processing-go <command> -h for the flags of a command")
+}
+
+// Main runs the command of args and returns the exit code.
+func Main(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	err := Run(ctx, args, stdout, stderr)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, ErrUsage):
+		return 2
+	default:
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+}
+
+// Run runs the command of args, args[0] being its name.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		usage(stderr)
+		return ErrUsage
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			usage(stdout)
+			return nil
+		}
+
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		usage(stderr)
+		return ErrUsage
+	}
+
+	opts, err := parseOptions(cmd, args[1:], stderr)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := expandInputs(opts.inputs, opts.recursive)
+	if err != nil {
+		return err
+	}
+
+	// The backend is picked like the server's.
+	backend, err := usecase.NewBackend(config.Load().ImageBackend)
+	if err != nil {
+		return err
+	}
+
+	summary := run(ctx, usecase.NewImageUsecase().WithBackend(backend), cmd, opts, inputs)
+	if err := writeSummary(summary, opts.report, stdout); err != nil {
+		return err
+	}
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrFailed, summary.Failed, len(summary.Files))
+	}
+
+	return ctx.Err()
+}
+
+type options struct {
+	outDir    string
+	recursive bool
+	parallel  int
+	dryRun    bool
+	report    string
+	resize    dto.ResizeRequest
+	inputs    []string
+}
+
+func parseOptions(cmd command, args []string, stderr io.Writer) (options, error) {
+	var opts options
+	var height, width int
+
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: image-processing-go %s [flags] <file, directory or glob>...\n\n%s\n\nflags:\n",
+			cmd.name, cmd.description)
+		flags.PrintDefaults()
+	}
+
+	if cmd.process != nil {
+		flags.StringVar(&opts.outDir, "o", "out", "output directory, keeping the paths relative to input directories")
+		flags.BoolVar(&opts.dryRun, "dry-run", false, "only list the files that would be written")
+	}
+	flags.BoolVar(&opts.recursive, "r", false, "walk input directories recursively")
+	flags.IntVar(&opts.parallel, "parallel", runtime.NumCPU(), "images processed at once")
+	flags.StringVar(&opts.report, "report", "", "write the JSON summary to this file, - for stdout")
+	if cmd.resize {
+		flags.IntVar(&height, "height", 0, "target height in pixels")
+		flags.IntVar(&width, "width", 0, "target width in pixels")
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return opts, err
+		}
+		return opts, ErrUsage
+	}
+
+	opts.inputs = flags.Args()
+	if len(opts.inputs) == 0 {
+		fmt.Fprintln(stderr, "no input given")
+		flags.Usage()
+		return opts, ErrUsage
+	}
+
+	if opts.parallel < 1 {
+		opts.parallel = 1
+	}
+
+	if cmd.resize {
+		opts.resize = dto.ResizeRequest{Height: []int{height}, Width: []int{width}}
+		if err := opts.resize.Validate(); err != nil {
+			fmt.Fprintln(stderr, "-height and -width:", err)
+			return opts, ErrUsage
+		}
+	}
+
+	return opts, nil
+}
+
+// run processes inputs with opts.parallel workers. Results keep the order of
+// inputs.
+func run(ctx context.Context, uc usecase.ImageUsecase, cmd command, opts options, inputs []input) Summary {
+	start := time.Now()
+
+	claims := &outputClaims{inputs: map[string]string{}}
+	results := make([]FileResult, len(inputs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.parallel, len(inputs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = processFile(ctx, uc, cmd, opts, claims, inputs[i])
+			}
+		}()
+	}
+
+feed:
+	for i := range inputs {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			for ; i < len(inputs); i++ {
+				results[i] = FileResult{Input: inputs[i].path, Status: StatusFailed, Error: context.Cause(ctx).Error()}
+			}
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	summary := Summary{Command: cmd.name, DryRun: opts.dryRun, Files: results}
+	for _, result := range results {
+		switch result.Status {
+		case StatusSkipped:
+			summary.Skipped++
+		case StatusFailed:
+			summary.Failed++
+		default:
+			summary.Processed++
+		}
+		summary.InputBytes += result.InputBytes
+		summary.OutputBytes += result.OutputBytes
+	}
+	summary.DurationSeconds = time.Since(start).Seconds()
+
+	return summary
+}
+
+// outputClaims records the input of every output, so that inputs with the
+// same output don't overwrite each other. It is safe for concurrent use.
+type outputClaims struct {
+	mu     sync.Mutex
+	inputs map[string]string
+}
+
+// claim reserves output for input, failing with ErrOutputConflict when
+// another input has it.
+func (c *outputClaims) claim(output, input string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if other, ok := c.inputs[output]; ok {
+		return fmt.Errorf("%w: %s is also the output of %s", ErrOutputConflict, output, other)
+	}
+	c.inputs[output] = input
+	return nil
+}
+
+func processFile(ctx context.Context, uc usecase.ImageUsecase, cmd command, opts options, claims *outputClaims, in input) FileResult {
+	result := FileResult{Input: in.path}
+	fail := func(err error) FileResult {
+		result.Status = StatusFailed
+		if errors.Is(err, usecase.ErrContentTypeNotAllowed) {
+			result.Status = StatusSkipped
+		}
+		result.Error = err.Error()
+		return result
+	}
+
+	file, err := os.Open(in.path)
+	if err != nil {
+		return fail(err)
+	}
+	defer file.Close()
+
+	img, err := uc.ValidateAndProcessReader(ctx, in.rel, file, cmd.allowedContentTypes...)
+	if err != nil {
+		return fail(err)
+	}
+	result.ContentType = img.ContentType
+	result.InputBytes = len(img.ImageBytes)
+
+	if cmd.process == nil {
+		imgConfig, _, err := image.DecodeConfig(bytes.NewReader(img.ImageBytes))
+		if err != nil {
+			return fail(err)
+		}
+		result.Width, result.Height = imgConfig.Width, imgConfig.Height
+		result.Status = StatusInspected
+		return result
+	}
+
+	output := filepath.Join(opts.outDir, outputName(cmd, img))
+	if err := claims.claim(output, in.path); err != nil {
+		return fail(err)
+	}
+
+	if opts.dryRun {
+		result.Output = output
+		result.Status = StatusPlanned
+		return result
+	}
+
+	if err := cmd.process(ctx, uc, &img, opts.resize); err != nil {
+		return fail(err)
+	}
+
+	result.Output = filepath.Join(opts.outDir, filepath.FromSlash(img.Filename))
+	if err := writeFile(result.Output, img.ImageBytes); err != nil {
+		return fail(err)
+	}
+	result.OutputBytes = len(img.ImageBytes)
+	result.Status = StatusProcessed
+
+	return result
+}
+
+// outputName is the name the usecase gives to the output of img.
+func outputName(cmd command, img dto.ImageData) string {
+	name := img.Filename
+	if cmd.outputType != "" {
+		name = usecase.OutputFilename(name, img.ContentType, cmd.outputType)
+	}
+
+	return filepath.FromSlash(name)
+}
+
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(name, data, 0o644)
+}
+
+func writeSummary(summary Summary, report string, stdout io.Writer) error {
+	if report == "" {
+		for _, result := range summary.Files {
+			line := fmt.Sprintf("%-9s %s", result.Status, result.Input)
+			switch {
+			case result.Error != "":
+				line += ": " + result.Error
+			case result.Output != "":
+				line += " -> " + result.Output
+			case result.Status == StatusInspected:
+				line += fmt.Sprintf(": %s %dx%d %d bytes", result.ContentType, result.Width, result.Height, result.InputBytes)
+			}
+			fmt.Fprintln(stdout, line)
+		}
+		fmt.Fprintf(stdout, "%d processed, %d skipped, %d failed in %.2fs\n",
+			summary.Processed, summary.Skipped, summary.Failed, summary.DurationSeconds)
+		return nil
+	}
+
+	body, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	if report == "-" {
+		_, err = stdout.Write(body)
+		return err
+	}
+
+	return writeFile(report, body)
+}
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/usecase"
+)
+
+// newTestDir lays out the test images in a temporary directory:
+//
+//	flower.png, cat.jpg, text.txt, sub/flower.png
+func newTestDir(t *testing.T) string {
+	dir := t.TempDir()
+	copyFile := func(src, dst string) {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(filepath.Join(dir, dst), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copyFile(".././imagetest/flower.png", "flower.png")
+	copyFile(".././imagetest/cat.jpg", "cat.jpg")
+	copyFile(".././imagetest/text.txt", "text.txt")
+	copyFile(".././imagetest/flower.png", "sub/flower.png")
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        func(dir, out string) []string
+		wantErr     error
+		wantSummary Summary
+		wantOutputs []string
+	}{
+		{
+			name: "compress directory",
+			args: func(dir, out string) []string {
+				return []string{"compress", "-o", out, "-report", "-", dir}
+			},
+			wantSummary: Summary{Command: "compress", Processed: 2, Skipped: 1},
+			wantOutputs: []string{"cat.jpg", "flower.png"},
+		},
+		{
+			name: "compress directory recursively",
+			args: func(dir, out string) []string {
+				return []string{"compress", "-o", out, "-r", "-parallel", "2", "-report", "-", dir}
+			},
+			wantSummary: Summary{Command: "compress", Processed: 3, Skipped: 1},
+			wantOutputs: []string{"cat.jpg", "flower.png", "sub/flower.png"},
+		},
+		{
+			name: "convert glob",
+			args: func(dir, out string) []string {
+				return []string{"convert", "-o", out, "-report", "-", filepath.Join(dir, "*.png")}
+			},
+			wantSummary: Summary{Command: "convert", Processed: 1},
+			wantOutputs: []string{"flower.jpeg"},
+		},
+		{
+			name: "process files",
+			args: func(dir, out string) []string {
+				return []string{
+					"process", "-o", out, "-height", "10", "-width", "20", "-report", "-",
+					filepath.Join(dir, "cat.jpg"), filepath.Join(dir, "sub/flower.png"),
+				}
+			},
+			wantSummary: Summary{Command: "process", Processed: 2},
+			wantOutputs: []string{"cat.jpg", "flower.jpeg"},
+		},
+		{
+			name: "files with the same name",
+			args: func(dir, out string) []string {
+				return []string{
+					"compress", "-o", out, "-parallel", "1", "-report", "-",
+					filepath.Join(dir, "flower.png"), filepath.Join(dir, "sub/flower.png"),
+				}
+			},
+			wantErr:     ErrFailed,
+			wantSummary: Summary{Command: "compress", Processed: 1, Failed: 1},
+			wantOutputs: []string{"flower.png"},
+		},
+		{
+			name: "dry run",
+			args: func(dir, out string) []string {
+				return []string{"resize", "-o", out, "-height", "10", "-width", "10", "-dry-run", "-report", "-", dir}
+			},
+			wantSummary: Summary{Command: "resize", DryRun: true, Processed: 2, Skipped: 1},
+		},
+		{
+			name: "inspect",
+			args: func(dir, out string) []string {
+				return []string{"inspect", "-report", "-", filepath.Join(dir, "flower.png")}
+			},
+			wantSummary: Summary{Command: "inspect", Processed: 1},
+		},
+		{
+			name: "failed file",
+			args: func(dir, out string) []string {
+				if err := os.WriteFile(filepath.Join(dir, "corrupt.png"), []byte("\x89PNG\r\n\x1a\ncorrupt"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return []string{"compress", "-o", out, "-report", "-", filepath.Join(dir, "corrupt.png")}
+			},
+			wantErr:     ErrFailed,
+			wantSummary: Summary{Command: "compress", Failed: 1},
+		},
+		{
+			name:    "resize without size",
+			args:    func(dir, out string) []string { return []string{"resize", dir} },
+			wantErr: ErrUsage,
+		},
+		{
+			name:    "no input",
+			args:    func(dir, out string) []string { return []string{"compress"} },
+			wantErr: ErrUsage,
+		},
+		{
+			name:    "unknown command",
+			args:    func(dir, out string) []string { return []string{"rotate", dir} },
+			wantErr: ErrUsage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestDir(t)
+			out := filepath.Join(t.TempDir(), "out")
+
+			var stdout bytes.Buffer
+			err := Run(context.Background(), tt.args(dir, out), &stdout, io.Discard)
+			if tt.wantErr != nil {
+				assert.Equal(t, true, errors.Is(err, tt.wantErr))
+			} else {
+				assert.Equal(t, nil, err)
+			}
+
+			if tt.wantSummary.Command == "" {
+				return
+			}
+
+			var summary Summary
+			if err := json.Unmarshal(stdout.Bytes(), &summary); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantSummary.Command, summary.Command)
+			assert.Equal(t, tt.wantSummary.DryRun, summary.DryRun)
+			assert.Equal(t, tt.wantSummary.Processed, summary.Processed)
+			assert.Equal(t, tt.wantSummary.Skipped, summary.Skipped)
+			assert.Equal(t, tt.wantSummary.Failed, summary.Failed)
+
+			var outputs []string
+			_ = filepath.WalkDir(out, func(name string, entry os.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() {
+					rel, _ := filepath.Rel(out, name)
+					outputs = append(outputs, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			assert.Equal(t, tt.wantOutputs, outputs)
+		})
+	}
+}
+
+func TestRun_Inspect(t *testing.T) {
+	var stdout bytes.Buffer
+	err := Run(context.Background(), []string{"inspect", "-report", "-", ".././imagetest/cat.jpg"}, &stdout, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summary Summary
+	if err := json.Unmarshal(stdout.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(summary.Files))
+	assert.Equal(t, StatusInspected, summary.Files[0].Status)
+	assert.Equal(t, "image/jpeg", summary.Files[0].ContentType)
+	assert.NotEqual(t, 0, summary.Files[0].Width)
+	assert.NotEqual(t, 0, summary.Files[0].Height)
+}
+
+func TestRun_DryRunOutputs(t *testing.T) {
+	dir := newTestDir(t)
+	for _, name := range []string{"scan.tiff", "legacy.bmp"} {
+		data, err := os.ReadFile(filepath.Join(".././imagetest", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(filepath.Join(dir, name), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout bytes.Buffer
+	err := Run(context.Background(), []string{"convert", "-o", "out", "-dry-run", "-r", "-report", "-", dir}, &stdout, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summary Summary
+	if err := json.Unmarshal(stdout.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	var planned []string
+	for _, result := range summary.Files {
+		if result.Status == StatusPlanned {
+			planned = append(planned, filepath.ToSlash(result.Output))
+		}
+	}
+	assert.Equal(t, []string{"out/flower.jpeg", "out/legacy.jpeg", "out/scan.jpeg", "out/sub/flower.jpeg"}, planned)
+}
+
+func TestRun_Backend(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		wantErr error
+	}{
+		{
+			name:    "go backend",
+			backend: usecase.BackendGo,
+		},
+		{
+			name:    "unknown backend",
+			backend: "unknown",
+			wantErr: usecase.ErrUnknownBackend,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("IMAGE_BACKEND", tt.backend)
+
+			err := Run(context.Background(), []string{"compress", "-o", t.TempDir(), ".././imagetest/cat.jpg"}, io.Discard, io.Discard)
+			if tt.wantErr != nil {
+				assert.Equal(t, true, errors.Is(err, tt.wantErr))
+			} else {
+				assert.Equal(t, nil, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// input is a file to process. rel is its path relative to the directory it
+// was found in, or its base name when given directly, with forward slashes.
+// Outputs are written to rel in the output directory.
+type input struct {
+	path string
+	rel  string
+}
+
+// expandInputs resolves files, directories and glob patterns to the files
+// they name, once each. Directories are only walked recursively with
+// recursive.
+func expandInputs(args []string, recursive bool) ([]input, error) {
+	var inputs []input
+	seen := map[string]bool{}
+	add := func(path, rel string) {
+		if !seen[path] {
+			seen[path] = true
+			inputs = append(inputs, input{path: path, rel: filepath.ToSlash(rel)})
+		}
+	}
+
+	for _, arg := range args {
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no file matches", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			stat, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+
+			if !stat.IsDir() {
+				add(path, filepath.Base(path))
+				continue
+			}
+
+			err = filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() {
+					if name != path && !recursive {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !entry.Type().IsRegular() {
+					return nil
+				}
+
+				rel, err := filepath.Rel(path, name)
+				if err != nil {
+					return err
+				}
+				add(name, rel)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return inputs, nil
+}
@@ -0,0 +1,508 @@
+// Package client is a Go client of the image processing HTTP API.
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+)
+
+const (
+	DefaultMaxRetries   = 2
+	DefaultRetryWait    = 500 * time.Millisecond
+	DefaultMaxRetryWait = 30 * time.Second
+
+	// reportName is the zip entry holding the report of the request.
+	reportName = "report.json"
+)
+
+// Client calls the API at a base URL. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	apiKey       string
+	maxRetries   int
+	retryWait    time.Duration
+	maxRetryWait time.Duration
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey authenticates requests with key.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries retries requests failing with a network error, 429, 502, 503
+// or 504 up to maxRetries times, waiting for the Retry-After of the response
+// or else wait, doubled after each attempt. Exceeded quotas are not retried.
+func WithRetries(maxRetries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryWait = wait
+	}
+}
+
+// WithMaxRetryWait caps the wait before a retry, whatever the Retry-After
+// of the response.
+func WithMaxRetryWait(wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetryWait = wait
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		maxRetries:   DefaultMaxRetries,
+		retryWait:    DefaultRetryWait,
+		maxRetryWait: DefaultMaxRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Request lists the source images, mirroring dto.FilesRequest. Images are
+// uploaded as files, URLs are downloaded and UploadIDs reference completed
+// resumable uploads by the server. Archive is a zip or tar file whose
+// entries are processed after the other sources. Encode overrides the
+// output format, quality and speed.
+type Request struct {
+	Images    []dto.ImageData
+	URLs      []string
+	UploadIDs []string
+	Archive   *dto.ImageData
+	Encode    dto.EncodeRequest
+	// IfNoneMatch is the ETag of a previous response. When the response
+	// would be the same, the server answers with Response.NotModified
+	// instead of the images.
+	IfNoneMatch string
+}
+
+// ResizeRequest mirrors dto.FilesResizeRequest. A single height and width
+// pair applies to every image.
+type ResizeRequest struct {
+	Request
+	Height []int
+	Width  []int
+}
+
+// CropRequest mirrors dto.FilesCropRequest. A single rectangle applies to
+// every image.
+type CropRequest struct {
+	Request
+	X      []int
+	Y      []int
+	Width  []int
+	Height []int
+}
+
+// FramesRequest mirrors dto.FilesFramesRequest. Frame picks a single frame,
+// all are exported without it. Format is png, the default, or jpeg.
+type FramesRequest struct {
+	Request
+	Format string
+	Frame  *int
+}
+
+// PagesRequest mirrors dto.FilesPagesRequest. Format is png, the default,
+// or jpeg.
+type PagesRequest struct {
+	Request
+	Format string
+}
+
+// Response holds the processed images, named as returned by the server.
+type Response struct {
+	Images []dto.ImageData
+	Report dto.Report
+	// ETag identifies the response, send it back in Request.IfNoneMatch to
+	// skip identical requests.
+	ETag string
+	// Cached tells whether the server answered from its cache.
+	Cached bool
+	// NotModified tells that the response is the one of Request.IfNoneMatch,
+	// Images and Report are then empty.
+	NotModified bool
+}
+
+// Error is the error response of the API.
+type Error struct {
+	StatusCode int
+	Code       apperror.Code
+	Message    string
+	Field      string
+	FileIndex  *int
+	Filename   string
+	RequestID  string
+	// RetryAfter is how long the server asked to wait before retrying.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	if e.Filename != "" {
+		msg += " (" + e.Filename + ")"
+	}
+
+	return msg
+}
+
+// Temporary tells whether the request may succeed when retried soon. An
+// exceeded quota is not, it resets the next day.
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests:
+		return e.Code != apperror.CodeQuotaExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// PngToJpeg converts png images to jpeg.
+func (c *Client) PngToJpeg(ctx context.Context, req Request) (Response, error) {
+	return c.do(ctx, "/png-to-jpeg", req, nil)
+}
+
+// Compress compresses png and jpeg images.
+func (c *Client) Compress(ctx context.Context, req Request) (Response, error) {
+	return c.do(ctx, "/compress", req, nil)
+}
+
+// Resize resizes png and jpeg images.
+func (c *Client) Resize(ctx context.Context, req ResizeRequest) (Response, error) {
+	return c.do(ctx, "/resize", req.Request, resizeFields(req))
+}
+
+// Process resizes images, then encodes them as jpeg or in the requested
+// format.
+func (c *Client) Process(ctx context.Context, req ResizeRequest) (Response, error) {
+	return c.do(ctx, "/", req.Request, resizeFields(req))
+}
+
+// Crop crops images to a rectangle.
+func (c *Client) Crop(ctx context.Context, req CropRequest) (Response, error) {
+	values := url.Values{}
+	addInts(values, "x[]", req.X)
+	addInts(values, "y[]", req.Y)
+	addInts(values, "width[]", req.Width)
+	addInts(values, "height[]", req.Height)
+
+	return c.do(ctx, "/crop", req.Request, values)
+}
+
+// GifFrames exports the frames of gif images.
+func (c *Client) GifFrames(ctx context.Context, req FramesRequest) (Response, error) {
+	values := url.Values{}
+	if req.Format != "" {
+		values.Set("format", req.Format)
+	}
+	if req.Frame != nil {
+		values.Set("frame", strconv.Itoa(*req.Frame))
+	}
+
+	return c.do(ctx, "/gif-frames", req.Request, values)
+}
+
+// TiffPages splits tiff images into their pages.
+func (c *Client) TiffPages(ctx context.Context, req PagesRequest) (Response, error) {
+	values := url.Values{}
+	if req.Format != "" {
+		values.Set("format", req.Format)
+	}
+
+	return c.do(ctx, "/tiff-pages", req.Request, values)
+}
+
+// Compare scores the second image of req against the first, the reference,
+// with PSNR and SSIM.
+func (c *Client) Compare(ctx context.Context, req Request) (dto.CompareResponse, error) {
+	var resp dto.CompareResponse
+	_, body, err := c.post(ctx, "/compare", req, nil, constants.ContentTypeApplicationJson)
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, json.Unmarshal(body, &resp)
+}
+
+func resizeFields(req ResizeRequest) url.Values {
+	values := url.Values{}
+	addInts(values, "height[]", req.Height)
+	addInts(values, "width[]", req.Width)
+
+	return values
+}
+
+func addInts(values url.Values, field string, ints []int) {
+	for _, i := range ints {
+		values.Add(field, strconv.Itoa(i))
+	}
+}
+
+func encodeFields(req dto.EncodeRequest, values url.Values) url.Values {
+	if values == nil {
+		values = url.Values{}
+	}
+	if req.Format != "" {
+		values.Set("format", req.Format)
+	}
+	if req.Quality > 0 {
+		values.Set("quality", strconv.Itoa(req.Quality))
+	}
+	if req.Speed > 0 {
+		values.Set("speed", strconv.Itoa(req.Speed))
+	}
+	if req.SSIM > 0 {
+		values.Set("ssim", strconv.FormatFloat(req.SSIM, 'f', -1, 64))
+	}
+	if req.Score {
+		values.Set("score", "true")
+	}
+
+	return values
+}
+
+// do posts req to path and reads the images of the zip response.
+func (c *Client) do(ctx context.Context, path string, req Request, values url.Values) (Response, error) {
+	httpResp, body, err := c.post(ctx, path, req, values, constants.ContentTypeApplicationZip)
+	if err != nil {
+		return Response{}, err
+	}
+
+	resp := Response{
+		ETag:        httpResp.Header.Get("ETag"),
+		Cached:      httpResp.Header.Get("X-Cache") == "HIT",
+		NotModified: httpResp.StatusCode == http.StatusNotModified,
+	}
+	if resp.NotModified {
+		return resp, nil
+	}
+
+	resp.Images, resp.Report, err = unzipImages(body)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to read the zip response: %w", err)
+	}
+
+	return resp, nil
+}
+
+// post sends req and values as a multipart form to path, retrying the
+// temporary failures, and returns the successful response and its body.
+func (c *Client) post(ctx context.Context, path string, req Request, values url.Values, accept string) (*http.Response, []byte, error) {
+	body, contentType, err := multipartBody(req, encodeFields(req.Encode, values))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpResp, respBody, err := c.send(ctx, path, req.IfNoneMatch, body, contentType, accept)
+		if err == nil || attempt >= c.maxRetries || !retryable(ctx, err) {
+			return httpResp, respBody, err
+		}
+
+		wait := c.retryWait << attempt
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+
+		timer := time.NewTimer(min(wait, c.maxRetryWait))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+
+	// Other errors come from the transport.
+	return true
+}
+
+// send posts body once. Responses other than 200, 201 and 304 are returned
+// as an *Error.
+func (c *Client) send(ctx context.Context, path, ifNoneMatch string, body []byte, contentType, accept string) (*http.Response, []byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("Accept", accept)
+	if ifNoneMatch != "" {
+		httpReq.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch httpResp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNotModified:
+		return httpResp, respBody, nil
+	default:
+		return nil, nil, parseError(httpResp, respBody)
+	}
+}
+
+func multipartBody(req Request, values url.Values) ([]byte, string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	for _, img := range req.Images {
+		part, err := w.CreateFormFile("files[]", img.Filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(img.ImageBytes); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if req.Archive != nil {
+		part, err := w.CreateFormFile("archive", req.Archive.Filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(req.Archive.ImageBytes); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if values == nil {
+		values = url.Values{}
+	}
+	values["urls[]"] = req.URLs
+	values["upload_ids[]"] = req.UploadIDs
+
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		for _, value := range values[field] {
+			if err := w.WriteField(field, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body.Bytes(), w.FormDataContentType(), nil
+}
+
+func parseError(resp *http.Response, body []byte) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var errResp dto.ErrorResponse
+	if json.Unmarshal(body, &errResp) == nil && errResp.Code != "" {
+		apiErr.Code = apperror.Code(errResp.Code)
+		apiErr.Message = errResp.Error
+		apiErr.Field = errResp.Field
+		apiErr.FileIndex = errResp.FileIndex
+		apiErr.Filename = errResp.Filename
+		apiErr.RequestID = errResp.RequestID
+	}
+
+	return apiErr
+}
+
+func unzipImages(body []byte) ([]dto.ImageData, dto.Report, error) {
+	var report dto.Report
+	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, report, err
+	}
+
+	images := make([]dto.ImageData, 0, len(zipReader.File))
+	for _, file := range zipReader.File {
+		data, err := readZipFile(file)
+		if err != nil {
+			return nil, report, err
+		}
+
+		if file.Name == reportName {
+			if err := json.Unmarshal(data, &report); err != nil {
+				return nil, report, err
+			}
+			continue
+		}
+
+		images = append(images, dto.ImageData{
+			Filename:    file.Name,
+			ContentType: usecase.DetectContentType(data),
+			ImageBytes:  data,
+		})
+	}
+
+	return images, report, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
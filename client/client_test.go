@@ -0,0 +1,373 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apikey"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/client"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/handler"
+)
+
+func newTestRouter(t *testing.T, cfg config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := handler.SetupImageRoute(router, handler.Dependencies{Config: cfg}); err != nil {
+		t.Fatal(err)
+	}
+
+	return router
+}
+
+func newTestServer(t *testing.T, h http.Handler) *httptest.Server {
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func readImage(t *testing.T, filePath string) dto.ImageData {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dto.ImageData{Filename: filePath[len(".././imagetest/"):], ImageBytes: data}
+}
+
+func imageSize(t *testing.T, img dto.ImageData) image.Point {
+	imgConfig, _, err := image.DecodeConfig(bytes.NewReader(img.ImageBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return image.Pt(imgConfig.Width, imgConfig.Height)
+}
+
+func TestClient(t *testing.T) {
+	server := newTestServer(t, newTestRouter(t, config.Config{}))
+	c := client.New(server.URL)
+	ctx := context.Background()
+
+	flower := readImage(t, ".././imagetest/flower.png")
+	cat := readImage(t, ".././imagetest/cat.jpg")
+	sticker := readImage(t, ".././imagetest/sticker.gif")
+	scan := readImage(t, ".././imagetest/scan.tiff")
+	secondFrame := 1
+
+	tests := []struct {
+		name          string
+		call          func() (client.Response, error)
+		wantFilenames []string
+		wantType      []string
+		wantSize      image.Point
+	}{
+		{
+			name: "png to jpeg",
+			call: func() (client.Response, error) {
+				return c.PngToJpeg(ctx, client.Request{Images: []dto.ImageData{flower}})
+			},
+			wantFilenames: []string{"flower.jpeg"},
+			wantType:      []string{constants.ContentTypeImageJpeg},
+		},
+		{
+			name: "compress",
+			call: func() (client.Response, error) {
+				return c.Compress(ctx, client.Request{Images: []dto.ImageData{flower, cat}})
+			},
+			wantFilenames: []string{"flower.png", "cat.jpg"},
+			wantType:      []string{constants.ContentTypeImagePng, constants.ContentTypeImageJpeg},
+		},
+		{
+			name: "compress to png",
+			call: func() (client.Response, error) {
+				return c.Compress(ctx, client.Request{
+					Images: []dto.ImageData{cat},
+					Encode: dto.EncodeRequest{Format: dto.EncodeFormatPng},
+				})
+			},
+			wantFilenames: []string{"cat.png"},
+			wantType:      []string{constants.ContentTypeImagePng},
+		},
+		{
+			name: "compress to an ssim",
+			call: func() (client.Response, error) {
+				return c.Compress(ctx, client.Request{
+					Images: []dto.ImageData{cat},
+					Encode: dto.EncodeRequest{Format: dto.EncodeFormatJpeg, SSIM: 0.95},
+				})
+			},
+			wantFilenames: []string{"cat.jpg"},
+			wantType:      []string{constants.ContentTypeImageJpeg},
+		},
+		{
+			name: "resize",
+			call: func() (client.Response, error) {
+				return c.Resize(ctx, client.ResizeRequest{
+					Request: client.Request{Images: []dto.ImageData{flower, cat}},
+					Height:  []int{10},
+					Width:   []int{20},
+				})
+			},
+			wantFilenames: []string{"flower.png", "cat.jpg"},
+			wantType:      []string{constants.ContentTypeImagePng, constants.ContentTypeImageJpeg},
+			wantSize:      image.Pt(20, 10),
+		},
+		{
+			name: "process",
+			call: func() (client.Response, error) {
+				return c.Process(ctx, client.ResizeRequest{
+					Request: client.Request{Images: []dto.ImageData{flower}},
+					Height:  []int{30},
+					Width:   []int{40},
+				})
+			},
+			wantFilenames: []string{"flower.jpeg"},
+			wantType:      []string{constants.ContentTypeImageJpeg},
+			wantSize:      image.Pt(40, 30),
+		},
+		{
+			name: "resize tiff",
+			call: func() (client.Response, error) {
+				return c.Resize(ctx, client.ResizeRequest{
+					Request: client.Request{Images: []dto.ImageData{scan}},
+					Height:  []int{10},
+					Width:   []int{20},
+				})
+			},
+			wantFilenames: []string{"scan.tiff"},
+			wantType:      []string{constants.ContentTypeImageTiff},
+		},
+		{
+			name: "crop",
+			call: func() (client.Response, error) {
+				return c.Crop(ctx, client.CropRequest{
+					Request: client.Request{Images: []dto.ImageData{flower}},
+					X:       []int{5},
+					Y:       []int{5},
+					Width:   []int{20},
+					Height:  []int{10},
+				})
+			},
+			wantFilenames: []string{"flower.png"},
+			wantType:      []string{constants.ContentTypeImagePng},
+			wantSize:      image.Pt(20, 10),
+		},
+		{
+			name: "gif frames",
+			call: func() (client.Response, error) {
+				return c.GifFrames(ctx, client.FramesRequest{
+					Request: client.Request{Images: []dto.ImageData{sticker}},
+					Format:  dto.FrameFormatJpeg,
+					Frame:   &secondFrame,
+				})
+			},
+			wantFilenames: []string{"sticker.jpeg"},
+			wantType:      []string{constants.ContentTypeImageJpeg},
+		},
+		{
+			name: "tiff pages",
+			call: func() (client.Response, error) {
+				return c.TiffPages(ctx, client.PagesRequest{Request: client.Request{Images: []dto.ImageData{scan}}})
+			},
+			wantFilenames: []string{"scan-001.png", "scan-002.png", "scan-003.png"},
+			wantType:      []string{constants.ContentTypeImagePng, constants.ContentTypeImagePng, constants.ContentTypeImagePng},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.call()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, len(tt.wantFilenames), len(resp.Images))
+			for i, img := range resp.Images {
+				assert.Equal(t, tt.wantFilenames[i], img.Filename)
+				assert.Equal(t, tt.wantType[i], img.ContentType)
+				if tt.wantSize != (image.Point{}) {
+					assert.Equal(t, tt.wantSize, imageSize(t, img))
+				}
+			}
+			assert.NotEqual(t, "", resp.ETag)
+		})
+	}
+}
+
+func TestClient_Compare(t *testing.T) {
+	server := newTestServer(t, newTestRouter(t, config.Config{}))
+	cat := readImage(t, ".././imagetest/cat.jpg")
+
+	resp, err := client.New(server.URL).Compare(context.Background(), client.Request{Images: []dto.ImageData{cat, cat}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "cat.jpg", resp.Reference)
+	assert.Equal(t, 1.0, resp.SSIM)
+}
+
+func TestClient_IfNoneMatch(t *testing.T) {
+	server := newTestServer(t, newTestRouter(t, config.Config{}))
+	c := client.New(server.URL)
+	req := client.Request{Images: []dto.ImageData{readImage(t, ".././imagetest/cat.jpg")}}
+
+	first, err := c.Compress(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, false, first.NotModified)
+
+	req.IfNoneMatch = first.ETag
+	resp, err := c.Compress(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, true, resp.NotModified)
+	assert.Equal(t, first.ETag, resp.ETag)
+	assert.Equal(t, 0, len(resp.Images))
+}
+
+func TestClient_Error(t *testing.T) {
+	server := newTestServer(t, newTestRouter(t, config.Config{}))
+	c := client.New(server.URL)
+
+	_, err := c.Compress(context.Background(), client.Request{
+		Images: []dto.ImageData{
+			readImage(t, ".././imagetest/cat.jpg"),
+			{Filename: "notes.txt", ImageBytes: []byte("notes")},
+		},
+	})
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Compress() error = %v, want a *client.Error", err)
+	}
+	assert.Equal(t, http.StatusUnsupportedMediaType, apiErr.StatusCode)
+	assert.Equal(t, apperror.CodeUnsupportedType, apiErr.Code)
+	assert.Equal(t, "files[]", apiErr.Field)
+	assert.Equal(t, 1, *apiErr.FileIndex)
+	assert.Equal(t, "notes.txt", apiErr.Filename)
+	assert.Equal(t, false, apiErr.Temporary())
+}
+
+// failure is a response the test server fails with.
+type failure struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+func TestClient_Retries(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+	req := client.Request{Images: []dto.ImageData{readImage(t, ".././imagetest/cat.jpg")}}
+
+	serverBusy := failure{
+		status: http.StatusServiceUnavailable,
+		body:   `{"error":"too many requests are waiting to be processed","code":"SERVER_BUSY"}`,
+	}
+
+	tests := []struct {
+		name       string
+		cancelled  bool
+		failure    failure
+		failures   int32
+		maxRetries int
+		wantErr    apperror.Code
+		wantCalls  int32
+	}{
+		{name: "succeeds after retrying", failure: serverBusy, failures: 2, maxRetries: 2, wantCalls: 3},
+		{name: "gives up", failure: serverBusy, failures: 2, maxRetries: 1, wantErr: apperror.CodeServerBusy, wantCalls: 2},
+		{name: "cancelled", cancelled: true, maxRetries: 2, wantCalls: 0},
+		{
+			name: "long retry after is capped",
+			failure: failure{
+				status:     http.StatusTooManyRequests,
+				retryAfter: "3600",
+				body:       `{"error":"rate limited","code":"RATE_LIMITED"}`,
+			},
+			failures:   1,
+			maxRetries: 1,
+			wantCalls:  2,
+		},
+		{
+			name: "exceeded quota is not retried",
+			failure: failure{
+				status:     http.StatusTooManyRequests,
+				retryAfter: "3600",
+				body:       `{"error":"daily quota exceeded","code":"QUOTA_EXCEEDED"}`,
+			},
+			failures:   1,
+			maxRetries: 2,
+			wantErr:    apperror.CodeQuotaExceeded,
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					w.Header().Set("Content-Type", constants.ContentTypeApplicationJson)
+					if tt.failure.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.failure.retryAfter)
+					}
+					w.WriteHeader(tt.failure.status)
+					_, _ = w.Write([]byte(tt.failure.body))
+					return
+				}
+
+				router.ServeHTTP(w, r)
+			}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+
+			c := client.New(server.URL, client.WithRetries(tt.maxRetries, time.Millisecond), client.WithMaxRetryWait(10*time.Millisecond))
+			resp, err := c.Compress(ctx, req)
+			assert.Equal(t, tt.wantCalls, calls.Load())
+
+			var apiErr *client.Error
+			switch {
+			case tt.cancelled:
+				assert.Equal(t, true, errors.Is(err, context.Canceled))
+			case tt.wantErr != "":
+				assert.Equal(t, true, errors.As(err, &apiErr))
+				assert.Equal(t, tt.wantErr, apiErr.Code)
+			default:
+				assert.Equal(t, nil, err)
+				assert.Equal(t, 1, len(resp.Images))
+			}
+		})
+	}
+}
+
+func TestClient_APIKey(t *testing.T) {
+	server := newTestServer(t, newTestRouter(t, config.Config{
+		APIKeys: []string{"team-a:" + apikey.HashKey("secret-a")},
+	}))
+	req := client.Request{Images: []dto.ImageData{readImage(t, ".././imagetest/cat.jpg")}}
+
+	_, err := client.New(server.URL).Compress(context.Background(), req)
+	var apiErr *client.Error
+	assert.Equal(t, true, errors.As(err, &apiErr))
+	assert.Equal(t, apperror.CodeUnauthorized, apiErr.Code)
+
+	_, err = client.New(server.URL, client.WithAPIKey("secret-a")).Compress(context.Background(), req)
+	assert.Equal(t, nil, err)
+}
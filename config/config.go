@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port     string
+	LogLevel string
+
+	MaxBodyBytes         int64
+	UploadSpoolThreshold int64
+	UploadMaxValueBytes  int64
+	UploadMaxParts       int
+	UploadTempDir        string
+
+	ProcessTimeout time.Duration
+	ImageTimeout   time.Duration
+
+	// ImageBackend names the backend processing the images, the default
+	// of usecase.NewBackend when empty.
+	ImageBackend string
+
+	WorkerCount     int
+	WorkerQueueSize int
+
+	DrainDelay   time.Duration
+	DrainTimeout time.Duration
+
+	CacheBackend  string
+	CacheDir      string
+	CacheMaxBytes int64
+	CacheTTL      time.Duration
+
+	StorageDriver      string
+	StorageLocalDir    string
+	StorageLocalSecret string
+	StoragePublicURL   string
+	StoragePresignTTL  time.Duration
+
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3UsePathStyle    bool
+
+	FetchAllowedHosts         []string
+	FetchAllowPrivateNetworks bool
+	FetchMaxBytes             int64
+	FetchTimeout              time.Duration
+	FetchMaxRedirects         int
+
+	ArchiveMaxEntries    int
+	ArchiveMaxTotalBytes int64
+	ArchiveMaxRatio      float64
+
+	TusDir     string
+	TusMaxSize int64
+	TusExpiry  time.Duration
+
+	APIKeys                  []string
+	APIKeysFile              string
+	RateLimitRequests        float64
+	RateLimitBurst           int
+	RateLimitMegapixels      float64
+	RateLimitMegapixelsBurst float64
+	DailyQuota               int64
+}
+
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+	CacheBackendDisk   = "disk"
+)
+
+const (
+	StorageDriverNone  = "none"
+	StorageDriverLocal = "local"
+	StorageDriverS3    = "s3"
+)
+
+func Load() Config {
+	return Config{
+		Port:     getEnv("PORT", "8080"),
+		LogLevel: getEnv("LOG_LEVEL", "info"),
+
+		// The images of a batch are all held in memory while processed, so
+		// the body limit stays small until they are processed one by one.
+		MaxBodyBytes:         getEnvInt64("MAX_BODY_BYTES", 64<<20),
+		UploadSpoolThreshold: getEnvInt64("UPLOAD_SPOOL_THRESHOLD", 4<<20),
+		UploadMaxValueBytes:  getEnvInt64("UPLOAD_MAX_VALUE_BYTES", 1<<20),
+		UploadMaxParts:       int(getEnvInt64("UPLOAD_MAX_PARTS", 1000)),
+		UploadTempDir:        os.Getenv("UPLOAD_TEMP_DIR"),
+
+		ProcessTimeout: getEnvDuration("PROCESS_TIMEOUT", time.Minute),
+		ImageTimeout:   getEnvDuration("IMAGE_TIMEOUT", 15*time.Second),
+
+		ImageBackend: os.Getenv("IMAGE_BACKEND"),
+
+		WorkerCount:     int(getEnvInt64("WORKER_COUNT", int64(runtime.NumCPU()))),
+		WorkerQueueSize: int(getEnvInt64("WORKER_QUEUE_SIZE", 64)),
+
+		DrainDelay:   getEnvDuration("DRAIN_DELAY", 0),
+		DrainTimeout: getEnvDuration("DRAIN_TIMEOUT", 30*time.Second),
+
+		CacheBackend:  getEnv("CACHE_BACKEND", CacheBackendMemory),
+		CacheDir:      getEnv("CACHE_DIR", filepath.Join(os.TempDir(), "image-processing-cache")),
+		CacheMaxBytes: getEnvInt64("CACHE_MAX_BYTES", 64<<20),
+		CacheTTL:      getEnvDuration("CACHE_TTL", 24*time.Hour),
+
+		StorageDriver:      getEnv("STORAGE_DRIVER", StorageDriverNone),
+		StorageLocalDir:    getEnv("STORAGE_LOCAL_DIR", "storage-data"),
+		StorageLocalSecret: os.Getenv("STORAGE_LOCAL_SECRET"),
+		StoragePublicURL:   getEnv("STORAGE_PUBLIC_URL", "http://localhost:"+getEnv("PORT", "8080")),
+		StoragePresignTTL:  getEnvDuration("STORAGE_PRESIGN_TTL", time.Hour),
+
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          os.Getenv("S3_BUCKET"),
+		S3AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3UsePathStyle:    getEnvBool("S3_USE_PATH_STYLE", false),
+
+		FetchAllowedHosts:         getEnvList("FETCH_ALLOWED_HOSTS"),
+		FetchAllowPrivateNetworks: getEnvBool("FETCH_ALLOW_PRIVATE_NETWORKS", false),
+		FetchMaxBytes:             getEnvInt64("FETCH_MAX_BYTES", 10<<20),
+		FetchTimeout:              getEnvDuration("FETCH_TIMEOUT", 10*time.Second),
+		FetchMaxRedirects:         int(getEnvInt64("FETCH_MAX_REDIRECTS", 3)),
+
+		ArchiveMaxEntries:    int(getEnvInt64("ARCHIVE_MAX_ENTRIES", 1000)),
+		ArchiveMaxTotalBytes: getEnvInt64("ARCHIVE_MAX_TOTAL_BYTES", 256<<20),
+		ArchiveMaxRatio:      getEnvFloat64("ARCHIVE_MAX_RATIO", 100),
+
+		TusDir:     getEnv("TUS_DIR", filepath.Join(os.TempDir(), "image-processing-uploads")),
+		TusMaxSize: getEnvInt64("TUS_MAX_SIZE", 1<<30),
+		TusExpiry:  getEnvDuration("TUS_EXPIRY", 24*time.Hour),
+
+		APIKeys:                  getEnvList("API_KEYS"),
+		APIKeysFile:              os.Getenv("API_KEYS_FILE"),
+		RateLimitRequests:        getEnvFloat64("RATE_LIMIT_REQUESTS", 10),
+		RateLimitBurst:           int(getEnvInt64("RATE_LIMIT_BURST", 20)),
+		RateLimitMegapixels:      getEnvFloat64("RATE_LIMIT_MEGAPIXELS", 20),
+		RateLimitMegapixelsBurst: getEnvFloat64("RATE_LIMIT_MEGAPIXELS_BURST", 200),
+		DailyQuota:               getEnvInt64("DAILY_QUOTA", 0),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// getEnvList splits a comma separated variable, dropping empty items.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func getEnvInt64(key string, fallback int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return v
+}
+
+func getEnvFloat64(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+
+	return v
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return v
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return v
+}
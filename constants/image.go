@@ -3,4 +3,24 @@ package constants
 const (
 	ContentTypeImagePng  = "image/png"
 	ContentTypeImageJpeg = "image/jpeg"
+	ContentTypeImageGif  = "image/gif"
+	ContentTypeImageTiff = "image/tiff"
+	ContentTypeImageBmp  = "image/bmp"
+	ContentTypeImageAvif = "image/avif"
+	ContentTypeImageWebp = "image/webp"
 )
+
+const (
+	ContentTypeApplicationZip  = "application/zip"
+	ContentTypeApplicationJson = "application/json"
+)
+
+const (
+	OutputZip     = "zip"
+	OutputJson    = "json"
+	OutputStorage = "storage"
+)
+
+// MaxImageDimension is the largest width or height accepted, for source
+// images as well as resize targets.
+const MaxImageDimension = 16384
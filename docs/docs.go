@@ -0,0 +1,18 @@
+// Package docs embeds the OpenAPI specification of the API, which is kept
+// in sync with the routes by the handler tests, and a Swagger UI page
+// rendering it.
+package docs
+
+import "embed"
+
+//go:embed openapi.json
+var OpenAPI []byte
+
+//go:embed swagger-ui.html
+var SwaggerUI []byte
+
+// SwaggerUIAssets holds the vendored swagger-ui-dist files the page loads,
+// under swagger-ui/.
+//
+//go:embed swagger-ui
+var SwaggerUIAssets embed.FS
@@ -3,21 +3,83 @@ package dto
 import (
 	"fmt"
 	"mime/multipart"
+
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/constants"
 )
 
 type ImageData struct {
 	Filename    string
 	ContentType string
 	ImageBytes  []byte
+	// AutoFormat is the encoding chosen by the auto format, when it was
+	// asked for.
+	AutoFormat *AutoFormat
+	// Quality compares lossy outputs to the image they were encoded from.
+	Quality *ImageQuality
 }
 
+// FilesRequest lists the source images, uploaded as files[] parts, embedded
+// as base64 images in a JSON body, given as urls to download, referenced by
+// the ID of a completed resumable upload and/or packed in an uploaded
+// archive. They are processed in that order.
 type FilesRequest struct {
-	Files []*multipart.FileHeader `form:"files[]"`
+	Files     []File        `form:"-" json:"-"`
+	Images    []Base64Image `form:"-" json:"images"`
+	URLs      []string      `form:"urls[]" json:"urls"`
+	UploadIDs []string      `form:"upload_ids[]" json:"upload_ids"`
+	// Archive is a zip or tar file whose entries are processed after all
+	// other sources, keeping their paths.
+	Archive File `form:"-" json:"-"`
+}
+
+// File is an uploaded file, whose content may be held in memory or on disk.
+type File interface {
+	Name() string
+	Size() int64
+	Open() (multipart.File, error)
+}
+
+// FileHeader adapts a file parsed by mime/multipart to File.
+type FileHeader struct {
+	Header *multipart.FileHeader
+}
+
+func (f FileHeader) Name() string {
+	return f.Header.Filename
+}
+
+func (f FileHeader) Size() int64 {
+	return f.Header.Size
+}
+
+func (f FileHeader) Open() (multipart.File, error) {
+	return f.Header.Open()
+}
+
+type Base64Image struct {
+	Filename string `json:"filename"`
+	Data     []byte `json:"data"`
+}
+
+// Len counts the source images known before extracting the archive.
+func (r FilesRequest) Len() int {
+	return len(r.Files) + len(r.Images) + len(r.URLs) + len(r.UploadIDs)
 }
 
 func (r FilesRequest) Validate() error {
-	if len(r.Files) == 0 {
-		return fmt.Errorf("files[] cannot be enmpy")
+	if r.Len() == 0 && r.Archive == nil {
+		return apperror.New(apperror.CodeInvalidRequest, "files[], images, urls, upload_ids or archive cannot be empty").
+			WithField("files[]")
+	}
+
+	for i, image := range r.Images {
+		if image.Filename == "" {
+			return apperror.WithFile(
+				apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("images[%d].filename cannot be empty", i)),
+				"images", i, "",
+			)
+		}
 	}
 
 	return nil
@@ -25,6 +87,7 @@ func (r FilesRequest) Validate() error {
 
 type FilesResizeRequest struct {
 	ResizeRequest
+	EncodeRequest
 	FilesRequest
 }
 
@@ -34,31 +97,442 @@ func (r FilesResizeRequest) Validate() error {
 		return err
 	}
 
-	if len(r.Files) != len(r.Height) || len(r.Files) != len(r.Width) {
-		return fmt.Errorf("len of files and resize param must be the same")
+	if len(r.Height) != len(r.Width) {
+		return apperror.New(apperror.CodeInvalidRequest, "len of height and width must be the same").
+			WithField("width[]")
+	}
+
+	if err := r.FilesRequest.validateParamLen(len(r.Height), "resize", "height[]"); err != nil {
+		return err
+	}
+
+	if err := r.EncodeRequest.Validate(); err != nil {
+		return err
 	}
 
 	return r.ResizeRequest.Validate()
 }
 
+// validateParamLen checks that a parameter, given n times, is given once
+// per image or once for all of them, which is the only option when the
+// number of images is only known after extracting an archive.
+func (r FilesRequest) validateParamLen(n int, param, field string) error {
+	if n != 1 && (r.Archive != nil || r.Len() != n) {
+		return apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("len of files and %s param must be the same", param)).
+			WithField(field)
+	}
+
+	return nil
+}
+
 type ImageDataResize struct {
 	ResizeRequest
+	EncodeRequest
 	ImageDatas []ImageData
 }
 
+type FilesEncodeRequest struct {
+	EncodeRequest
+	FilesRequest
+}
+
+func (r FilesEncodeRequest) Validate() error {
+	err := r.FilesRequest.Validate()
+	if err != nil {
+		return err
+	}
+
+	return r.EncodeRequest.Validate()
+}
+
+type ImageDataEncode struct {
+	EncodeRequest
+	ImageDatas []ImageData
+}
+
+// EncodeRequest overrides the output of an operation. Format replaces the
+// format the operation encodes to, Quality applies to jpeg, webp and avif
+// outputs and Speed to avif ones. Zero values keep the defaults of the
+// operation.
+//
+// The auto format picks the smallest encoding of every image, and its
+// quality, among the formats of Accept, the image types the client takes,
+// that the backend encodes. Jpeg and png are always accepted.
+type EncodeRequest struct {
+	Format  string `form:"format" json:"format,omitempty"`
+	Quality int    `form:"quality" json:"quality,omitempty"`
+	Speed   int    `form:"speed" json:"speed,omitempty"`
+	// SSIM, instead of a quality, asks jpeg and webp outputs for the lowest
+	// quality keeping at least this structural similarity to the image. With
+	// the auto format, it replaces the SSIM kept by lossy formats.
+	SSIM float64 `form:"ssim" json:"ssim,omitempty"`
+	// Score asks for the PSNR and SSIM of lossy outputs in the report,
+	// which costs a decode and a comparison per image.
+	Score  bool     `form:"score" json:"score,omitempty"`
+	Accept []string `form:"-" json:"accept,omitempty"`
+}
+
+const (
+	EncodeFormatJpeg = "jpeg"
+	EncodeFormatPng  = "png"
+	EncodeFormatWebp = "webp"
+	EncodeFormatAvif = "avif"
+	EncodeFormatAuto = "auto"
+)
+
+// encodeFormats are the content types of the formats, by name. Auto has
+// none.
+var encodeFormats = map[string]string{
+	EncodeFormatJpeg: constants.ContentTypeImageJpeg,
+	EncodeFormatPng:  constants.ContentTypeImagePng,
+	EncodeFormatWebp: constants.ContentTypeImageWebp,
+	EncodeFormatAvif: constants.ContentTypeImageAvif,
+	EncodeFormatAuto: "",
+}
+
+// ContentType is the content type of Format, empty without one or with
+// auto.
+func (r EncodeRequest) ContentType() string {
+	return encodeFormats[r.Format]
+}
+
+func (r EncodeRequest) Validate() error {
+	if _, ok := encodeFormats[r.Format]; r.Format != "" && !ok {
+		return apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("unknown format %q, use jpeg, png, webp, avif or auto", r.Format)).
+			WithField("format")
+	}
+
+	if r.Quality < 0 || r.Quality > 100 {
+		return apperror.New(apperror.CodeInvalidRequest, "quality must be from 1 to 100").WithField("quality")
+	}
+
+	if r.Speed < 0 || r.Speed > 10 {
+		return apperror.New(apperror.CodeInvalidRequest, "speed must be from 1, the slowest, to 10").WithField("speed")
+	}
+
+	if r.SSIM < 0 || r.SSIM > 1 {
+		return apperror.New(apperror.CodeInvalidRequest, "ssim must be from 0 to 1").WithField("ssim")
+	}
+	if r.SSIM > 0 && r.Quality > 0 {
+		return apperror.New(apperror.CodeInvalidRequest, "ssim and quality cannot be both set").WithField("ssim")
+	}
+	if r.SSIM > 0 && (r.Format == EncodeFormatPng || r.Format == EncodeFormatAvif) {
+		return apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("ssim only applies to jpeg, webp and auto, not %s", r.Format)).
+			WithField("ssim")
+	}
+
+	return nil
+}
+
+// Capabilities are the formats, as content types, an image processing
+// service decodes and encodes.
+type Capabilities struct {
+	Decode []string `json:"decode"`
+	Encode []string `json:"encode"`
+}
+
 type ResizeRequest struct {
-	Height []int `form:"height[]"`
-	Width  []int `form:"width[]"`
+	Height []int `form:"height[]" json:"height"`
+	Width  []int `form:"width[]" json:"width"`
+}
+
+// At returns the height and width pair of the image at index i, the single
+// pair when it applies to every image.
+func (r ResizeRequest) At(i int) ResizeRequest {
+	if len(r.Height) == 1 {
+		return r
+	}
+
+	return ResizeRequest{Height: r.Height[i : i+1], Width: r.Width[i : i+1]}
 }
 
 func (r ResizeRequest) Validate() error {
-	for _, v := range append(r.Height, r.Width...) {
-		if v > 0 {
-			continue
+	fields := []struct {
+		name   string
+		values []int
+	}{{"height[]", r.Height}, {"width[]", r.Width}}
+
+	for _, field := range fields {
+		for i, v := range field.values {
+			if v <= 0 {
+				return apperror.WithFile(
+					apperror.New(apperror.CodeInvalidRequest, "height and width must be large than zero"), field.name, i, "",
+				)
+			}
+
+			if v > constants.MaxImageDimension {
+				return apperror.WithFile(apperror.New(
+					apperror.CodeDimensionTooLarge,
+					fmt.Sprintf("height and width must not exceed %d", constants.MaxImageDimension),
+				), field.name, i, "")
+			}
 		}
+	}
 
-		return fmt.Errorf("height and width must be large than zero")
+	return nil
+}
+
+type FilesCropRequest struct {
+	CropRequest
+	FilesRequest
+}
+
+func (r FilesCropRequest) Validate() error {
+	err := r.FilesRequest.Validate()
+	if err != nil {
+		return err
+	}
+
+	n := len(r.X)
+	for _, field := range []struct {
+		name   string
+		values []int
+	}{{"y[]", r.Y}, {"width[]", r.Width}, {"height[]", r.Height}} {
+		if len(field.values) != n {
+			return apperror.New(apperror.CodeInvalidRequest, "len of x, y, width and height must be the same").
+				WithField(field.name)
+		}
+	}
+
+	if err := r.FilesRequest.validateParamLen(n, "crop", "x[]"); err != nil {
+		return err
+	}
+
+	return r.CropRequest.Validate()
+}
+
+type ImageDataCrop struct {
+	CropRequest
+	ImageDatas []ImageData
+}
+
+// CropRequest is the rectangle kept of each image, from its top left corner
+// at x and y. Rectangles reaching out of an image are cut at its edges.
+type CropRequest struct {
+	X      []int `form:"x[]" json:"x"`
+	Y      []int `form:"y[]" json:"y"`
+	Width  []int `form:"width[]" json:"width"`
+	Height []int `form:"height[]" json:"height"`
+}
+
+// At returns the rectangle of the image at index i, the single rectangle
+// when it applies to every image.
+func (r CropRequest) At(i int) CropRequest {
+	if len(r.X) == 1 {
+		return r
+	}
+
+	return CropRequest{X: r.X[i : i+1], Y: r.Y[i : i+1], Width: r.Width[i : i+1], Height: r.Height[i : i+1]}
+}
+
+func (r CropRequest) Validate() error {
+	for _, field := range []struct {
+		name   string
+		values []int
+	}{{"x[]", r.X}, {"y[]", r.Y}} {
+		for i, v := range field.values {
+			if v < 0 || v >= constants.MaxImageDimension {
+				return apperror.WithFile(apperror.New(
+					apperror.CodeInvalidRequest,
+					fmt.Sprintf("x and y must be from 0 to %d", constants.MaxImageDimension-1),
+				), field.name, i, "")
+			}
+		}
+	}
+
+	return ResizeRequest{Height: r.Height, Width: r.Width}.Validate()
+}
+
+type FilesFramesRequest struct {
+	FramesRequest
+	FilesRequest
+}
+
+func (r FilesFramesRequest) Validate() error {
+	err := r.FilesRequest.Validate()
+	if err != nil {
+		return err
+	}
+
+	return r.FramesRequest.Validate()
+}
+
+type ImageDataFrames struct {
+	FramesRequest
+	ImageDatas []ImageData
+}
+
+// FramesRequest picks the frames exported of animated images and their
+// format, png or jpeg. Without a Frame, every frame is exported.
+type FramesRequest struct {
+	Format string `form:"format" json:"format,omitempty"`
+	Frame  *int   `form:"frame" json:"frame"`
+}
+
+// ContentType is the content type of the exported frames.
+func (r FramesRequest) ContentType() string {
+	if r.Format == FrameFormatJpeg {
+		return constants.ContentTypeImageJpeg
+	}
+
+	return constants.ContentTypeImagePng
+}
+
+const (
+	FrameFormatPng  = "png"
+	FrameFormatJpeg = "jpeg"
+)
+
+func (r FramesRequest) Validate() error {
+	if r.Format != "" && r.Format != FrameFormatPng && r.Format != FrameFormatJpeg {
+		return apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("unknown format %q, use png or jpeg", r.Format)).
+			WithField("format")
+	}
+
+	if r.Frame != nil && *r.Frame < 0 {
+		return apperror.New(apperror.CodeInvalidRequest, "frame must not be negative").WithField("frame")
 	}
 
 	return nil
 }
+
+type FilesPagesRequest struct {
+	PagesRequest
+	FilesRequest
+}
+
+func (r FilesPagesRequest) Validate() error {
+	err := r.FilesRequest.Validate()
+	if err != nil {
+		return err
+	}
+
+	return r.PagesRequest.Validate()
+}
+
+type ImageDataPages struct {
+	PagesRequest
+	ImageDatas []ImageData
+}
+
+// PagesRequest is the format of the pages split from multi-page images, png
+// or jpeg like frames.
+type PagesRequest struct {
+	Format string `form:"format" json:"format,omitempty"`
+}
+
+// ContentType is the content type of the split pages.
+func (r PagesRequest) ContentType() string {
+	return FramesRequest{Format: r.Format}.ContentType()
+}
+
+func (r PagesRequest) Validate() error {
+	return FramesRequest{Format: r.Format}.Validate()
+}
+
+type StoredImage struct {
+	Filename string `json:"filename"`
+	Key      string `json:"key"`
+	URL      string `json:"url"`
+}
+
+type StoredImagesResponse struct {
+	Objects []StoredImage `json:"objects"`
+	Report
+}
+
+type ImageResponse struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Data        []byte `json:"data"`
+}
+
+type ImagesResponse struct {
+	Images []ImageResponse `json:"images"`
+	Report
+}
+
+// ErrorResponse is the body of every error response. FileIndex is the index
+// of the file in Field, or in the processed batch when Field is empty.
+type ErrorResponse struct {
+	Error     string    `json:"error"`
+	Code      string    `json:"code"`
+	Field     string    `json:"field,omitempty"`
+	FileIndex *int      `json:"file_index,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Progress  *Progress `json:"progress,omitempty"`
+}
+
+// Progress tells how far an interrupted operation went.
+type Progress struct {
+	Operation string `json:"operation"`
+	Processed int    `json:"processed"`
+	Total     int    `json:"total"`
+	Filename  string `json:"filename"`
+}
+
+type SkippedFile struct {
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+}
+
+// AutoFormat is the encoding the auto format chose for an image.
+type AutoFormat struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	// Quality is the encoder quality, zero for lossless formats.
+	Quality int `json:"quality,omitempty"`
+	// SSIM is the structural similarity of the output to the image
+	// encoded, 1 for lossless formats.
+	SSIM        float64 `json:"ssim"`
+	InputBytes  int     `json:"input_bytes"`
+	OutputBytes int     `json:"output_bytes"`
+	// Savings is the share of the input bytes saved, negative when the
+	// output is larger.
+	Savings float64 `json:"savings"`
+}
+
+// ImageQuality compares an image to a reference, the image a lossy output
+// was encoded from, after any resize.
+type ImageQuality struct {
+	Filename string `json:"filename"`
+	// Quality is the encoder quality chosen for an SSIM target, or by the
+	// auto format.
+	Quality int `json:"quality,omitempty"`
+	// PSNR is the peak signal-to-noise ratio of the luma, in dB, 100 for
+	// identical images.
+	PSNR float64 `json:"psnr"`
+	// SSIM is the structural similarity of the luma, 1 for identical
+	// images.
+	SSIM float64 `json:"ssim"`
+}
+
+// Report describes the outcome of a request beyond the output images. It is
+// returned as report.json in zip responses and inline otherwise.
+type Report struct {
+	Skipped     []SkippedFile  `json:"skipped,omitempty"`
+	AutoFormats []AutoFormat   `json:"auto_formats,omitempty"`
+	Quality     []ImageQuality `json:"quality,omitempty"`
+}
+
+func (r Report) Empty() bool {
+	return len(r.Skipped) == 0 && len(r.AutoFormats) == 0 && len(r.Quality) == 0
+}
+
+// CompareResponse scores Image against Reference. Image is resized to the
+// width and height of Reference first when they differ. Report lists the
+// files skipped to find them.
+type CompareResponse struct {
+	Reference string  `json:"reference"`
+	Image     string  `json:"image"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Resized   bool    `json:"resized"`
+	PSNR      float64 `json:"psnr"`
+	SSIM      float64 `json:"ssim"`
+	Report
+}
@@ -0,0 +1,248 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid url, only absolute http and https urls are allowed")
+	ErrHostNotAllowed    = errors.New("host is not in the allowlist")
+	ErrAddressNotAllowed = errors.New("host resolves to a non-public address")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrTooLarge          = errors.New("remote file is too large")
+	// ErrUpstream wraps failures of the remote server itself, as opposed to
+	// requests rejected by policy.
+	ErrUpstream = errors.New("failed to fetch remote file")
+)
+
+// nonPublicPrefixes complements the netip.Addr predicates with ranges that
+// are not routable on the public internet.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+type Fetcher struct {
+	allowedHosts []string
+	allowPrivate bool
+	maxBytes     int64
+	maxRedirects int
+	client       *http.Client
+}
+
+func New(cfg config.Config) *Fetcher {
+	f := &Fetcher{
+		allowedHosts: cfg.FetchAllowedHosts,
+		allowPrivate: cfg.FetchAllowPrivateNetworks,
+		maxBytes:     cfg.FetchMaxBytes,
+		maxRedirects: cfg.FetchMaxRedirects,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.FetchTimeout,
+		// Checking the address at connect time, after DNS resolution, also
+		// covers hostnames that are re-pointed between check and use.
+		Control: f.checkConn,
+	}
+
+	f.client = &http.Client{
+		Timeout: cfg.FetchTimeout,
+		Transport: &http.Transport{
+			// A proxy would make the dialer see the proxy's address instead
+			// of the target's.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.FetchTimeout,
+			ResponseHeaderTimeout: cfg.FetchTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: f.checkRedirect,
+	}
+
+	return f
+}
+
+// Open downloads rawURL and returns a name for the file together with its
+// body, which fails with ErrTooLarge once more than the configured maximum
+// has been read. The caller must close the body.
+func (f *Fetcher) Open(ctx context.Context, rawURL string) (string, io.ReadCloser, error) {
+	u, err := f.checkURL(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, ErrInvalidURL
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		for _, policyErr := range []error{ErrInvalidURL, ErrHostNotAllowed, ErrAddressNotAllowed, ErrTooManyRedirects} {
+			if errors.Is(err, policyErr) {
+				return "", nil, fmt.Errorf("%w: %s", policyErr, rawURL)
+			}
+		}
+
+		return "", nil, fmt.Errorf("%w: %s: %v", ErrUpstream, rawURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("%w: %s: status %d", ErrUpstream, rawURL, resp.StatusCode)
+	}
+
+	if f.maxBytes > 0 && resp.ContentLength > f.maxBytes {
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("%w: %s", ErrTooLarge, rawURL)
+	}
+
+	if f.maxBytes <= 0 {
+		return filename(resp.Request.URL), resp.Body, nil
+	}
+
+	return filename(resp.Request.URL), &limitedBody{ReadCloser: resp.Body, remaining: f.maxBytes}, nil
+}
+
+func filename(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return "image"
+	}
+
+	return name
+}
+
+func (f *Fetcher) checkURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return nil, ErrInvalidURL
+	}
+
+	if !f.hostAllowed(u.Hostname()) {
+		return nil, ErrHostNotAllowed
+	}
+
+	return u, nil
+}
+
+// hostAllowed matches host against the allowlist, where "*.example.com"
+// matches any subdomain of example.com. An empty allowlist allows any host.
+func (f *Fetcher) hostAllowed(host string) bool {
+	if len(f.allowedHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range f.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+
+			continue
+		}
+
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.maxRedirects {
+		return ErrTooManyRedirects
+	}
+
+	_, err := f.checkURL(req.URL.String())
+	return err
+}
+
+func (f *Fetcher) checkConn(_, address string, _ syscall.RawConn) error {
+	if f.allowPrivate {
+		return nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return ErrAddressNotAllowed
+	}
+
+	if !isPublic(addrPort.Addr()) {
+		return ErrAddressNotAllowed
+	}
+
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// limitedBody reads through to the remote body until more than remaining
+// bytes have been seen, in the manner of http.MaxBytesReader.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrTooLarge
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Ask for one byte more than allowed to tell a body of exactly the
+	// limit apart from a longer one.
+	if int64(len(p))-1 > b.remaining {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		return n, err
+	}
+
+	n = int(b.remaining)
+	b.remaining = 0
+	b.exceeded = true
+	return n, ErrTooLarge
+}
@@ -0,0 +1,155 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+func TestFetcher_Open(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cat.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 16))
+	})
+	mux.HandleFunc("/big.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 17))
+	})
+	mux.HandleFunc("/missing.jpg", http.NotFound)
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cat.jpg", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect-twice", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := config.Config{
+		FetchAllowPrivateNetworks: true,
+		FetchMaxBytes:             16,
+		FetchTimeout:              time.Second,
+		FetchMaxRedirects:         1,
+	}
+
+	tests := []struct {
+		name         string
+		cfg          func(cfg config.Config) config.Config
+		url          string
+		wantFilename string
+		wantErr      error
+	}{
+		{
+			name:         "success",
+			url:          server.URL + "/cat.jpg",
+			wantFilename: "cat.jpg",
+		},
+		{
+			name:         "success after redirect",
+			url:          server.URL + "/redirect",
+			wantFilename: "cat.jpg",
+		},
+		{
+			name:    "too many redirects",
+			url:     server.URL + "/redirect-twice",
+			wantErr: ErrTooManyRedirects,
+		},
+		{
+			name:    "larger than limit",
+			url:     server.URL + "/big.jpg",
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "remote error",
+			url:     server.URL + "/missing.jpg",
+			wantErr: ErrUpstream,
+		},
+		{
+			name:    "unsupported scheme",
+			url:     "file:///etc/passwd",
+			wantErr: ErrInvalidURL,
+		},
+		{
+			name: "private network blocked",
+			cfg: func(cfg config.Config) config.Config {
+				cfg.FetchAllowPrivateNetworks = false
+				return cfg
+			},
+			url:     server.URL + "/cat.jpg",
+			wantErr: ErrAddressNotAllowed,
+		},
+		{
+			name: "host not in allowlist",
+			cfg: func(cfg config.Config) config.Config {
+				cfg.FetchAllowedHosts = []string{"*.example.com"}
+				return cfg
+			},
+			url:     server.URL + "/cat.jpg",
+			wantErr: ErrHostNotAllowed,
+		},
+		{
+			name: "host in allowlist",
+			cfg: func(cfg config.Config) config.Config {
+				cfg.FetchAllowedHosts = []string{"127.0.0.1"}
+				return cfg
+			},
+			url:          server.URL + "/cat.jpg",
+			wantFilename: "cat.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCfg := cfg
+			if tt.cfg != nil {
+				testCfg = tt.cfg(cfg)
+			}
+
+			filename, body, err := New(testCfg).Open(context.Background(), tt.url)
+			if err == nil {
+				_, err = io.ReadAll(body)
+				body.Close()
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fetcher.Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantFilename, filename)
+		})
+	}
+}
+
+func Test_isPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "169.254.169.254"},
+		{addr: "100.64.0.1"},
+		{addr: "0.0.0.0"},
+		{addr: "::1"},
+		{addr: "fd00::1"},
+		{addr: "fe80::1"},
+		{addr: "::ffff:127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, isPublic(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
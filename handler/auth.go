@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/apikey"
+	"github.com/rizqo46/image-processing-go/ratelimit"
+)
+
+const (
+	HeaderAPIKey = "X-API-Key"
+
+	// contextKeyAPIKey is the gin context key of the name of the owner of
+	// the API key of the request.
+	contextKeyAPIKey = "api_key"
+)
+
+// authHandler authenticates requests with their API key and applies the
+// rate limits and quota of the key.
+type authHandler struct {
+	keys    *apikey.Store
+	limiter *ratelimit.Limiter
+}
+
+func NewAuthHandler(keys *apikey.Store, limiter *ratelimit.Limiter) authHandler {
+	return authHandler{keys: keys, limiter: limiter}
+}
+
+// Authenticate accepts the key in the X-API-Key header or as a bearer token.
+func (h *authHandler) Authenticate(c *gin.Context) {
+	key := c.GetHeader(HeaderAPIKey)
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && key == "" {
+		key = strings.TrimSpace(token)
+	}
+
+	name, err := h.keys.Authenticate(key)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer realm="image-processing"`)
+		respondError(c, err)
+		c.Abort()
+		return
+	}
+	c.Set(contextKeyAPIKey, name)
+
+	result, err := h.limiter.Allow(name)
+	setRateLimitHeaders(c, result)
+	if err != nil {
+		respondError(c, err)
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+func setRateLimitHeaders(c *gin.Context, result ratelimit.Result) {
+	setLimitHeaders(c, "X-RateLimit-", result.Requests)
+	setLimitHeaders(c, "X-RateLimit-Daily-", result.Daily)
+}
+
+func setLimitHeaders(c *gin.Context, prefix string, status ratelimit.Status) {
+	if status.Limit == 0 {
+		return
+	}
+
+	c.Header(prefix+"Limit", strconv.FormatInt(status.Limit, 10))
+	c.Header(prefix+"Remaining", strconv.FormatInt(status.Remaining, 10))
+	c.Header(prefix+"Reset", strconv.FormatInt(int64(math.Ceil(status.Reset.Seconds())), 10))
+}
+
+// setRetryAfter tells clients refused by a rate limit or quota when to
+// retry.
+func setRetryAfter(c *gin.Context, limitErr *ratelimit.LimitError) {
+	seconds := int64(math.Ceil(limitErr.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(max(1, seconds), 10))
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apikey"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+func Test_authHandler_Authenticate(t *testing.T) {
+	keys := []string{"team-a:" + apikey.HashKey("secret-a")}
+
+	type response struct {
+		status  int
+		code    string
+		headers map[string]string
+	}
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		headers map[string]string
+		want    []response
+	}{
+		{
+			name: "missing key",
+			cfg:  config.Config{APIKeys: keys},
+			want: []response{{
+				status:  http.StatusUnauthorized,
+				code:    "UNAUTHORIZED",
+				headers: map[string]string{"WWW-Authenticate": `Bearer realm="image-processing"`},
+			}},
+		},
+		{
+			name:    "invalid key",
+			cfg:     config.Config{APIKeys: keys},
+			headers: map[string]string{HeaderAPIKey: "secret-b"},
+			want:    []response{{status: http.StatusUnauthorized, code: "UNAUTHORIZED"}},
+		},
+		{
+			name:    "request rate",
+			cfg:     config.Config{APIKeys: keys, RateLimitRequests: 0.001, RateLimitBurst: 2},
+			headers: map[string]string{HeaderAPIKey: "secret-a"},
+			want: []response{
+				{status: http.StatusCreated, headers: map[string]string{"X-RateLimit-Limit": "2", "X-RateLimit-Remaining": "1"}},
+				{status: http.StatusCreated, headers: map[string]string{"X-RateLimit-Limit": "2", "X-RateLimit-Remaining": "0"}},
+				{status: http.StatusTooManyRequests, code: "RATE_LIMITED", headers: map[string]string{"X-RateLimit-Remaining": "0", "Retry-After": "1000"}},
+			},
+		},
+		{
+			name:    "bearer token and daily quota",
+			cfg:     config.Config{APIKeys: keys, DailyQuota: 1},
+			headers: map[string]string{"Authorization": "Bearer secret-a"},
+			want: []response{
+				{status: http.StatusCreated, headers: map[string]string{
+					"X-RateLimit-Daily-Limit": "1", "X-RateLimit-Daily-Remaining": "0", "Cache-Control": "private, max-age=31536000",
+				}},
+				{status: http.StatusTooManyRequests, code: "QUOTA_EXCEEDED"},
+			},
+		},
+		{
+			name:    "megapixel rate",
+			cfg:     config.Config{APIKeys: keys, RateLimitMegapixels: 0.001, RateLimitMegapixelsBurst: 0.01},
+			headers: map[string]string{HeaderAPIKey: "secret-a"},
+			want: []response{
+				{status: http.StatusCreated},
+				{status: http.StatusTooManyRequests, code: "RATE_LIMITED", headers: map[string]string{"ETag": "", "Cache-Control": ""}},
+			},
+		},
+		{
+			name: "cached responses are not charged megapixels",
+			cfg: config.Config{
+				APIKeys: keys, RateLimitMegapixels: 0.001, RateLimitMegapixelsBurst: 0.01,
+				CacheBackend: config.CacheBackendMemory, CacheMaxBytes: 1 << 20,
+			},
+			headers: map[string]string{HeaderAPIKey: "secret-a"},
+			want: []response{
+				{status: http.StatusCreated, headers: map[string]string{"X-Cache": "MISS", "Cache-Control": "private, max-age=31536000"}},
+				{status: http.StatusCreated, headers: map[string]string{"X-Cache": "HIT", "Cache-Control": "private, max-age=31536000"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, tt.cfg)
+			for _, want := range tt.want {
+				req := httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/cat.jpg",
+				})
+				for header, value := range tt.headers {
+					req.Header.Set(header, value)
+				}
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				assert.Equal(t, want.status, w.Code)
+				for header, value := range want.headers {
+					assert.Equal(t, value, w.Header().Get(header))
+				}
+
+				if want.code != "" {
+					var resp dto.ErrorResponse
+					if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+						t.Fatal(err)
+					}
+					assert.Equal(t, want.code, resp.Code)
+				}
+			}
+
+			// Health checks stay open.
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
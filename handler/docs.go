@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/docs"
+)
+
+func OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, constants.ContentTypeApplicationJson, docs.OpenAPI)
+}
+
+func SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docs.SwaggerUI)
+}
+
+// SwaggerUIAsset serves the vendored files of the Swagger UI page.
+func SwaggerUIAsset(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("file"), "/")
+	data, err := fs.ReadFile(docs.SwaggerUIAssets, path.Join("swagger-ui", name))
+	if err != nil {
+		respondError(c, apperror.New(apperror.CodeNotFound, fmt.Sprintf("no swagger ui file %q", name)))
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/docs"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+func loadOpenAPI(t *testing.T) *openapi3.T {
+	doc, err := openapi3.NewLoader().LoadFromData(docs.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+// newDocsTestRouter enables every optional route.
+func newDocsTestRouter(t *testing.T) *gin.Engine {
+	return newTestRouter(t, config.Config{
+		StorageDriver:      config.StorageDriverLocal,
+		StorageLocalDir:    t.TempDir(),
+		StorageLocalSecret: "secret",
+		StoragePublicURL:   "http://localhost",
+		TusDir:             t.TempDir(),
+		TusExpiry:          time.Hour,
+	})
+}
+
+func Test_OpenAPI_Routes(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	var documented []string
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+	sort.Strings(documented)
+
+	router := newDocsTestRouter(t)
+	pathParam := regexp.MustCompile(`[:*](\w+)`)
+	var routes []string
+	for _, route := range router.Routes() {
+		routes = append(routes, route.Method+" "+pathParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+	sort.Strings(routes)
+
+	assert.Equal(t, routes, documented)
+}
+
+// formValueDecoder decodes the multipart values documented as integers,
+// which kin-openapi leaves as strings.
+func formValueDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn openapi3filter.EncodingFn) (any, error) {
+	value, err := openapi3filter.FileBodyDecoder(body, header, schema, encFn)
+	if err != nil || schema == nil || schema.Value == nil || schema.Value.Type != openapi3.TypeInteger {
+		return value, err
+	}
+
+	return strconv.ParseInt(value.(string), 10, 64)
+}
+
+func Test_OpenAPI_Responses(t *testing.T) {
+	for _, contentType := range []string{
+		constants.ContentTypeApplicationZip,
+		constants.ContentTypeImagePng,
+		constants.ContentTypeImageJpeg,
+		contentTypeOffsetOctetStream,
+		"text/html",
+	} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.FileBodyDecoder)
+	}
+	openapi3filter.RegisterBodyDecoder("text/plain", formValueDecoder)
+	defer openapi3filter.RegisterBodyDecoder("text/plain", openapi3filter.FileBodyDecoder)
+
+	doc := loadOpenAPI(t)
+	specRouter, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := newDocsTestRouter(t)
+
+	// serve validates req against the spec, serves it and validates the
+	// response.
+	serve := func(t *testing.T, req *http.Request) *httptest.ResponseRecorder {
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Object keys hold slashes, which path parameters can't match.
+		specReq := req
+		if key, ok := strings.CutPrefix(req.URL.Path, "/objects/"); ok {
+			specReq = req.Clone(req.Context())
+			specReq.URL.Path = "/objects/" + url.PathEscape(key)
+		}
+
+		route, pathParams, err := specRouter.FindRoute(specReq)
+		if err != nil {
+			t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+		}
+
+		requestInput := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(context.Background(), requestInput); err != nil {
+			t.Errorf("%s %s: invalid request: %v", req.Method, req.URL, err)
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: requestInput,
+			Status:                 w.Code,
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			t.Errorf("%s %s: invalid %d response: %v", req.Method, req.URL, w.Code, err)
+		}
+
+		return w
+	}
+
+	jsonRequest := func(path string, body any) *http.Request {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", constants.ContentTypeApplicationJson)
+		return req
+	}
+
+	flower, err := os.ReadFile(".././imagetest/flower.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		req        func() *http.Request
+		wantStatus int
+	}{
+		{
+			name: "multipart zip",
+			req: func() *http.Request {
+				return httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/cat.jpg",
+				})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "multipart resize json",
+			req: func() *http.Request {
+				return httpRequestWithFormData(t, http.MethodPost, "/?output=json",
+					formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"},
+					formData{label: "height[]", value: "10"},
+					formData{label: "width[]", value: "20"},
+				)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "json body",
+			req: func() *http.Request {
+				return jsonRequest("/png-to-jpeg?output=json", dto.FilesRequest{
+					Images: []dto.Base64Image{{Filename: "flower.png", Data: flower}},
+				})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "stored objects",
+			req: func() *http.Request {
+				return jsonRequest("/resize?output=storage", dto.FilesResizeRequest{
+					FilesRequest:  dto.FilesRequest{Images: []dto.Base64Image{{Filename: "flower.png", Data: flower}}},
+					ResizeRequest: dto.ResizeRequest{Height: []int{10}, Width: []int{10}},
+				})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "error",
+			req: func() *http.Request {
+				return jsonRequest("/compress", dto.FilesRequest{
+					Images: []dto.Base64Image{{Filename: "notes.txt", Data: []byte("notes")}},
+				})
+			},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "liveness",
+			req:        func() *http.Request { return httptest.NewRequest(http.MethodGet, "/healthz", nil) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "readiness",
+			req:        func() *http.Request { return httptest.NewRequest(http.MethodGet, "/readyz", nil) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "version",
+			req:        func() *http.Request { return httptest.NewRequest(http.MethodGet, "/version", nil) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "swagger ui",
+			req:        func() *http.Request { return httptest.NewRequest(http.MethodGet, "/docs", nil) },
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, tt.req())
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+
+	t.Run("stored object", func(t *testing.T) {
+		w := serve(t, jsonRequest("/compress?output=storage", dto.FilesRequest{
+			Images: []dto.Base64Image{{Filename: "flower.png", Data: flower}},
+		}))
+		var resp dto.StoredImagesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		objectURL, err := url.Parse(resp.Objects[0].URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = serve(t, httptest.NewRequest(http.MethodGet, objectURL.RequestURI(), nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("resumable upload", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/files", nil)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		req.Header.Set("Upload-Length", "5")
+		w := serve(t, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		location := w.Header().Get("Location")
+
+		req = httptest.NewRequest(http.MethodPatch, location, strings.NewReader("hello"))
+		req.Header.Set("Tus-Resumable", tusVersion)
+		req.Header.Set("Upload-Offset", "0")
+		req.Header.Set("Content-Type", contentTypeOffsetOctetStream)
+		w = serve(t, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		req = httptest.NewRequest(http.MethodHead, location, nil)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		w = serve(t, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+		req = httptest.NewRequest(http.MethodDelete, location, nil)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		w = serve(t, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+}
+
+func Test_SwaggerUI(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := w.Body.String()
+	// Everything is served by the application, nothing by a CDN.
+	assert.Equal(t, false, strings.Contains(page, "://"))
+
+	assets := regexp.MustCompile(`(?:src|href)="([^"]+)"`).FindAllStringSubmatch(page, -1)
+	assert.Equal(t, 2, len(assets))
+	for _, asset := range assets {
+		t.Run(asset[1], func(t *testing.T) {
+			if _, err := fs.Stat(docs.SwaggerUIAssets, path.Join("swagger-ui", path.Base(asset[1]))); err != nil {
+				t.Skip("swagger-ui-dist is not vendored, run make swagger-ui")
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+asset[1], nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/../openapi.json", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/apikey"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/archive"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/fetcher"
+	"github.com/rizqo46/image-processing-go/logging"
+	"github.com/rizqo46/image-processing-go/ratelimit"
+	"github.com/rizqo46/image-processing-go/storage"
+	"github.com/rizqo46/image-processing-go/tus"
+	"github.com/rizqo46/image-processing-go/upload"
+	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/worker"
+)
+
+// respondError writes the error response of err, with the status of its
+// code.
+func respondError(c *gin.Context, err error) {
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		setRetryAfter(c, limitErr)
+	}
+
+	resp := parseResponseError(c, err)
+	c.JSON(apperror.Code(resp.Code).Status(), resp)
+}
+
+// errorStatus is the status err is reported with.
+func errorStatus(err error) int {
+	return toAppError(err).Code.Status()
+}
+
+// parseResponseError records err on c for the access log and returns the
+// error body, which carries the request ID when there is one.
+func parseResponseError(c *gin.Context, err error) dto.ErrorResponse {
+	_ = c.Error(err)
+
+	appErr := toAppError(err)
+	resp := dto.ErrorResponse{
+		Error:     appErr.Error(),
+		Code:      string(appErr.Code),
+		Field:     appErr.Field,
+		FileIndex: appErr.FileIndex,
+		Filename:  appErr.Filename,
+		RequestID: logging.RequestID(c.Request.Context()),
+	}
+
+	var progressErr *usecase.ProgressError
+	if errors.As(err, &progressErr) {
+		resp.Progress = &dto.Progress{
+			Operation: progressErr.Operation,
+			Processed: progressErr.Processed,
+			Total:     progressErr.Total,
+			Filename:  progressErr.Filename,
+		}
+	}
+
+	return resp
+}
+
+// toAppError types err with the code of the first *apperror.Error of its
+// chain that has one, or after the sentinel error it wraps. The field and
+// file are taken from the outermost error setting them.
+func toAppError(err error) *apperror.Error {
+	typed := &apperror.Error{Err: err}
+	var appErr *apperror.Error
+	for e := err; errors.As(e, &appErr); e = appErr.Err {
+		if typed.Field == "" {
+			typed.Field = appErr.Field
+		}
+		if typed.FileIndex == nil {
+			typed.FileIndex = appErr.FileIndex
+		}
+		if typed.Filename == "" {
+			typed.Filename = appErr.Filename
+		}
+		if appErr.Code != "" {
+			typed.Code = appErr.Code
+			break
+		}
+	}
+
+	if typed.Code == "" {
+		typed.Code = errorCode(err)
+	}
+
+	var progressErr *usecase.ProgressError
+	if errors.As(err, &progressErr) && typed.FileIndex == nil {
+		typed.FileIndex = &progressErr.Processed
+		typed.Filename = progressErr.Filename
+	}
+
+	return typed
+}
+
+// errorCode maps the sentinel errors of the other packages to codes.
+func errorCode(err error) apperror.Code {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return apperror.CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return apperror.CodeCancelled
+	case errors.As(err, &maxBytesErr),
+		errors.Is(err, upload.ErrTooManyParts),
+		errors.Is(err, upload.ErrValueTooLarge),
+		errors.Is(err, fetcher.ErrTooLarge),
+		errors.Is(err, tus.ErrExceedsLength):
+		return apperror.CodeBodyTooLarge
+	case errors.Is(err, archive.ErrTooManyEntries),
+		errors.Is(err, archive.ErrTooLarge),
+		errors.Is(err, archive.ErrCompressionRatio):
+		return apperror.CodeArchiveLimitExceeded
+	case errors.Is(err, archive.ErrUnsupportedFormat),
+		errors.Is(err, usecase.ErrContentTypeNotAllowed):
+		return apperror.CodeUnsupportedType
+	case errors.Is(err, fetcher.ErrUpstream):
+		return apperror.CodeUpstreamFailed
+	case errors.Is(err, fetcher.ErrInvalidURL),
+		errors.Is(err, fetcher.ErrHostNotAllowed),
+		errors.Is(err, fetcher.ErrAddressNotAllowed),
+		errors.Is(err, fetcher.ErrTooManyRedirects):
+		return apperror.CodeURLNotAllowed
+	case errors.Is(err, tus.ErrNotFound),
+		errors.Is(err, storage.ErrNotFound):
+		return apperror.CodeNotFound
+	case errors.Is(err, tus.ErrIncomplete),
+		errors.Is(err, tus.ErrOffsetMismatch):
+		return apperror.CodeConflict
+	case errors.Is(err, apikey.ErrMissingKey),
+		errors.Is(err, apikey.ErrInvalidKey):
+		return apperror.CodeUnauthorized
+	case errors.Is(err, ratelimit.ErrRateLimited):
+		return apperror.CodeRateLimited
+	case errors.Is(err, ratelimit.ErrQuotaExceeded):
+		return apperror.CodeQuotaExceeded
+	case errors.Is(err, storage.ErrInvalidSignature):
+		return apperror.CodeForbidden
+	case errors.Is(err, storage.ErrInvalidKey),
+		errors.Is(err, ErrUploadsDisabled):
+		return apperror.CodeInvalidRequest
+	case errors.Is(err, worker.ErrQueueFull):
+		return apperror.CodeServerBusy
+	case errors.Is(err, usecase.ErrOpenFile),
+		errors.Is(err, usecase.ErrReadFile),
+		errors.Is(err, usecase.ErrDetectContentType):
+		return apperror.CodeReadFailed
+	default:
+		return apperror.CodeInternal
+	}
+}
+
+// invalidRequest types err as an invalid request unless it maps to a more
+// specific code.
+func invalidRequest(err error) error {
+	if err == nil || toAppError(err).Code != apperror.CodeInternal {
+		return err
+	}
+
+	return apperror.Wrap(apperror.CodeInvalidRequest, err)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/usecase"
+)
+
+func Test_toAppError(t *testing.T) {
+	index := 2
+
+	var tests = []struct {
+		name string
+		err  error
+		want apperror.Error
+	}{
+		{
+			name: "sentinel",
+			err:  fmt.Errorf("read: %w", usecase.ErrReadFile),
+			want: apperror.Error{Code: apperror.CodeReadFailed},
+		},
+		{
+			name: "app error wrapped with others",
+			err:  fmt.Errorf("%w: %w", usecase.ErrReadFile, apperror.New(apperror.CodeDimensionTooLarge, "too large")),
+			want: apperror.Error{Code: apperror.CodeDimensionTooLarge},
+		},
+		{
+			name: "file of the outer error, code of the inner one",
+			err: apperror.WithFile(
+				fmt.Errorf("%w: %w", usecase.ErrReadFile, apperror.New(apperror.CodeDimensionTooLarge, "too large")),
+				"files[]", index, "cat.jpg",
+			),
+			want: apperror.Error{Code: apperror.CodeDimensionTooLarge, Field: "files[]", FileIndex: &index, Filename: "cat.jpg"},
+		},
+		{
+			name: "unknown",
+			err:  errors.New("boom"),
+			want: apperror.Error{Code: apperror.CodeInternal},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toAppError(tt.err)
+			assert.Equal(t, tt.want.Code, got.Code)
+			assert.Equal(t, tt.want.Field, got.Field)
+			assert.Equal(t, tt.want.FileIndex, got.FileIndex)
+			assert.Equal(t, tt.want.Filename, got.Filename)
+		})
+	}
+}
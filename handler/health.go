@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/buildinfo"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/worker"
+)
+
+// healthHandler serves the liveness, readiness and version endpoints.
+type healthHandler struct {
+	backend      string
+	selfCheck    func() ([]string, error)
+	capabilities func() dto.Capabilities
+	pool         *worker.Pool
+}
+
+// NewHealthHandler reports the self-check of the image backend named
+// backend under its name.
+func NewHealthHandler(
+	backend string, selfCheck func() ([]string, error), capabilities func() dto.Capabilities, pool *worker.Pool,
+) healthHandler {
+	return healthHandler{backend: backend, selfCheck: selfCheck, capabilities: capabilities, pool: pool}
+}
+
+// Healthz only tells that the process serves requests.
+func (h *healthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz fails when the codecs don't work, when new requests would be
+// refused because every worker is busy and the queue is full, or once the
+// server is shutting down.
+func (h *healthHandler) Readyz(c *gin.Context) {
+	ready := true
+	checks := gin.H{}
+
+	if _, err := h.selfCheck(); err != nil {
+		ready = false
+		checks[h.backend] = err.Error()
+	} else {
+		checks[h.backend] = "ok"
+	}
+
+	if h.pool.Draining() {
+		ready = false
+		checks["workers"] = "draining"
+	} else if h.pool.Saturated() {
+		ready = false
+		checks["workers"] = "saturated"
+	} else {
+		checks["workers"] = "ok"
+	}
+
+	status, statusText := http.StatusOK, "ready"
+	if !ready {
+		status, statusText = http.StatusServiceUnavailable, "not ready"
+	}
+
+	c.JSON(status, gin.H{"status": statusText, "checks": checks, "pool": h.pool.Stats()})
+}
+
+type versionResponse struct {
+	buildinfo.Info
+	GocvVersion   string   `json:"gocv_version"`
+	OpenCVVersion string   `json:"opencv_version"`
+	Codecs        []string `json:"codecs"`
+	// Formats are the content types decoded and encoded by this build.
+	Formats dto.Capabilities `json:"formats"`
+}
+
+func (h *healthHandler) Version(c *gin.Context) {
+	resp := versionResponse{Info: buildinfo.Read()}
+	resp.GocvVersion, resp.OpenCVVersion = usecase.LibraryVersions()
+	resp.Codecs, _ = h.selfCheck()
+	if resp.Codecs == nil {
+		resp.Codecs = []string{}
+	}
+	resp.Formats = h.capabilities()
+
+	c.JSON(http.StatusOK, resp)
+}
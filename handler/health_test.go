@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/worker"
+)
+
+func Test_healthHandler(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var version versionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &version); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, "", version.Version)
+	assert.NotEqual(t, "", version.GoVersion)
+	// Builds with the purego tag leave OpenCV out.
+	gocvVersion, _ := usecase.LibraryVersions()
+	assert.Equal(t, gocvVersion, version.GocvVersion)
+	assert.Equal(t, []string{"png", "jpeg", "tiff", "bmp"}, version.Codecs)
+	// Webp and avif come last, with the OpenCV builds that have them.
+	assert.Equal(t, []string{"image/png", "image/jpeg", "image/gif", "image/tiff", "image/bmp"}, version.Formats.Encode[:5])
+}
+
+func Test_healthHandler_Readyz(t *testing.T) {
+	saturatedPool := func() *worker.Pool {
+		pool := worker.New(config.Config{WorkerCount: 1, WorkerQueueSize: 1})
+		release, err := pool.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go pool.Acquire(ctx)
+		for !pool.Saturated() {
+			time.Sleep(time.Millisecond)
+		}
+		return pool
+	}
+
+	selfCheckOK := func() ([]string, error) { return []string{"png", "jpeg"}, nil }
+
+	tests := []struct {
+		name       string
+		backend    string
+		selfCheck  func() ([]string, error)
+		pool       *worker.Pool
+		wantStatus int
+		wantChecks map[string]string
+	}{
+		{
+			name:       "ready",
+			backend:    "opencv",
+			selfCheck:  selfCheckOK,
+			pool:       worker.New(config.Config{}),
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"opencv": "ok", "workers": "ok"},
+		},
+		{
+			name:       "codecs failing",
+			backend:    "opencv",
+			selfCheck:  func() ([]string, error) { return nil, errors.New("png: encode failed") },
+			pool:       worker.New(config.Config{}),
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"opencv": "png: encode failed", "workers": "ok"},
+		},
+		{
+			name:      "draining",
+			backend:   "opencv",
+			selfCheck: selfCheckOK,
+			pool: func() *worker.Pool {
+				pool := worker.New(config.Config{})
+				pool.Drain()
+				return pool
+			}(),
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"opencv": "ok", "workers": "draining"},
+		},
+		{
+			name:       "workers saturated",
+			backend:    "opencv",
+			selfCheck:  selfCheckOK,
+			pool:       saturatedPool(),
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"opencv": "ok", "workers": "saturated"},
+		},
+		{
+			name:       "pure go backend",
+			backend:    "go",
+			selfCheck:  selfCheckOK,
+			pool:       worker.New(config.Config{}),
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"go": "ok", "workers": "ok"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(tt.backend, tt.selfCheck, nil, tt.pool)
+			router := gin.New()
+			router.GET("/readyz", h.Readyz)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var resp struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantChecks, resp.Checks)
+		})
+	}
+}
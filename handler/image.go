@@ -3,178 +3,1173 @@ package handler
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"mime"
 	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/archive"
+	"github.com/rizqo46/image-processing-go/cache"
+	"github.com/rizqo46/image-processing-go/config"
 	"github.com/rizqo46/image-processing-go/constants"
 	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/fetcher"
+	"github.com/rizqo46/image-processing-go/ratelimit"
+	"github.com/rizqo46/image-processing-go/storage"
+	"github.com/rizqo46/image-processing-go/tus"
+	"github.com/rizqo46/image-processing-go/upload"
 	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/worker"
 )
 
 type imageHandler struct {
-	imageUc usecase.ImageUsecase
+	imageUc        usecase.Service
+	cache          cache.Cache
+	cacheMaxBytes  int64
+	maxAge         int
+	storage        storage.Storage
+	presignTTL     time.Duration
+	fetcher        *fetcher.Fetcher
+	archive        *archive.Extractor
+	uploads        *tus.Store
+	uploadOptions  upload.Options
+	processTimeout time.Duration
+	pool           *worker.Pool
+	limiter        *ratelimit.Limiter
 }
 
-func NewImageHandler(imageUc usecase.ImageUsecase) imageHandler {
-	return imageHandler{imageUc: imageUc}
+func NewImageHandler(
+	imageUc usecase.Service,
+	responseCache cache.Cache,
+	objectStorage storage.Storage,
+	imageFetcher *fetcher.Fetcher,
+	archiveExtractor *archive.Extractor,
+	resumableUploads *tus.Store,
+	workerPool *worker.Pool,
+	limiter *ratelimit.Limiter,
+	cfg config.Config,
+) imageHandler {
+	maxAge := int(cfg.CacheTTL.Seconds())
+	if maxAge <= 0 {
+		// Responses are content addressed, so without an explicit TTL they
+		// never go stale.
+		maxAge = 365 * 24 * 60 * 60
+	}
+
+	return imageHandler{
+		imageUc:       imageUc,
+		cache:         responseCache,
+		cacheMaxBytes: cfg.CacheMaxBytes,
+		maxAge:        maxAge,
+		storage:       objectStorage,
+		presignTTL:    cfg.StoragePresignTTL,
+		fetcher:       imageFetcher,
+		archive:       archiveExtractor,
+		uploads:       resumableUploads,
+		uploadOptions: upload.Options{
+			SpoolThreshold: cfg.UploadSpoolThreshold,
+			MaxValueBytes:  cfg.UploadMaxValueBytes,
+			MaxParts:       cfg.UploadMaxParts,
+			TempDir:        cfg.UploadTempDir,
+		},
+		processTimeout: cfg.ProcessTimeout,
+		pool:           workerPool,
+		limiter:        limiter,
+	}
+}
+
+// acquire charges the megapixels of sources to the API key of the request,
+// when rate limits apply, and waits for a worker to process them.
+func (h *imageHandler) acquire(c *gin.Context, sources []source) (func(), error) {
+	if key := c.GetString(contextKeyAPIKey); h.limiter != nil && key != "" {
+		var pixels float64
+		for _, src := range sources {
+			pixels += src.megapixels
+		}
+
+		if err := h.limiter.AllowMegapixels(key, pixels); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.pool.Acquire(c.Request.Context())
+}
+
+// megapixels is the size of an image. Images whose size can't be read are
+// counted at the largest size accepted.
+func megapixels(data []byte) float64 {
+	imgConfig, err := usecase.DecodeConfig(data)
+	if err != nil {
+		imgConfig.Width, imgConfig.Height = constants.MaxImageDimension, constants.MaxImageDimension
+	}
+
+	return float64(imgConfig.Width) * float64(imgConfig.Height) / 1e6
+}
+
+var (
+	ErrUploadsDisabled = errors.New("resumable uploads are disabled")
+	ErrProcessTimeout  = fmt.Errorf("request processing timed out: %w", context.DeadlineExceeded)
+)
+
+// bind fills req from a JSON body or a multipart form. Multipart forms are
+// streamed part by part and their files, set on files, are spooled to disk
+// past the configured threshold. The returned form, also given to other
+// requests, spools the files of the rest of the request within the same
+// threshold, and must be removed once the request is done.
+func (h *imageHandler) bind(c *gin.Context, req any, files *dto.FilesRequest) (*upload.Form, error) {
+	if c.ContentType() != binding.MIMEMultipartPOSTForm {
+		if err := c.ShouldBind(req); err != nil {
+			return nil, invalidRequest(err)
+		}
+
+		return upload.NewForm(h.uploadOptions), nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	form, err := upload.Parse(reader, h.uploadOptions)
+	if err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	if err := binding.MapFormWithTag(req, form.Value, "form"); err != nil {
+		_ = form.RemoveAll()
+		return nil, invalidRequest(err)
+	}
+
+	for _, file := range form.File["files[]"] {
+		files.Files = append(files.Files, file)
+	}
+
+	if archives := form.File["archive"]; len(archives) > 0 {
+		files.Archive = archives[0]
+	}
+
+	return form, nil
+}
+
+// optionalInputTypes are the formats accepted only by the builds that
+// decode them.
+var optionalInputTypes = []string{constants.ContentTypeImageWebp, constants.ContentTypeImageAvif}
+
+// inputTypes returns contentTypes and the optional input types this build
+// decodes.
+func (h *imageHandler) inputTypes(contentTypes ...string) []string {
+	decode := h.imageUc.Capabilities().Decode
+	for _, contentType := range optionalInputTypes {
+		if slices.Contains(decode, contentType) {
+			contentTypes = append(contentTypes, contentType)
+		}
+	}
+
+	return contentTypes
+}
+
+// negotiateFormat gives the auto format the image types the client
+// accepts, and tells caches that the response depends on them. Other
+// formats ignore the Accept header.
+func negotiateFormat(c *gin.Context, req dto.EncodeRequest) dto.EncodeRequest {
+	req.Accept = nil
+	if req.Format != dto.EncodeFormatAuto {
+		return req
+	}
+
+	c.Writer.Header().Add("Vary", "Accept")
+	req.Accept = acceptedImageTypes(c.GetHeader("Accept"))
+	return req
+}
+
+// acceptedImageTypes returns the image types named by an Accept header,
+// leaving out the refused ones, with a zero q, and the wildcards.
+func acceptedImageTypes(accept string) []string {
+	var contentTypes []string
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil || !strings.HasPrefix(mediaType, "image/") || mediaType == "image/*" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+
+		contentTypes = append(contentTypes, mediaType)
+	}
+
+	return contentTypes
+}
+
+// source is an image of the request, read once to be validated and
+// addressed, then left where it was received, in the form, on disk or in
+// the body, until its turn to be processed comes: a batch is never held in
+// memory as a whole.
+type source struct {
+	filename    string
+	contentType string
+	field       string
+	index       int
+	open        func() (io.ReadCloser, error)
+	digest      string
+	megapixels  float64
+}
+
+// load reads the image of src to process it.
+func (src source) load() (dto.ImageData, error) {
+	r, err := src.open()
+	if err != nil {
+		return dto.ImageData{}, apperror.WithFile(err, src.field, src.index, src.filename)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return dto.ImageData{}, apperror.WithFile(fmt.Errorf("%w: %w", usecase.ErrReadFile, err), src.field, src.index, src.filename)
+	}
+
+	return dto.ImageData{Filename: src.filename, ContentType: src.contentType, ImageBytes: data}, nil
+}
+
+// openFile opens an uploaded or spooled file as a source.
+func openFile(file dto.File) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		f, err := file.Open()
+		if err != nil {
+			return nil, usecase.ErrOpenFile
+		}
+
+		return f, nil
+	}
+}
+
+// readSources checks the uploaded files of req, then its embedded images,
+// the images its urls point to, its completed resumable uploads and finally
+// the entries of its archive, one at a time. Downloads and archive entries
+// are spooled to form as they are checked. Archive entries that are not
+// allowed images are skipped and listed in the report.
+func (h *imageHandler) readSources(
+	c *gin.Context, form *upload.Form, req dto.FilesRequest, allowedContentTypes ...string,
+) ([]source, dto.Report, error) {
+	ctx := c.Request.Context()
+	var report dto.Report
+	sources := make([]source, 0, req.Len())
+
+	for i, file := range req.Files {
+		src := source{filename: file.Name(), field: "files[]", index: i, open: openFile(file)}
+		if err := h.checkSource(ctx, &src, allowedContentTypes...); err != nil {
+			return nil, report, apperror.WithFile(err, "files[]", i, src.filename)
+		}
+
+		sources = append(sources, src)
+	}
+
+	for i, base64Image := range req.Images {
+		data := base64Image.Data
+		src := source{filename: path.Base(base64Image.Filename), field: "images", index: i, open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}}
+		if err := h.checkSource(ctx, &src, allowedContentTypes...); err != nil {
+			return nil, report, apperror.WithFile(err, "images", i, src.filename)
+		}
+
+		sources = append(sources, src)
+	}
+
+	for i, rawURL := range req.URLs {
+		filename, body, err := h.fetcher.Open(ctx, rawURL)
+		if err != nil {
+			return nil, report, apperror.WithFile(err, "urls", i, "")
+		}
+
+		src := source{filename: filename, field: "urls", index: i}
+		err = h.spoolSource(ctx, form, &src, body, allowedContentTypes...)
+		body.Close()
+		if err != nil {
+			return nil, report, apperror.WithFile(err, "urls", i, filename)
+		}
+
+		sources = append(sources, src)
+	}
+
+	for i, uploadID := range req.UploadIDs {
+		src, err := h.uploadSource(uploadID)
+		if err == nil {
+			src.field, src.index = "upload_ids", i
+			err = h.checkSource(ctx, &src, allowedContentTypes...)
+		}
+		if err != nil {
+			return nil, report, apperror.WithFile(err, "upload_ids", i, src.filename)
+		}
+
+		sources = append(sources, src)
+	}
+
+	if req.Archive == nil {
+		return sources, report, nil
+	}
+
+	archiveFile, err := req.Archive.Open()
+	if err != nil {
+		return nil, report, apperror.WithFile(usecase.ErrOpenFile, "archive", -1, req.Archive.Name())
+	}
+	defer archiveFile.Close()
+
+	report.Skipped, err = h.archive.Walk(archiveFile, req.Archive.Size(), func(name string, body io.Reader) error {
+		src := source{filename: name, field: "archive", index: -1}
+		err := h.spoolSource(ctx, form, &src, body, allowedContentTypes...)
+		if errors.Is(err, usecase.ErrContentTypeNotAllowed) {
+			return &archive.SkipError{Reason: "not a supported image"}
+		}
+		if err != nil {
+			return apperror.WithFile(err, "archive", -1, name)
+		}
+
+		sources = append(sources, src)
+		return nil
+	})
+	if err != nil {
+		return nil, report, apperror.WithFile(err, "archive", -1, "")
+	}
+
+	return sources, report, nil
+}
+
+// checkSource reads the image of src to validate and address it, without
+// keeping it.
+func (h *imageHandler) checkSource(ctx context.Context, src *source, allowedContentTypes ...string) error {
+	r, err := src.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return h.checkImage(ctx, src, r, allowedContentTypes...)
+}
+
+// spoolSource is checkSource for the image body holds, which can only be
+// read once: it is spooled to form meanwhile, for src to open it again.
+func (h *imageHandler) spoolSource(
+	ctx context.Context, form *upload.Form, src *source, body io.Reader, allowedContentTypes ...string,
+) error {
+	w := form.Create(src.filename)
+	err := h.checkImage(ctx, src, io.TeeReader(body, w), allowedContentTypes...)
+	file, closeErr := w.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	src.open = openFile(file)
+	return nil
+}
+
+func (h *imageHandler) checkImage(ctx context.Context, src *source, r io.Reader, allowedContentTypes ...string) error {
+	image, err := h.imageUc.ValidateAndProcessReader(ctx, src.filename, r, allowedContentTypes...)
+	if err != nil {
+		return err
+	}
+
+	src.contentType = image.ContentType
+	src.digest = cache.Digest(image)
+	src.megapixels = megapixels(image.ImageBytes)
+	return nil
+}
+
+// uploadSource is the resumable upload uploadID, which must be complete by
+// the time it is opened.
+func (h *imageHandler) uploadSource(uploadID string) (source, error) {
+	if h.uploads == nil {
+		return source{}, ErrUploadsDisabled
+	}
+
+	info, err := h.uploads.Info(uploadID)
+	if err != nil {
+		return source{}, fmt.Errorf("upload %s: %w", uploadID, err)
+	}
+
+	return source{filename: info.Filename(), open: func() (io.ReadCloser, error) {
+		_, file, err := h.uploads.Open(uploadID)
+		if err != nil {
+			return nil, fmt.Errorf("upload %s: %w", uploadID, err)
+		}
+
+		return file, nil
+	}}, nil
 }
 
-func parseResponseError(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// withProcessTimeout bounds the rest of the request, reading the images and
+// processing them, by the configured timeout. The time spent receiving the
+// body is not included.
+func (h *imageHandler) withProcessTimeout(c *gin.Context) context.CancelFunc {
+	if h.processTimeout <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithTimeoutCause(c.Request.Context(), h.processTimeout, ErrProcessTimeout)
+	c.Request = c.Request.WithContext(ctx)
+	return cancel
 }
 
 func (h *imageHandler) PngToJpeg(c *gin.Context) {
-	var req dto.FilesRequest
-	if err := c.Bind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+	var req dto.FilesEncodeRequest
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
+	defer form.RemoveAll()
 
-	err := req.Validate()
+	err = req.Validate()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	req.EncodeRequest = negotiateFormat(c, req.EncodeRequest)
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
 
-	images, err := h.imageUc.ValidateAndProcessFilesRequest(req.Files, constants.ContentTypeImagePng)
+	sources, report, err := h.readSources(
+		c, form, req.FilesRequest, h.inputTypes(constants.ContentTypeImagePng, constants.ContentTypeImageTiff, constants.ContentTypeImageBmp)...,
+	)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
 
-	err = h.imageUc.ConvertPngToJpeg(images)
+	cacheKey := cacheKey(c, "png-to-jpeg", req.EncodeRequest, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
+	}
+
+	release, err := h.acquire(c, sources)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	defer release()
 
-	c.Status(http.StatusCreated)
-	sendImagesRespAsZip(c, images)
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		images := []dto.ImageData{image}
+		err := h.imageUc.ConvertPngToJpeg(ctx, dto.ImageDataEncode{EncodeRequest: req.EncodeRequest, ImageDatas: images})
+		return images, err
+	})
 }
 
 func (h *imageHandler) CompressImages(c *gin.Context) {
-	var req dto.FilesRequest
-	if err := c.Bind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+	var req dto.FilesEncodeRequest
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
+	defer form.RemoveAll()
 
-	err := req.Validate()
+	err = req.Validate()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	req.EncodeRequest = negotiateFormat(c, req.EncodeRequest)
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
 
-	images, err := h.imageUc.ValidateAndProcessFilesRequest(
-		req.Files, constants.ContentTypeImagePng, constants.ContentTypeImageJpeg,
+	sources, report, err := h.readSources(
+		c, form, req.FilesRequest, h.inputTypes(
+			constants.ContentTypeImagePng, constants.ContentTypeImageJpeg,
+			constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+		)...,
 	)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
 
-	err = h.imageUc.CompressImages(images)
+	cacheKey := cacheKey(c, "compress", req.EncodeRequest, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
+	}
+
+	release, err := h.acquire(c, sources)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	defer release()
 
-	c.Status(http.StatusCreated)
-	sendImagesRespAsZip(c, images)
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		images := []dto.ImageData{image}
+		err := h.imageUc.CompressImages(ctx, dto.ImageDataEncode{EncodeRequest: req.EncodeRequest, ImageDatas: images})
+		return images, err
+	})
 }
 
 func (h *imageHandler) ResizeImages(c *gin.Context) {
 	var req dto.FilesResizeRequest
-	if err := c.Bind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer form.RemoveAll()
+
+	err = req.Validate()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	req.EncodeRequest = negotiateFormat(c, req.EncodeRequest)
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
+
+	sources, report, err := h.readSources(
+		c, form, req.FilesRequest, h.inputTypes(
+			constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageGif,
+			constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+		)...,
+	)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cacheKey := cacheKey(c, "resize", []any{req.ResizeRequest, req.EncodeRequest}, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
+	}
+
+	release, err := h.acquire(c, sources)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer release()
+
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		images := []dto.ImageData{image}
+		err := h.imageUc.ResizeImages(ctx, dto.ImageDataResize{
+			ResizeRequest: req.ResizeRequest.At(i),
+			EncodeRequest: req.EncodeRequest,
+			ImageDatas:    images,
+		})
+		return images, err
+	})
+}
+
+func (h *imageHandler) CropImages(c *gin.Context) {
+	var req dto.FilesCropRequest
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer form.RemoveAll()
+
+	err = req.Validate()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
+
+	sources, report, err := h.readSources(
+		c, form, req.FilesRequest, h.inputTypes(
+			constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageGif,
+			constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+		)...,
+	)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cacheKey := cacheKey(c, "crop", req.CropRequest, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
+	}
+
+	release, err := h.acquire(c, sources)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer release()
+
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		images := []dto.ImageData{image}
+		err := h.imageUc.CropImages(ctx, dto.ImageDataCrop{CropRequest: req.CropRequest.At(i), ImageDatas: images})
+		return images, err
+	})
+}
+
+func (h *imageHandler) GifFrames(c *gin.Context) {
+	var req dto.FilesFramesRequest
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer form.RemoveAll()
+
+	err = req.Validate()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
+
+	sources, report, err := h.readSources(c, form, req.FilesRequest, constants.ContentTypeImageGif)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cacheKey := cacheKey(c, "gif-frames", req.FramesRequest, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
+	}
+
+	release, err := h.acquire(c, sources)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer release()
+
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		return h.imageUc.ExtractFrames(ctx, dto.ImageDataFrames{
+			FramesRequest: req.FramesRequest,
+			ImageDatas:    []dto.ImageData{image},
+		})
+	})
+}
+
+func (h *imageHandler) TiffPages(c *gin.Context) {
+	var req dto.FilesPagesRequest
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer form.RemoveAll()
+
+	err = req.Validate()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
+
+	sources, report, err := h.readSources(c, form, req.FilesRequest, constants.ContentTypeImageTiff)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	err := req.Validate()
+	cacheKey := cacheKey(c, "tiff-pages", req.PagesRequest, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
+	}
+
+	release, err := h.acquire(c, sources)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer release()
+
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		return h.imageUc.SplitPages(ctx, dto.ImageDataPages{
+			PagesRequest: req.PagesRequest,
+			ImageDatas:   []dto.ImageData{image},
+		})
+	})
+}
+
+// Compare scores the second image of the request against the first with
+// PSNR and SSIM.
+func (h *imageHandler) Compare(c *gin.Context) {
+	var req dto.FilesRequest
+	form, err := h.bind(c, &req, &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	defer form.RemoveAll()
 
-	images, err := h.imageUc.ValidateAndProcessFilesRequest(
-		req.Files, constants.ContentTypeImagePng, constants.ContentTypeImageJpeg,
+	err = req.Validate()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
+
+	sources, report, err := h.readSources(
+		c, form, req, h.inputTypes(
+			constants.ContentTypeImagePng, constants.ContentTypeImageJpeg,
+			constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+		)...,
 	)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
+		return
+	}
+
+	if len(sources) != 2 {
+		respondError(c, apperror.New(apperror.CodeInvalidRequest,
+			fmt.Sprintf("compare takes 2 images, the reference then the image scored, got %d", len(sources)),
+		).WithField("files[]"))
+		return
+	}
+
+	release, err := h.acquire(c, sources)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer release()
+
+	images := make([]dto.ImageData, len(sources))
+	for i, src := range sources {
+		images[i], err = src.load()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	resp, err := h.imageUc.Compare(c.Request.Context(), images[0], images[1])
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	resp.Report = report
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// processFunc processes image, at index i of the batch, into its outputs.
+type processFunc func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error)
+
+// sendImagesResp processes sources with process and renders their outputs
+// as the response asks, one source at a time. Zip and JSON responses are
+// spooled to form until they are complete.
+func (h *imageHandler) sendImagesResp(
+	c *gin.Context, form *upload.Form, cacheKey string, sources []source, report dto.Report, process processFunc,
+) {
+	switch responseOutput(c) {
+	case constants.OutputStorage:
+		h.sendImagesRespAsObjects(c, cacheKey, sources, report, process)
+	case constants.OutputJson:
+		h.sendImagesRespAsJson(c, form, cacheKey, sources, report, process)
+	default:
+		h.sendImagesRespAsZip(c, form, cacheKey, sources, report, process)
+	}
+}
+
+// eachOutput loads every source, processes it with process and gives its
+// outputs to emit before loading the next one. The encodings chosen by the
+// auto format and the quality scores are added to report.
+func eachOutput(
+	ctx context.Context, sources []source, report *dto.Report, process processFunc, emit func(dto.ImageData) error,
+) error {
+	for i, src := range sources {
+		image, err := src.load()
+		if err != nil {
+			return err
+		}
+
+		outputs, err := process(usecase.WithBatchOffset(ctx, i, len(sources)), i, image)
+		if err != nil {
+			return err
+		}
+
+		for _, output := range outputs {
+			if output.AutoFormat != nil {
+				report.AutoFormats = append(report.AutoFormats, *output.AutoFormat)
+			}
+			if output.Quality != nil {
+				report.Quality = append(report.Quality, *output.Quality)
+			}
+
+			if err := emit(output); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// responseOutput picks how processed images are returned: the output query
+// parameter wins, otherwise clients accepting only JSON get JSON and
+// everyone else a zip archive.
+func responseOutput(c *gin.Context) string {
+	if output := c.Query("output"); output != "" {
+		return output
+	}
+
+	accept := c.GetHeader("Accept")
+	if strings.Contains(accept, constants.ContentTypeApplicationJson) &&
+		!strings.Contains(accept, constants.ContentTypeApplicationZip) {
+		return constants.OutputJson
+	}
+
+	return constants.OutputZip
+}
+
+// cacheKey addresses the response of operation for sources, which differs
+// per output representation and with the report.
+func cacheKey(c *gin.Context, operation string, params any, sources []source, report dto.Report) string {
+	digests := make([]string, len(sources))
+	for i, src := range sources {
+		digests[i] = src.digest
+	}
+
+	return cache.Key(operation+"/"+responseOutput(c), []any{params, report}, digests)
+}
+
+// sendImagesRespAsJson renders dto.ImagesResponse an image at a time, the
+// fields of the report following the images.
+func (h *imageHandler) sendImagesRespAsJson(
+	c *gin.Context, form *upload.Form, cacheKey string, sources []source, report dto.Report, process processFunc,
+) {
+	w := form.Create("response.json")
+	if _, err := io.WriteString(w, `{"images":[`); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	separator := ""
+	err := eachOutput(c.Request.Context(), sources, &report, process, func(img dto.ImageData) error {
+		imageResp := dto.ImageResponse{
+			Filename:    img.Filename,
+			ContentType: usecase.DetectContentType(img.ImageBytes),
+			Size:        len(img.ImageBytes),
+			Data:        img.ImageBytes,
+		}
+
+		if imgConfig, _, err := image.DecodeConfig(bytes.NewReader(img.ImageBytes)); err == nil {
+			imageResp.Width = imgConfig.Width
+			imageResp.Height = imgConfig.Height
+		}
+
+		raw, err := json.Marshal(imageResp)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ","
+		_, err = w.Write(raw)
+		return err
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	end := []byte("]}")
+	if !report.Empty() {
+		raw, err := json.Marshal(report)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		raw[0] = ','
+		end = append([]byte("]"), raw...)
+	}
+	if _, err := w.Write(end); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	imageDataResize := dto.ImageDataResize{
-		ResizeRequest: req.ResizeRequest,
-		ImageDatas:    images,
+	file, err := w.Close()
+	if err != nil {
+		respondError(c, err)
+		return
 	}
 
-	err = h.imageUc.ResizeImages(imageDataResize)
+	h.sendFile(c, cacheKey, constants.ContentTypeApplicationJson, file)
+}
+
+// sendImagesRespAsObjects writes every image to the configured storage under
+// prefix/cacheKey/filename and responds with the object keys and presigned
+// URLs instead of the image bytes.
+func (h *imageHandler) sendImagesRespAsObjects(
+	c *gin.Context, cacheKey string, sources []source, report dto.Report, process processFunc,
+) {
+	ctx := c.Request.Context()
+	prefix := strings.Trim(c.Query("prefix"), "/")
+
+	resp := dto.StoredImagesResponse{Objects: make([]dto.StoredImage, 0, len(sources))}
+	err := eachOutput(ctx, sources, &report, process, func(image dto.ImageData) error {
+		key := path.Join(prefix, cacheKey, image.Filename)
+		contentType := mime.TypeByExtension(path.Ext(image.Filename))
+		if contentType == "" {
+			contentType = image.ContentType
+		}
+
+		err := h.storage.Put(ctx, key, bytes.NewReader(image.ImageBytes), int64(len(image.ImageBytes)), contentType)
+		if errors.Is(err, storage.ErrInvalidKey) {
+			return apperror.WithFile(fmt.Errorf("%w: %s", err, key), "prefix", -1, image.Filename)
+		}
+		if err != nil {
+			return err
+		}
+
+		url, err := h.storage.Presign(ctx, key, h.presignTTL)
+		if err != nil {
+			return err
+		}
+
+		resp.Objects = append(resp.Objects, dto.StoredImage{
+			Filename: image.Filename,
+			Key:      key,
+			URL:      url,
+		})
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
 
-	c.Status(http.StatusCreated)
-	sendImagesRespAsZip(c, imageDataResize.ImageDatas)
+	resp.Report = report
+	c.JSON(http.StatusCreated, resp)
 }
 
-func sendImagesRespAsZip(c *gin.Context, images []dto.ImageData) {
-	zipWriter := zip.NewWriter(c.Writer)
-	defer zipWriter.Close()
+func (h *imageHandler) sendImagesRespAsZip(
+	c *gin.Context, form *upload.Form, cacheKey string, sources []source, report dto.Report, process processFunc,
+) {
+	w := form.Create("response.zip")
+	zipWriter := zip.NewWriter(w)
 
 	now := time.Now()
-	for _, image := range images {
-		w, err := zipWriter.CreateHeader(&zip.FileHeader{
+	err := eachOutput(c.Request.Context(), sources, &report, process, func(image dto.ImageData) error {
+		entry, err := zipWriter.CreateHeader(&zip.FileHeader{
 			Name:     image.Filename,
 			Method:   zip.Deflate,
 			Modified: now,
 		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, parseResponseError(err))
-			return
+			return err
 		}
 
-		if _, err := io.Copy(w, bytes.NewReader(image.ImageBytes)); err != nil {
-			c.JSON(http.StatusInternalServerError, parseResponseError(err))
-			return
+		_, err = entry.Write(image.ImageBytes)
+		return err
+	})
+	if err == nil && !report.Empty() {
+		err = zipReport(zipWriter, report, now)
+	}
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	file, err := w.Close()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.sendFile(c, cacheKey, constants.ContentTypeApplicationZip, file)
+}
+
+func zipReport(zipWriter *zip.Writer, report dto.Report, modified time.Time) error {
+	w, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     "report.json",
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(report)
+}
+
+// sendFile sends a rendered response, and caches it when it fits in the
+// cache. Larger responses are streamed from their spooled file.
+func (h *imageHandler) sendFile(c *gin.Context, cacheKey, contentType string, file *upload.File) {
+	body, err := file.Open()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer body.Close()
+
+	if file.Size() > h.cacheMaxBytes {
+		h.setValidators(c, cacheKey)
+		c.DataFromReader(http.StatusCreated, file.Size(), contentType, body, nil)
+		return
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.cache.Set(cacheKey, cache.Entry{ContentType: contentType, Body: data})
+	h.setValidators(c, cacheKey)
+	c.Data(http.StatusCreated, contentType, data)
+}
+
+// serveCached answers from the validators of the request or from the cache
+// when possible, before the images are charged to the rate limits or wait
+// for a worker: nothing gets processed. It reports whether the response has
+// been written.
+func (h *imageHandler) serveCached(c *gin.Context, cacheKey string) bool {
+	output := responseOutput(c)
+	if output != constants.OutputZip && output != constants.OutputJson && output != constants.OutputStorage {
+		respondError(c, apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("unknown output %q", output)).WithField("output"))
+		return true
+	}
+
+	// Stored outputs come with short-lived URLs, so they are neither cached
+	// nor validated.
+	if output == constants.OutputStorage {
+		if h.storage == nil {
+			respondError(c, apperror.New(apperror.CodeInvalidRequest, "storage output is not configured").WithField("output"))
+			return true
 		}
+
+		return false
+	}
+
+	// RFC 9110 asks for 412 on a matching If-None-Match for unsafe methods,
+	// but these POSTs are pure functions of their input, so clients get the
+	// same 304 a GET would give them.
+	if etagMatches(c.GetHeader("If-None-Match"), etag(cacheKey)) {
+		h.setValidators(c, cacheKey)
+		c.Status(http.StatusNotModified)
+		return true
+	}
+
+	entry, ok := h.cache.Get(cacheKey)
+	if !ok {
+		c.Header("X-Cache", "MISS")
+		return false
 	}
+
+	c.Header("X-Cache", "HIT")
+	h.setValidators(c, cacheKey)
+	c.Data(http.StatusCreated, entry.ContentType, entry.Body)
+	return true
+}
+
+// setValidators makes the response addressed by cacheKey cacheable. Only
+// successful responses get them, errors must not be replayed. Responses to
+// authenticated requests are private, for shared caches not to hand the
+// output of a key to others.
+func (h *imageHandler) setValidators(c *gin.Context, cacheKey string) {
+	visibility := "public"
+	if c.GetString(contextKeyAPIKey) != "" || c.GetHeader(HeaderAPIKey) != "" || c.GetHeader("Authorization") != "" {
+		visibility = "private"
+	}
+
+	c.Header("ETag", etag(cacheKey))
+	c.Header("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, h.maxAge))
+}
+
+func etag(cacheKey string) string {
+	return `"` + cacheKey + `"`
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (h *imageHandler) ProcessImage(c *gin.Context) {
 	var req dto.FilesResizeRequest
-	if err := c.Bind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+	form, err := h.bind(c, &req, &req.FilesRequest)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
+	defer form.RemoveAll()
 
-	err := req.Validate()
+	err = req.Validate()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	req.EncodeRequest = negotiateFormat(c, req.EncodeRequest)
+
+	cancel := h.withProcessTimeout(c)
+	defer cancel()
 
-	images, err := h.imageUc.ValidateAndProcessFilesRequest(
-		req.Files, constants.ContentTypeImagePng,
+	sources, report, err := h.readSources(
+		c, form, req.FilesRequest, h.inputTypes(
+			constants.ContentTypeImagePng, constants.ContentTypeImageJpeg,
+			constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+		)...,
 	)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
 
-	imageDataResize := dto.ImageDataResize{
-		ResizeRequest: req.ResizeRequest,
-		ImageDatas:    images,
+	cacheKey := cacheKey(c, "process", []any{req.ResizeRequest, req.EncodeRequest}, sources, report)
+	if h.serveCached(c, cacheKey) {
+		return
 	}
-	err = h.imageUc.ProcessImages(imageDataResize)
+
+	release, err := h.acquire(c, sources)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, parseResponseError(err))
+		respondError(c, err)
 		return
 	}
+	defer release()
 
-	c.Status(http.StatusCreated)
-	sendImagesRespAsZip(c, imageDataResize.ImageDatas)
+	h.sendImagesResp(c, form, cacheKey, sources, report, func(ctx context.Context, i int, image dto.ImageData) ([]dto.ImageData, error) {
+		images := []dto.ImageData{image}
+		err := h.imageUc.ProcessImages(ctx, dto.ImageDataResize{
+			ResizeRequest: req.ResizeRequest.At(i),
+			EncodeRequest: req.EncodeRequest,
+			ImageDatas:    images,
+		})
+		return images, err
+	})
 }
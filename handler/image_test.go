@@ -1,16 +1,32 @@
 package handler
 
 import (
+	"archive/zip"
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/middleware"
+	"github.com/rizqo46/image-processing-go/usecase"
 )
 
 type formData struct {
@@ -51,9 +67,17 @@ func httpRequestWithFormData(t *testing.T, httpMethod string, path string, forms
 	return req
 }
 
-func Test_imageHandler_PngToJpeg(t *testing.T) {
+func newTestRouter(t *testing.T, cfg config.Config) *gin.Engine {
 	router := gin.Default()
-	SetupImageRoute(router)
+	if err := SetupImageRoute(router, Dependencies{Config: cfg}); err != nil {
+		t.Fatal(err)
+	}
+
+	return router
+}
+
+func Test_imageHandler_PngToJpeg(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
 
 	var tests = []struct {
 		name           string
@@ -71,6 +95,22 @@ func Test_imageHandler_PngToJpeg(t *testing.T) {
 			},
 			wantStatusCode: http.StatusCreated,
 		},
+		{
+			name: "success convert tiff and bmp",
+			field: []formData{
+				{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/scan.tiff",
+				},
+				{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/legacy.bmp",
+				},
+			},
+			wantStatusCode: http.StatusCreated,
+		},
 		{
 			name:           "error image request not provided",
 			field:          []formData{},
@@ -85,7 +125,7 @@ func Test_imageHandler_PngToJpeg(t *testing.T) {
 					value:      ".././imagetest/cat.jpg",
 				},
 			},
-			wantStatusCode: http.StatusBadRequest,
+			wantStatusCode: http.StatusUnsupportedMediaType,
 		},
 	}
 
@@ -101,8 +141,7 @@ func Test_imageHandler_PngToJpeg(t *testing.T) {
 }
 
 func Test_imageHandler_CompressImages(t *testing.T) {
-	router := gin.Default()
-	SetupImageRoute(router)
+	router := newTestRouter(t, config.Config{})
 
 	var tests = []struct {
 		name           string
@@ -120,6 +159,22 @@ func Test_imageHandler_CompressImages(t *testing.T) {
 			},
 			wantStatusCode: http.StatusCreated,
 		},
+		{
+			name: "success compress tiff and bmp",
+			field: []formData{
+				{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/scan.tiff",
+				},
+				{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/legacy.bmp",
+				},
+			},
+			wantStatusCode: http.StatusCreated,
+		},
 		{
 			name:           "error image request not provided",
 			field:          []formData{},
@@ -144,7 +199,7 @@ func Test_imageHandler_CompressImages(t *testing.T) {
 					value:      "70",
 				},
 			},
-			wantStatusCode: http.StatusBadRequest,
+			wantStatusCode: http.StatusUnsupportedMediaType,
 		},
 	}
 
@@ -160,8 +215,7 @@ func Test_imageHandler_CompressImages(t *testing.T) {
 }
 
 func Test_imageHandler_Resize(t *testing.T) {
-	router := gin.Default()
-	SetupImageRoute(router)
+	router := newTestRouter(t, config.Config{})
 
 	var tests = []struct {
 		name           string
@@ -189,6 +243,27 @@ func Test_imageHandler_Resize(t *testing.T) {
 			},
 			wantStatusCode: http.StatusCreated,
 		},
+		{
+			name: "success resize animated gif",
+			field: []formData{
+				{
+					isTypeFile: true,
+					label:      "files[]",
+					value:      ".././imagetest/sticker.gif",
+				},
+				{
+					isTypeFile: false,
+					label:      "width[]",
+					value:      "12",
+				},
+				{
+					isTypeFile: false,
+					label:      "height[]",
+					value:      "8",
+				},
+			},
+			wantStatusCode: http.StatusCreated,
+		},
 		{
 			name: "error process image file type not supported",
 			field: []formData{
@@ -208,7 +283,7 @@ func Test_imageHandler_Resize(t *testing.T) {
 					value:      "70",
 				},
 			},
-			wantStatusCode: http.StatusBadRequest,
+			wantStatusCode: http.StatusUnsupportedMediaType,
 		},
 		{
 			name:           "error image request not provided",
@@ -229,13 +304,14 @@ func Test_imageHandler_Resize(t *testing.T) {
 }
 
 func Test_imageHandler_ProcessImage(t *testing.T) {
-	router := gin.Default()
-	SetupImageRoute(router)
+	router := newTestRouter(t, config.Config{})
 
 	var tests = []struct {
 		name           string
 		field          []formData
 		wantStatusCode int
+		wantFilename   string
+		wantSize       image.Point
 	}{
 		{
 			name: "success process image",
@@ -253,31 +329,43 @@ func Test_imageHandler_ProcessImage(t *testing.T) {
 				{
 					isTypeFile: false,
 					label:      "height[]",
-					value:      "70",
+					value:      "50",
 				},
 			},
 			wantStatusCode: http.StatusCreated,
+			wantFilename:   "flower.jpeg",
+			wantSize:       image.Pt(70, 50),
+		},
+		{
+			name: "success process jpeg image",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"},
+				{label: "width[]", value: "70"},
+				{label: "height[]", value: "50"},
+			},
+			wantStatusCode: http.StatusCreated,
+			wantFilename:   "cat.jpg",
+			wantSize:       image.Pt(70, 50),
+		},
+		{
+			name: "success process tiff image",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/scan.tiff"},
+				{label: "width[]", value: "70"},
+				{label: "height[]", value: "50"},
+			},
+			wantStatusCode: http.StatusCreated,
+			wantFilename:   "scan.jpeg",
+			wantSize:       image.Pt(70, 50),
 		},
 		{
 			name: "error process image file type not supported",
 			field: []formData{
-				{
-					isTypeFile: true,
-					label:      "files[]",
-					value:      ".././imagetest/cat.jpg",
-				},
-				{
-					isTypeFile: false,
-					label:      "width[]",
-					value:      "70",
-				},
-				{
-					isTypeFile: false,
-					label:      "height[]",
-					value:      "70",
-				},
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/text.txt"},
+				{label: "width[]", value: "70"},
+				{label: "height[]", value: "50"},
 			},
-			wantStatusCode: http.StatusBadRequest,
+			wantStatusCode: http.StatusUnsupportedMediaType,
 		},
 		{
 			name:           "error image request not provided",
@@ -289,10 +377,1464 @@ func Test_imageHandler_ProcessImage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
-			req := httpRequestWithFormData(t, http.MethodPost, "/", tt.field...)
+			req := httpRequestWithFormData(t, http.MethodPost, "/?output=json", tt.field...)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if w.Code != http.StatusCreated {
+				return
+			}
+
+			var resp dto.ImagesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantFilename, resp.Images[0].Filename)
+			assert.Equal(t, constants.ContentTypeImageJpeg, resp.Images[0].ContentType)
+			imgConfig, _, err := image.DecodeConfig(bytes.NewReader(resp.Images[0].Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantSize, image.Pt(imgConfig.Width, imgConfig.Height))
+		})
+	}
+}
+
+func Test_imageHandler_Crop(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	rect := func(x, y, width, height string) []formData {
+		return []formData{
+			{label: "x[]", value: x},
+			{label: "y[]", value: y},
+			{label: "width[]", value: width},
+			{label: "height[]", value: height},
+		}
+	}
+
+	var tests = []struct {
+		name           string
+		field          []formData
+		wantStatusCode int
+	}{
+		{
+			name: "success crop png",
+			field: append(rect("10", "10", "30", "30"),
+				formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"}),
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name: "success crop animated gif",
+			field: append(rect("6", "0", "12", "16"),
+				formData{isTypeFile: true, label: "files[]", value: ".././imagetest/sticker.gif"}),
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name: "error rectangle out of the image",
+			field: append(rect("100", "100", "10", "10"),
+				formData{isTypeFile: true, label: "files[]", value: ".././imagetest/sticker.gif"}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "error rectangle not provided",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, "/crop", tt.field...)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+		})
+	}
+}
+
+func Test_imageHandler_GifFrames(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+	sticker := formData{isTypeFile: true, label: "files[]", value: ".././imagetest/sticker.gif"}
+
+	var tests = []struct {
+		name           string
+		field          []formData
+		wantStatusCode int
+		wantFiles      []string
+	}{
+		{
+			name:           "every frame",
+			field:          []formData{sticker},
+			wantStatusCode: http.StatusCreated,
+			wantFiles:      []string{"sticker-000.png", "sticker-001.png", "sticker-002.png"},
+		},
+		{
+			name:           "single jpeg frame",
+			field:          []formData{sticker, {label: "format", value: "jpeg"}, {label: "frame", value: "2"}},
+			wantStatusCode: http.StatusCreated,
+			wantFiles:      []string{"sticker.jpeg"},
+		},
+		{
+			name:           "error frame out of range",
+			field:          []formData{sticker, {label: "frame", value: "3"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error not a gif",
+			field:          []formData{{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"}},
+			wantStatusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, "/gif-frames", tt.field...)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantFiles == nil {
+				return
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := []string{}
+			for _, f := range zr.File {
+				files = append(files, f.Name)
+			}
+			assert.Equal(t, tt.wantFiles, files)
+		})
+	}
+}
+
+func Test_imageHandler_TiffPages(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+	scan := formData{isTypeFile: true, label: "files[]", value: ".././imagetest/scan.tiff"}
+
+	var tests = []struct {
+		name           string
+		field          []formData
+		wantStatusCode int
+		wantFiles      []string
+	}{
+		{
+			name:           "every page",
+			field:          []formData{scan},
+			wantStatusCode: http.StatusCreated,
+			wantFiles:      []string{"scan-001.png", "scan-002.png", "scan-003.png"},
+		},
+		{
+			name:           "jpeg pages",
+			field:          []formData{scan, {label: "format", value: "jpeg"}},
+			wantStatusCode: http.StatusCreated,
+			wantFiles:      []string{"scan-001.jpeg", "scan-002.jpeg", "scan-003.jpeg"},
+		},
+		{
+			name:           "error unknown format",
+			field:          []formData{scan, {label: "format", value: "webp"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error not a tiff",
+			field:          []formData{{isTypeFile: true, label: "files[]", value: ".././imagetest/legacy.bmp"}},
+			wantStatusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, "/tiff-pages", tt.field...)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantFiles == nil {
+				return
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := []string{}
+			for _, f := range zr.File {
+				files = append(files, f.Name)
+			}
+			assert.Equal(t, tt.wantFiles, files)
+		})
+	}
+}
+
+func Test_imageHandler_OutputFormat(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+	capabilities := usecase.NewImageUsecase().Capabilities()
+
+	// Webp and avif are only processed by the OpenCV builds that have them.
+	optionalStatus := func(capabilities []string, contentType string, unavailable int) int {
+		if slices.Contains(capabilities, contentType) {
+			return http.StatusCreated
+		}
+		return unavailable
+	}
+
+	errorCodes := map[int]string{
+		http.StatusBadRequest:           "INVALID_REQUEST",
+		http.StatusUnsupportedMediaType: "UNSUPPORTED_TYPE",
+		http.StatusNotImplemented:       "CODEC_UNAVAILABLE",
+	}
+
+	flower := formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"}
+
+	var tests = []struct {
+		name           string
+		path           string
+		field          []formData
+		wantStatusCode int
+	}{
+		{
+			name:           "success compress to png",
+			path:           "/compress",
+			field:          []formData{{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"}, {label: "format", value: "png"}},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name: "success resize with quality",
+			path: "/resize",
+			field: []formData{
+				flower, {label: "width[]", value: "40"}, {label: "height[]", value: "30"},
+				{label: "format", value: "jpeg"}, {label: "quality", value: "60"},
+			},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "error unknown format",
+			path:           "/png-to-jpeg",
+			field:          []formData{flower, {label: "format", value: "heic"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error quality out of range",
+			path:           "/compress",
+			field:          []formData{flower, {label: "quality", value: "101"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error speed out of range",
+			path:           "/compress",
+			field:          []formData{flower, {label: "format", value: "avif"}, {label: "speed", value: "11"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "success ssim target",
+			path:           "/png-to-jpeg",
+			field:          []formData{flower, {label: "ssim", value: "0.95"}},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "error ssim out of range",
+			path:           "/compress",
+			field:          []formData{flower, {label: "format", value: "jpeg"}, {label: "ssim", value: "1.5"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error ssim with quality",
+			path:           "/compress",
+			field:          []formData{flower, {label: "format", value: "jpeg"}, {label: "ssim", value: "0.95"}, {label: "quality", value: "80"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error ssim with png",
+			path:           "/compress",
+			field:          []formData{flower, {label: "format", value: "png"}, {label: "ssim", value: "0.95"}},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "avif output",
+			path:           "/png-to-jpeg",
+			field:          []formData{flower, {label: "format", value: "avif"}, {label: "quality", value: "50"}, {label: "speed", value: "8"}},
+			wantStatusCode: optionalStatus(capabilities.Encode, constants.ContentTypeImageAvif, http.StatusNotImplemented),
+		},
+		{
+			name:           "webp output",
+			path:           "/compress",
+			field:          []formData{flower, {label: "format", value: "webp"}, {label: "quality", value: "70"}},
+			wantStatusCode: optionalStatus(capabilities.Encode, constants.ContentTypeImageWebp, http.StatusNotImplemented),
+		},
+		{
+			name:           "avif input",
+			path:           "/compress",
+			field:          []formData{{isTypeFile: true, label: "files[]", value: ".././imagetest/photo.avif"}},
+			wantStatusCode: optionalStatus(capabilities.Decode, constants.ContentTypeImageAvif, http.StatusUnsupportedMediaType),
+		},
+		{
+			name: "avif crop",
+			path: "/crop",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/photo.avif"},
+				{label: "x[]", value: "10"}, {label: "y[]", value: "10"}, {label: "width[]", value: "30"}, {label: "height[]", value: "30"},
+			},
+			wantStatusCode: optionalStatus(capabilities.Decode, constants.ContentTypeImageAvif, http.StatusUnsupportedMediaType),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, tt.path, tt.field...)
 			router.ServeHTTP(w, req)
 
 			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if w.Code == http.StatusCreated {
+				return
+			}
+
+			var resp dto.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, errorCodes[w.Code], resp.Code)
+		})
+	}
+}
+
+func Test_imageHandler_AutoFormat(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	var tests = []struct {
+		name            string
+		file            string
+		accept          string
+		wantTypes       []string
+		wantAutoFormats int
+	}{
+		{
+			name:            "photo",
+			file:            ".././imagetest/cat.jpg",
+			accept:          "image/avif,image/webp,*/*",
+			wantTypes:       []string{constants.ContentTypeImageJpeg, constants.ContentTypeImageWebp, constants.ContentTypeImageAvif},
+			wantAutoFormats: 1,
+		},
+		{
+			name:            "webp refused",
+			file:            ".././imagetest/cat.jpg",
+			accept:          "image/webp;q=0, */*",
+			wantTypes:       []string{constants.ContentTypeImageJpeg, constants.ContentTypeImagePng},
+			wantAutoFormats: 1,
+		},
+		{
+			name:            "transparent image",
+			file:            ".././imagetest/flower.png",
+			wantTypes:       []string{constants.ContentTypeImagePng},
+			wantAutoFormats: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, "/compress?output=json",
+				formData{isTypeFile: true, label: "files[]", value: tt.file},
+				formData{label: "format", value: "auto"},
+			)
+			req.Header.Set("Accept", tt.accept)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+			var resp dto.ImagesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantAutoFormats, len(resp.AutoFormats))
+			choice := resp.AutoFormats[0]
+			assert.Equal(t, true, slices.Contains(tt.wantTypes, choice.ContentType))
+			assert.Equal(t, resp.Images[0].ContentType, choice.ContentType)
+			assert.Equal(t, resp.Images[0].Filename, choice.Filename)
+			assert.Equal(t, resp.Images[0].Size, choice.OutputBytes)
+			assert.Equal(t, true, choice.SSIM >= 0.98)
+		})
+	}
+}
+
+func Test_imageHandler_Quality(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	compress := func(fields ...formData) dto.ImagesResponse {
+		t.Helper()
+		fields = append(fields,
+			formData{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"},
+			formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"},
+		)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compress?output=json", fields...))
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var resp dto.ImagesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Outputs are only scored on request.
+	assert.Equal(t, 0, len(compress().Quality))
+
+	// Only the jpeg is lossy.
+	resp := compress(formData{label: "score", value: "true"})
+	assert.Equal(t, 1, len(resp.Quality))
+	assert.Equal(t, resp.Images[0].Filename, resp.Quality[0].Filename)
+	assert.Equal(t, true, resp.Quality[0].SSIM > 0.9 && resp.Quality[0].SSIM <= 1)
+}
+
+func Test_imageHandler_Compare(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	var tests = []struct {
+		name           string
+		files          []string
+		wantStatusCode int
+		wantResized    bool
+	}{
+		{
+			name:           "identical images",
+			files:          []string{".././imagetest/cat.jpg", ".././imagetest/cat.jpg"},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "different sizes",
+			files:          []string{".././imagetest/cat.jpg", ".././imagetest/flower.png"},
+			wantStatusCode: http.StatusOK,
+			wantResized:    true,
+		},
+		{
+			name:           "single image",
+			files:          []string{".././imagetest/cat.jpg"},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "three images",
+			files:          []string{".././imagetest/cat.jpg", ".././imagetest/cat.jpg", ".././imagetest/cat.jpg"},
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []formData
+			for _, file := range tt.files {
+				fields = append(fields, formData{isTypeFile: true, label: "files[]", value: file})
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compare", fields...))
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp dto.CompareResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "cat.jpg", resp.Reference)
+			assert.Equal(t, tt.wantResized, resp.Resized)
+			if !tt.wantResized {
+				assert.Equal(t, 100.0, resp.PSNR)
+				assert.Equal(t, 1.0, resp.SSIM)
+			}
+		})
+	}
+
+	t.Run("skipped archive entries are reported", func(t *testing.T) {
+		router := newTestRouter(t, config.Config{ArchiveMaxEntries: 10, ArchiveMaxTotalBytes: 1 << 20, ArchiveMaxRatio: 100})
+
+		var archive bytes.Buffer
+		zw := zip.NewWriter(&archive)
+		for _, entry := range [][2]string{
+			{"reference.jpg", ".././imagetest/cat.jpg"},
+			{"notes.txt", ".././imagetest/text.txt"},
+			{"image.jpg", ".././imagetest/cat.jpg"},
+		} {
+			content, err := os.ReadFile(entry[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, _ := zw.Create(entry[0])
+			_, _ = w.Write(content)
+		}
+		zw.Close()
+		archivePath := filepath.Join(t.TempDir(), "pair.zip")
+		if err := os.WriteFile(archivePath, archive.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compare",
+			formData{isTypeFile: true, label: "archive", value: archivePath}))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp dto.CompareResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "reference.jpg", resp.Reference)
+		assert.Equal(t, "image.jpg", resp.Image)
+		assert.Equal(t, 1, len(resp.Skipped))
+		assert.Equal(t, "notes.txt", resp.Skipped[0].Filename)
+	})
+}
+
+func Test_imageHandler_ResponseCache(t *testing.T) {
+	router := newTestRouter(t, config.Config{
+		CacheBackend:  config.CacheBackendMemory,
+		CacheMaxBytes: 1 << 20,
+	})
+
+	field := []formData{
+		{
+			isTypeFile: true,
+			label:      "files[]",
+			value:      ".././imagetest/flower.png",
+		},
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compress", field...))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "public, max-age=31536000", w.Header().Get("Cache-Control"))
+
+	etag := w.Header().Get("ETag")
+	firstBody := w.Body.Bytes()
+
+	var tests = []struct {
+		name           string
+		ifNoneMatch    string
+		wantStatusCode int
+		wantXCache     string
+	}{
+		{
+			name:           "cache hit replays the stored response",
+			wantStatusCode: http.StatusCreated,
+			wantXCache:     "HIT",
+		},
+		{
+			name:           "matching If-None-Match",
+			ifNoneMatch:    `"other", ` + etag,
+			wantStatusCode: http.StatusNotModified,
+		},
+		{
+			name:           "stale If-None-Match",
+			ifNoneMatch:    `"other"`,
+			wantStatusCode: http.StatusCreated,
+			wantXCache:     "HIT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, "/compress", field...)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+			assert.Equal(t, tt.wantXCache, w.Header().Get("X-Cache"))
+			if tt.wantStatusCode == http.StatusCreated {
+				assert.Equal(t, firstBody, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func Test_imageHandler_SpooledBatch(t *testing.T) {
+	// Nothing fits in memory: the files and the response are spooled to
+	// disk, and the response is too large to be cached.
+	router := newTestRouter(t, config.Config{
+		UploadSpoolThreshold: 1,
+		CacheBackend:         config.CacheBackendMemory,
+		CacheMaxBytes:        1 << 10,
+	})
+
+	field := []formData{
+		{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"},
+		{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"},
+		{label: "format", value: "auto"},
+	}
+
+	var tests = []struct {
+		name   string
+		output string
+	}{
+		{name: "zip", output: constants.OutputZip},
+		{name: "json", output: constants.OutputJson},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies [][]byte
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compress?output="+tt.output, field...))
+
+				assert.Equal(t, http.StatusCreated, w.Code)
+				assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+				assert.NotEqual(t, "", w.Header().Get("ETag"))
+				assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+				bodies = append(bodies, w.Body.Bytes())
+			}
+
+			if tt.output == constants.OutputJson {
+				var resp dto.ImagesResponse
+				if err := json.Unmarshal(bodies[0], &resp); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, 2, len(resp.Images))
+				assert.Equal(t, 2, len(resp.AutoFormats))
+				return
+			}
+
+			zipReader, err := zip.NewReader(bytes.NewReader(bodies[0]), int64(len(bodies[0])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, 3, len(zipReader.File))
+			assert.Equal(t, "report.json", zipReader.File[2].Name)
+		})
+	}
+}
+
+func Test_imageHandler_StorageOutput(t *testing.T) {
+	field := []formData{
+		{
+			isTypeFile: true,
+			label:      "files[]",
+			value:      ".././imagetest/flower.png",
+		},
+	}
+
+	t.Run("storage not configured", func(t *testing.T) {
+		router := newTestRouter(t, config.Config{})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compress?output=storage", field...))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("writes outputs to local storage", func(t *testing.T) {
+		router := newTestRouter(t, config.Config{
+			StorageDriver:     config.StorageDriverLocal,
+			StorageLocalDir:   t.TempDir(),
+			StoragePublicURL:  "http://example.test",
+			StoragePresignTTL: time.Minute,
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compress?output=storage&prefix=nightly", field...))
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var resp dto.StoredImagesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, len(resp.Objects))
+		assert.Equal(t, true, strings.HasPrefix(resp.Objects[0].Key, "nightly/"))
+
+		objectURL, err := url.Parse(resp.Objects[0].URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, objectURL.RequestURI(), nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/objects/"+resp.Objects[0].Key, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func Test_imageHandler_URLSources(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(".././imagetest")))
+	defer server.Close()
+
+	cfg := config.Config{
+		FetchAllowPrivateNetworks: true,
+		FetchMaxBytes:             2 << 20,
+		FetchTimeout:              time.Second,
+	}
+
+	var tests = []struct {
+		name           string
+		cfg            config.Config
+		path           string
+		body           string
+		wantStatusCode int
+	}{
+		{
+			name:           "success compress image from url",
+			cfg:            cfg,
+			path:           "/compress",
+			body:           `{"urls": ["` + server.URL + `/flower.png"]}`,
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "success resize image from url",
+			cfg:            cfg,
+			path:           "/resize",
+			body:           `{"urls": ["` + server.URL + `/cat.jpg"], "height": [30], "width": [40]}`,
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "error resize param count mismatch",
+			cfg:            cfg,
+			path:           "/resize",
+			body:           `{"urls": ["` + server.URL + `/cat.jpg"]}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error file type not supported",
+			cfg:            cfg,
+			path:           "/compress",
+			body:           `{"urls": ["` + server.URL + `/text.txt"]}`,
+			wantStatusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "error remote file not found",
+			cfg:            cfg,
+			path:           "/compress",
+			body:           `{"urls": ["` + server.URL + `/missing.png"]}`,
+			wantStatusCode: http.StatusBadGateway,
+		},
+		{
+			name:           "error private network not allowed",
+			cfg:            config.Config{FetchTimeout: time.Second},
+			path:           "/compress",
+			body:           `{"urls": ["` + server.URL + `/flower.png"]}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, tt.cfg)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+		})
+	}
+}
+
+func Test_imageHandler_JsonMode(t *testing.T) {
+	router := newTestRouter(t, config.Config{})
+
+	flower, err := os.ReadFile(".././imagetest/flower.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonBody := func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+
+	var tests = []struct {
+		name           string
+		path           string
+		body           string
+		accept         string
+		wantStatusCode int
+		wantImages     []dto.ImageResponse
+	}{
+		{
+			name: "success resize base64 image with json response",
+			path: "/resize",
+			body: jsonBody(dto.FilesResizeRequest{
+				FilesRequest:  dto.FilesRequest{Images: []dto.Base64Image{{Filename: "flower.png", Data: flower}}},
+				ResizeRequest: dto.ResizeRequest{Height: []int{30}, Width: []int{40}},
+			}),
+			accept:         "application/json",
+			wantStatusCode: http.StatusCreated,
+			wantImages: []dto.ImageResponse{
+				{Filename: "flower.png", ContentType: "image/png", Width: 40, Height: 30},
+			},
+		},
+		{
+			name: "success convert base64 image with json response",
+			path: "/png-to-jpeg?output=json",
+			body: jsonBody(dto.FilesRequest{
+				Images: []dto.Base64Image{{Filename: "../flower.png", Data: flower}},
+			}),
+			wantStatusCode: http.StatusCreated,
+			wantImages: []dto.ImageResponse{
+				{Filename: "flower.jpeg", ContentType: "image/jpeg"},
+			},
+		},
+		{
+			name:           "error invalid base64",
+			path:           "/compress",
+			body:           `{"images": [{"filename": "a.png", "data": "not base64!"}]}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error missing filename",
+			path:           "/compress",
+			body:           jsonBody(dto.FilesRequest{Images: []dto.Base64Image{{Data: flower}}}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "error unknown output",
+			path:           "/compress?output=xml",
+			body:           jsonBody(dto.FilesRequest{Images: []dto.Base64Image{{Filename: "a.png", Data: flower}}}),
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", tt.accept)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantImages == nil {
+				return
+			}
+
+			var resp dto.ImagesResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, len(tt.wantImages), len(resp.Images))
+			for i, want := range tt.wantImages {
+				got := resp.Images[i]
+				assert.Equal(t, want.Filename, got.Filename)
+				assert.Equal(t, want.ContentType, got.ContentType)
+				assert.Equal(t, len(got.Data), got.Size)
+				if want.Width != 0 {
+					assert.Equal(t, want.Width, got.Width)
+					assert.Equal(t, want.Height, got.Height)
+				}
+			}
+		})
+	}
+}
+
+func Test_imageHandler_ArchiveInput(t *testing.T) {
+	router := newTestRouter(t, config.Config{
+		ArchiveMaxEntries:    10,
+		ArchiveMaxTotalBytes: 1 << 20,
+		ArchiveMaxRatio:      100,
+	})
+
+	createArchive := func(t *testing.T, entries map[string]string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, source := range entries {
+			w, _ := zw.Create(name)
+			content, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = w.Write(content)
+		}
+		zw.Close()
+
+		archivePath := filepath.Join(t.TempDir(), "shoot.zip")
+		if err := os.WriteFile(archivePath, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return archivePath
+	}
+
+	archivePath := createArchive(t, map[string]string{
+		"day1/flower.png": ".././imagetest/flower.png",
+		"day1/notes.txt":  ".././imagetest/text.txt",
+	})
+
+	var tests = []struct {
+		name           string
+		path           string
+		field          []formData
+		wantStatusCode int
+		wantFiles      []string
+	}{
+		{
+			name: "success compress archive",
+			path: "/compress",
+			field: []formData{
+				{isTypeFile: true, label: "archive", value: archivePath},
+			},
+			wantStatusCode: http.StatusCreated,
+			wantFiles:      []string{"day1/flower.png", "report.json"},
+		},
+		{
+			name: "success resize archive and file with a single pair",
+			path: "/resize",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"},
+				{isTypeFile: true, label: "archive", value: archivePath},
+				{label: "height[]", value: "30"},
+				{label: "width[]", value: "30"},
+			},
+			wantStatusCode: http.StatusCreated,
+			wantFiles:      []string{"cat.jpg", "day1/flower.png", "report.json"},
+		},
+		{
+			name: "error resize archive with more than one pair",
+			path: "/resize",
+			field: []formData{
+				{isTypeFile: true, label: "archive", value: archivePath},
+				{label: "height[]", value: "30"},
+				{label: "width[]", value: "30"},
+				{label: "height[]", value: "30"},
+				{label: "width[]", value: "30"},
+			},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name: "error archive is not an archive",
+			path: "/compress",
+			field: []formData{
+				{isTypeFile: true, label: "archive", value: ".././imagetest/text.txt"},
+			},
+			wantStatusCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, tt.path, tt.field...))
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantFiles == nil {
+				return
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := []string{}
+			for _, f := range zr.File {
+				files = append(files, f.Name)
+			}
+			assert.Equal(t, tt.wantFiles, files)
+		})
+	}
+}
+
+func Test_imageHandler_RequestBodyLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(middleware.RequestBodyLimiter(1 << 10))
+	if err := SetupImageRoute(router, Dependencies{}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+		isTypeFile: true,
+		label:      "files[]",
+		value:      ".././imagetest/flower.png",
+	})
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func Test_imageHandler_ResumableUpload(t *testing.T) {
+	image, err := os.ReadFile(".././imagetest/flower.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(image) / 2
+
+	// Chunks are larger than the body limit, which does not apply to them.
+	router := gin.New()
+	router.Use(middleware.RequestBodyLimiter(1<<10, TusUploadRoute))
+	if err := SetupImageRoute(router, Dependencies{Config: config.Config{TusDir: t.TempDir(), TusExpiry: time.Hour}}); err != nil {
+		t.Fatal(err)
+	}
+	var location string
+
+	tusRequest := func(method, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	compress := func(uploadID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/compress", strings.NewReader(`{"upload_ids": ["`+uploadID+`"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var steps = []struct {
+		name           string
+		do             func() *httptest.ResponseRecorder
+		wantStatusCode int
+		wantOffset     string
+	}{
+		{
+			name:           "options advertises the protocol",
+			do:             func() *httptest.ResponseRecorder { return tusRequest(http.MethodOptions, "/files", nil, nil) },
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name: "error unsupported protocol version",
+			do: func() *httptest.ResponseRecorder {
+				return tusRequest(http.MethodPost, "/files", nil, map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "1"})
+			},
+			wantStatusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name: "create upload",
+			do: func() *httptest.ResponseRecorder {
+				w := tusRequest(http.MethodPost, "/files", nil, map[string]string{
+					"Upload-Length":   strconv.Itoa(len(image)),
+					"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("scan.png")),
+				})
+				location = w.Header().Get("Location")
+				return w
+			},
+			wantStatusCode: http.StatusCreated,
+			wantOffset:     "0",
+		},
+		{
+			name: "upload first chunk",
+			do: func() *httptest.ResponseRecorder {
+				return tusRequest(http.MethodPatch, location, image[:half], map[string]string{
+					"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0",
+				})
+			},
+			wantStatusCode: http.StatusNoContent,
+			wantOffset:     strconv.Itoa(half),
+		},
+		{
+			name: "error chunk at wrong offset",
+			do: func() *httptest.ResponseRecorder {
+				return tusRequest(http.MethodPatch, location, image[half:], map[string]string{
+					"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0",
+				})
+			},
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name:           "head reports the offset",
+			do:             func() *httptest.ResponseRecorder { return tusRequest(http.MethodHead, location, nil, nil) },
+			wantStatusCode: http.StatusOK,
+			wantOffset:     strconv.Itoa(half),
+		},
+		{
+			name:           "error processing incomplete upload",
+			do:             func() *httptest.ResponseRecorder { return compress(path.Base(location)) },
+			wantStatusCode: http.StatusConflict,
+		},
+		{
+			name: "upload last chunk",
+			do: func() *httptest.ResponseRecorder {
+				return tusRequest(http.MethodPatch, location, image[half:], map[string]string{
+					"Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(half),
+				})
+			},
+			wantStatusCode: http.StatusNoContent,
+			wantOffset:     strconv.Itoa(len(image)),
+		},
+		{
+			name: "process completed upload",
+			do: func() *httptest.ResponseRecorder {
+				w := compress(path.Base(location))
+				var resp dto.ImagesResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, 1, len(resp.Images))
+				assert.Equal(t, "scan.png", resp.Images[0].Filename)
+				return w
+			},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "error processing unknown upload",
+			do:             func() *httptest.ResponseRecorder { return compress("0123456789abcdef0123456789abcdef") },
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "terminate upload",
+			do:             func() *httptest.ResponseRecorder { return tusRequest(http.MethodDelete, location, nil, nil) },
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "error head terminated upload",
+			do:             func() *httptest.ResponseRecorder { return tusRequest(http.MethodHead, location, nil, nil) },
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			w := step.do()
+
+			assert.Equal(t, step.wantStatusCode, w.Code)
+			if step.wantOffset != "" {
+				assert.Equal(t, step.wantOffset, w.Header().Get("Upload-Offset"))
+			}
+		})
+	}
+}
+
+func Test_imageHandler_Metrics(t *testing.T) {
+	router := gin.New()
+	router.Use(middleware.RequestBodyLimiter(1 << 20))
+	cfg := config.Config{ArchiveMaxEntries: 10, ArchiveMaxTotalBytes: 1 << 20, ArchiveMaxRatio: 100}
+	if err := SetupImageRoute(router, Dependencies{Config: cfg}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Skipping the notes of an archive doesn't reject the request.
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, source := range map[string]string{"cat.jpg": ".././imagetest/cat.jpg", "notes.txt": ".././imagetest/text.txt"} {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, _ := zw.Create(name)
+		_, _ = w.Write(content)
+	}
+	zw.Close()
+	archivePath := filepath.Join(t.TempDir(), "shoot.zip")
+	if err := os.WriteFile(archivePath, archive.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []*http.Request{
+		httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+			isTypeFile: true,
+			label:      "files[]",
+			value:      ".././imagetest/cat.jpg",
+		}),
+		httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+			isTypeFile: true,
+			label:      "files[]",
+			value:      ".././imagetest/text.txt",
+		}),
+		httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+			label: "urls[]",
+			value: strings.Repeat("a", 2<<20),
+		}),
+		httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+			isTypeFile: true,
+			label:      "archive",
+			value:      archivePath,
+		}),
+	}
+	for _, req := range requests {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, want := range []string{
+		`http_requests_total{method="POST",route="/compress",status="201"} 2`,
+		`http_requests_total{method="POST",route="/compress",status="415"} 1`,
+		`http_requests_total{method="POST",route="/compress",status="413"} 1`,
+		`http_requests_rejected_total{reason="body_too_large"} 1`,
+		`http_requests_rejected_total{reason="unsupported_type"} 1`,
+		`image_operation_duration_seconds_count{operation="compress",status="ok"} 2`,
+		`image_stage_duration_seconds_count{operation="compress",stage="decode"} 2`,
+		`image_stage_duration_seconds_count{operation="compress",stage="encode"} 2`,
+		`image_input_bytes_count{operation="compress"} 2`,
+		`image_output_bytes_count{operation="compress"} 2`,
+		`image_compression_ratio_count{operation="compress"} 2`,
+		`images_processed_total{format="jpeg",operation="compress"} 2`,
+		`image_operations_in_flight{operation="compress"} 0`,
+	} {
+		assert.Equal(t, true, strings.Contains(w.Body.String(), want))
+	}
+}
+
+func Test_imageHandler_RequestID(t *testing.T) {
+	var tests = []struct {
+		name          string
+		requestID     string
+		wantRequestID string
+	}{
+		{
+			name:          "echo client request id",
+			requestID:     "batch-42",
+			wantRequestID: "batch-42",
+		},
+		{
+			name:      "generate request id",
+			requestID: "",
+		},
+		{
+			name:      "replace invalid request id",
+			requestID: "bad id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(middleware.RequestID())
+			if err := SetupImageRoute(router, Dependencies{}); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/compress", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", tt.requestID)
+			router.ServeHTTP(w, req)
+
+			var resp map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			requestID := w.Header().Get("X-Request-ID")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, requestID, resp["request_id"])
+			if tt.wantRequestID != "" {
+				assert.Equal(t, tt.wantRequestID, requestID)
+			} else {
+				assert.Equal(t, 32, len(requestID))
+			}
+		})
+	}
+}
+
+func Test_imageHandler_Timeout(t *testing.T) {
+	var tests = []struct {
+		name           string
+		cfg            config.Config
+		wantStatusCode int
+		wantProgress   bool
+	}{
+		{
+			name:           "request timeout",
+			cfg:            config.Config{ProcessTimeout: time.Nanosecond},
+			wantStatusCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:           "image timeout",
+			cfg:            config.Config{ImageTimeout: time.Nanosecond},
+			wantStatusCode: http.StatusGatewayTimeout,
+			wantProgress:   true,
+		},
+		{
+			name:           "success within timeouts",
+			cfg:            config.Config{ProcessTimeout: time.Minute, ImageTimeout: time.Minute},
+			wantStatusCode: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, tt.cfg)
+
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, "/compress", formData{
+				isTypeFile: true,
+				label:      "files[]",
+				value:      ".././imagetest/cat.jpg",
+			})
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			if tt.wantProgress {
+				var resp struct {
+					Progress struct {
+						Processed int `json:"processed"`
+						Total     int `json:"total"`
+					} `json:"progress"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, 0, resp.Progress.Processed)
+				assert.Equal(t, 1, resp.Progress.Total)
+			}
+		})
+	}
+}
+
+func Test_imageHandler_ErrorResponse(t *testing.T) {
+	corruptPng := filepath.Join(t.TempDir(), "corrupt.png")
+	if err := os.WriteFile(corruptPng, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(middleware.RequestBodyLimiter(1 << 20))
+	if err := SetupImageRoute(router, Dependencies{}); err != nil {
+		t.Fatal(err)
+	}
+
+	intPtr := func(i int) *int { return &i }
+
+	var tests = []struct {
+		name           string
+		path           string
+		field          []formData
+		wantStatusCode int
+		want           dto.ErrorResponse
+	}{
+		{
+			name: "unsupported type",
+			path: "/compress",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"},
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/text.txt"},
+			},
+			wantStatusCode: http.StatusUnsupportedMediaType,
+			want: dto.ErrorResponse{
+				Code:      "UNSUPPORTED_TYPE",
+				Field:     "files[]",
+				FileIndex: intPtr(1),
+				Filename:  "text.txt",
+			},
+		},
+		{
+			name: "dimension too large",
+			path: "/resize",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: ".././imagetest/cat.jpg"},
+				{label: "height[]", value: "90"},
+				{label: "width[]", value: "100000"},
+			},
+			wantStatusCode: http.StatusUnprocessableEntity,
+			want: dto.ErrorResponse{
+				Code:      "DIMENSION_TOO_LARGE",
+				Field:     "width[]",
+				FileIndex: intPtr(0),
+			},
+		},
+		{
+			name: "decode failed",
+			path: "/compress",
+			field: []formData{
+				{isTypeFile: true, label: "files[]", value: corruptPng},
+			},
+			wantStatusCode: http.StatusUnprocessableEntity,
+			want: dto.ErrorResponse{
+				Code:      "DECODE_FAILED",
+				FileIndex: intPtr(0),
+				Filename:  "corrupt.png",
+			},
+		},
+		{
+			name: "body too large",
+			path: "/compress",
+			field: []formData{
+				{label: "urls[]", value: strings.Repeat("a", 2<<20)},
+			},
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+			want:           dto.ErrorResponse{Code: "BODY_TOO_LARGE"},
+		},
+		{
+			name:           "invalid request",
+			path:           "/compress",
+			wantStatusCode: http.StatusBadRequest,
+			want:           dto.ErrorResponse{Code: "INVALID_REQUEST", Field: "files[]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httpRequestWithFormData(t, http.MethodPost, tt.path, tt.field...)
+			router.ServeHTTP(w, req)
+
+			var resp dto.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.wantStatusCode, w.Code)
+			assert.NotEqual(t, "", resp.Error)
+			resp.Error = ""
+			assert.Equal(t, tt.want, resp)
+		})
+	}
+}
+
+func Test_megapixels(t *testing.T) {
+	read := func(path string) []byte {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	var tests = []struct {
+		name string
+		data []byte
+		want float64
+	}{
+		{
+			name: "png",
+			data: read(".././imagetest/flower.png"),
+			want: 640 * 609 / 1e6,
+		},
+		{
+			name: "webp",
+			data: read(".././usecase/probe.webp"),
+			want: 150 * 100 / 1e6,
+		},
+		{
+			name: "avif",
+			data: read(".././imagetest/photo.avif"),
+			want: 320 * 180 / 1e6,
+		},
+		{
+			name: "unknown size counts as the largest accepted",
+			data: []byte("\x89PNG broken"),
+			want: constants.MaxImageDimension * constants.MaxImageDimension / 1e6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, megapixels(tt.data))
 		})
 	}
 }
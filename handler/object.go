@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/storage"
+)
+
+// objectHandler serves objects of the local storage driver through the
+// presigned URLs it hands out.
+type objectHandler struct {
+	storage *storage.Local
+}
+
+func NewObjectHandler(localStorage *storage.Local) objectHandler {
+	return objectHandler{storage: localStorage}
+}
+
+func (h *objectHandler) GetObject(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	err := h.storage.Verify(key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	object, err := h.storage.Get(c.Request.Context(), key)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer object.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.DataFromReader(http.StatusOK, -1, contentType, object, nil)
+}
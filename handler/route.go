@@ -1,17 +1,136 @@
 package handler
 
 import (
+	"log/slog"
+
 	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/apikey"
+	"github.com/rizqo46/image-processing-go/archive"
+	"github.com/rizqo46/image-processing-go/cache"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/fetcher"
+	"github.com/rizqo46/image-processing-go/metrics"
+	"github.com/rizqo46/image-processing-go/ratelimit"
+	"github.com/rizqo46/image-processing-go/storage"
+	"github.com/rizqo46/image-processing-go/tus"
 	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/worker"
 )
 
-func SetupImageRoute(r *gin.Engine) {
-	imageUsecase := usecase.NewImageUsecase()
-	imageHandler := NewImageHandler(imageUsecase)
+// Dependencies are what SetupImageRoute wires the routes to. Nil fields
+// are built from Config.
+type Dependencies struct {
+	Config config.Config
+	// Usecase processes the images, by default usecase.ImageUsecase with
+	// the backend of Config.
+	Usecase usecase.Service
+	// Logger is the logger of the default usecase, slog.Default() if nil.
+	Logger *slog.Logger
+	// Storage stores the processed images when the request asks to. Without
+	// it the configured storage is used, if any.
+	Storage storage.Storage
+	// Workers bound image processing. The caller drains them on shutdown.
+	Workers *worker.Pool
+}
+
+// SetupImageRoute registers every route on r.
+func SetupImageRoute(r *gin.Engine, deps Dependencies) error {
+	cfg := deps.Config
+
+	serviceMetrics := metrics.New()
+	r.Use(serviceMetrics.Middleware())
+	r.GET("/metrics", gin.WrapH(serviceMetrics.Handler()))
+
+	responseCache, err := cache.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	objectStorage := deps.Storage
+	if objectStorage == nil {
+		objectStorage, err = storage.New(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	resumableUploads, err := tus.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	apiKeys, err := apikey.New(cfg)
+	if err != nil {
+		return err
+	}
 
+	// Rate limits and quotas apply per API key, so only with authentication.
+	var limiter *ratelimit.Limiter
+	if apiKeys != nil {
+		limiter = ratelimit.New(cfg)
+	}
+
+	workerPool := deps.Workers
+	if workerPool == nil {
+		workerPool = worker.New(cfg)
+	}
+
+	baseUsecase := deps.Usecase
+	if baseUsecase == nil {
+		backend, err := usecase.NewBackend(cfg.ImageBackend)
+		if err != nil {
+			return err
+		}
+		baseUsecase = usecase.NewImageUsecase().
+			WithBackend(backend).
+			WithLogger(deps.Logger).
+			WithImageTimeout(cfg.ImageTimeout)
+	}
+	imageUsecase := serviceMetrics.InstrumentUsecase(baseUsecase)
+	imageFetcher := fetcher.New(cfg)
+	archiveExtractor := archive.New(cfg)
+	imageHandler := NewImageHandler(imageUsecase, responseCache, objectStorage, imageFetcher, archiveExtractor, resumableUploads, workerPool, limiter, cfg)
+
+	healthHandler := NewHealthHandler(baseUsecase.BackendName(), baseUsecase.SelfCheck, baseUsecase.Capabilities, workerPool)
 	r.
+		GET("/healthz", healthHandler.Healthz).
+		GET("/readyz", healthHandler.Readyz).
+		GET("/version", healthHandler.Version).
+		GET("/openapi.json", OpenAPI).
+		GET("/docs", SwaggerUI).
+		GET("/docs/*file", SwaggerUIAsset)
+
+	api := r.Group("")
+	if apiKeys != nil {
+		authHandler := NewAuthHandler(apiKeys, limiter)
+		api.Use(authHandler.Authenticate)
+	}
+
+	api.
 		POST("/", imageHandler.ProcessImage).
 		POST("/png-to-jpeg", imageHandler.PngToJpeg).
 		POST("/compress", imageHandler.CompressImages).
-		POST("/resize", imageHandler.ResizeImages)
+		POST("/resize", imageHandler.ResizeImages).
+		POST("/crop", imageHandler.CropImages).
+		POST("/gif-frames", imageHandler.GifFrames).
+		POST("/tiff-pages", imageHandler.TiffPages).
+		POST("/compare", imageHandler.Compare)
+
+	if localStorage, ok := objectStorage.(*storage.Local); ok {
+		objectHandler := NewObjectHandler(localStorage)
+		r.GET("/objects/*key", objectHandler.GetObject)
+	}
+
+	if resumableUploads != nil {
+		tusHandler := NewTusHandler(resumableUploads, cfg.TusMaxSize)
+		api.Group("/files", tusHandler.Resumable).
+			OPTIONS("", tusHandler.Options).
+			POST("", tusHandler.Create).
+			OPTIONS("/:id", tusHandler.Options).
+			HEAD("/:id", tusHandler.Head).
+			PATCH("/:id", tusHandler.Patch).
+			DELETE("/:id", tusHandler.Delete)
+	}
+
+	return nil
 }
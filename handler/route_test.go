@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/config"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/usecase/usecasetest"
+	"github.com/rizqo46/image-processing-go/worker"
+)
+
+func newFakeRouter(t *testing.T, cfg config.Config, fake *usecasetest.Fake) *gin.Engine {
+	router := gin.New()
+	if err := SetupImageRoute(router, Dependencies{Config: cfg, Usecase: fake}); err != nil {
+		t.Fatal(err)
+	}
+
+	return router
+}
+
+func TestSetupImageRoute_usecaseErrors(t *testing.T) {
+	pngField := formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"}
+
+	var tests = []struct {
+		name      string
+		path      string
+		field     formData
+		err       error
+		wantCode  int
+		wantError apperror.Code
+		wantCalls []string
+	}{
+		{
+			name:      "success",
+			path:      "/png-to-jpeg",
+			field:     pngField,
+			wantCode:  http.StatusCreated,
+			wantCalls: []string{usecase.OperationPngToJpeg},
+		},
+		{
+			name:      "gif frames",
+			path:      "/gif-frames",
+			field:     formData{isTypeFile: true, label: "files[]", value: ".././imagetest/sticker.gif"},
+			wantCode:  http.StatusCreated,
+			wantCalls: []string{usecase.OperationFrames},
+		},
+		{
+			name:      "tiff pages",
+			path:      "/tiff-pages",
+			field:     formData{isTypeFile: true, label: "files[]", value: ".././imagetest/scan.tiff"},
+			wantCode:  http.StatusCreated,
+			wantCalls: []string{usecase.OperationPages},
+		},
+		{
+			name:      "unsupported type is refused before processing",
+			path:      "/compress",
+			field:     formData{isTypeFile: true, label: "files[]", value: ".././imagetest/text.txt"},
+			wantCode:  http.StatusUnsupportedMediaType,
+			wantError: apperror.CodeUnsupportedType,
+		},
+		{
+			name:  "decode failure",
+			path:  "/compress",
+			field: pngField,
+			err: &apperror.Error{
+				Code: apperror.CodeDecodeFailed, Err: usecase.ErrDecodeImage,
+			},
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: apperror.CodeDecodeFailed,
+			wantCalls: []string{usecase.OperationCompress},
+		},
+		{
+			name:      "timeout",
+			path:      "/compress",
+			field:     pngField,
+			err:       usecase.ErrImageTimeout,
+			wantCode:  http.StatusGatewayTimeout,
+			wantError: apperror.CodeTimeout,
+			wantCalls: []string{usecase.OperationCompress},
+		},
+		{
+			name:      "busy",
+			path:      "/compress",
+			field:     pngField,
+			err:       worker.ErrQueueFull,
+			wantCode:  http.StatusServiceUnavailable,
+			wantError: apperror.CodeServerBusy,
+			wantCalls: []string{usecase.OperationCompress},
+		},
+		{
+			name:      "unknown error",
+			path:      "/compress",
+			field:     pngField,
+			err:       errors.New("boom"),
+			wantCode:  http.StatusInternalServerError,
+			wantError: apperror.CodeInternal,
+			wantCalls: []string{usecase.OperationCompress},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &usecasetest.Fake{Err: tt.err}
+			router := newFakeRouter(t, config.Config{}, fake)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, tt.path, tt.field))
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantCalls, fake.Calls())
+
+			if tt.wantError == "" {
+				return
+			}
+
+			// Errors must not be replayed from caches.
+			assert.Equal(t, "", w.Header().Get("ETag"))
+			assert.Equal(t, "", w.Header().Get("Cache-Control"))
+
+			var resp dto.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, string(tt.wantError), resp.Code)
+		})
+	}
+}
+
+func TestSetupImageRoute_cachedResponseSkipsUsecase(t *testing.T) {
+	fake := &usecasetest.Fake{}
+	router := newFakeRouter(t, config.Config{
+		CacheBackend:  config.CacheBackendMemory,
+		CacheMaxBytes: 1 << 20,
+	}, fake)
+
+	field := formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"}
+	for _, wantXCache := range []string{"MISS", "HIT"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpRequestWithFormData(t, http.MethodPost, "/compress", field))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, wantXCache, w.Header().Get("X-Cache"))
+	}
+
+	assert.Equal(t, []string{usecase.OperationCompress}, fake.Calls())
+}
+
+func TestSetupImageRoute_readyzReportsSelfCheck(t *testing.T) {
+	fake := &usecasetest.Fake{SelfCheckErr: errors.New("jpeg: encode failed")}
+	router := newFakeRouter(t, config.Config{}, fake)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestSetupImageRoute_cancelledRequest(t *testing.T) {
+	fake := &usecasetest.Fake{}
+	router := newFakeRouter(t, config.Config{}, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	field := formData{isTypeFile: true, label: "files[]", value: ".././imagetest/flower.png"}
+	req := httpRequestWithFormData(t, http.MethodPost, "/compress", field).WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, apperror.StatusClientClosedRequest, w.Code)
+}
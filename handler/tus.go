@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/tus"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+
+	contentTypeOffsetOctetStream = "application/offset+octet-stream"
+)
+
+// TusUploadRoute receives the chunks of an upload. Its bodies are bounded
+// by the declared Upload-Length rather than the request body limit.
+const TusUploadRoute = "/files/:id"
+
+// tusHandler implements the core, creation, expiration and termination parts
+// of the tus resumable upload protocol. Completed uploads are referenced by
+// their ID in the upload_ids field of the processing endpoints.
+type tusHandler struct {
+	store   *tus.Store
+	maxSize int64
+}
+
+func NewTusHandler(store *tus.Store, maxSize int64) tusHandler {
+	return tusHandler{store: store, maxSize: maxSize}
+}
+
+// Resumable sets the Tus-Resumable header on every response and rejects
+// requests speaking another protocol version.
+func (h *tusHandler) Resumable(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		respondError(c, apperror.New(
+			apperror.CodePreconditionFailed,
+			fmt.Sprintf("unsupported Tus-Resumable version, only %s is supported", tusVersion),
+		).WithField("Tus-Resumable"))
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+func (h *tusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if h.maxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *tusHandler) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		respondError(c, apperror.New(apperror.CodeInvalidRequest, "Upload-Length must be a non-negative integer").
+			WithField("Upload-Length"))
+		return
+	}
+
+	if h.maxSize > 0 && length > h.maxSize {
+		respondError(c, apperror.New(
+			apperror.CodeBodyTooLarge, fmt.Sprintf("Upload-Length exceeds the maximum of %d bytes", h.maxSize),
+		).WithField("Upload-Length"))
+		return
+	}
+
+	metadata, err := tus.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		respondError(c, apperror.Wrap(apperror.CodeInvalidRequest, err).WithField("Upload-Metadata"))
+		return
+	}
+
+	info, err := h.store.Create(length, metadata)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Location", "/files/"+info.ID)
+	setUploadHeaders(c, info)
+	c.Status(http.StatusCreated)
+}
+
+func (h *tusHandler) Head(c *gin.Context) {
+	info, err := h.store.Info(c.Param("id"))
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+
+	c.Header("Upload-Length", strconv.FormatInt(info.Length, 10))
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, info)
+	c.Status(http.StatusOK)
+}
+
+func (h *tusHandler) Patch(c *gin.Context) {
+	if c.ContentType() != contentTypeOffsetOctetStream {
+		respondError(c, apperror.New(
+			apperror.CodeUnsupportedType, fmt.Sprintf("Content-Type must be %s", contentTypeOffsetOctetStream),
+		).WithField("Content-Type"))
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondError(c, apperror.New(apperror.CodeInvalidRequest, "Upload-Offset must be a non-negative integer").
+			WithField("Upload-Offset"))
+		return
+	}
+
+	info, err := h.store.Write(c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setUploadHeaders(c, info)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *tusHandler) Delete(c *gin.Context) {
+	err := h.store.Delete(c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func setUploadHeaders(c *gin.Context, info tus.Info) {
+	c.Header("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	c.Header("Upload-Expires", info.ExpiresAt.UTC().Format(http.TimeFormat))
+}
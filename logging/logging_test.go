@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name          string
+		ctx           context.Context
+		wantRequestID any
+	}{
+		{
+			name:          "with request id",
+			ctx:           WithRequestID(context.Background(), "abc-123"),
+			wantRequestID: "abc-123",
+		},
+		{
+			name:          "without request id",
+			ctx:           context.Background(),
+			wantRequestID: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			logger := New(buf, slog.LevelInfo).With("operation", "compress")
+			logger.InfoContext(tt.ctx, "image processed", "index", 0)
+
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, "image processed", record["msg"])
+			assert.Equal(t, "compress", record["operation"])
+			assert.Equal(t, tt.wantRequestID, record["request_id"])
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("debug"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("WARN"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("verbose"))
+}
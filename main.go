@@ -1,25 +1,118 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rizqo46/image-processing-go/cli"
+	"github.com/rizqo46/image-processing-go/config"
 	"github.com/rizqo46/image-processing-go/handler"
+	"github.com/rizqo46/image-processing-go/logging"
 	"github.com/rizqo46/image-processing-go/middleware"
+	"github.com/rizqo46/image-processing-go/worker"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	serve()
+}
+
+// runCLI runs a command on local files, logging only the errors of the
+// usecase since the command reports every file.
+func runCLI(args []string) int {
+	slog.SetDefault(logging.New(os.Stderr, slog.LevelError))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return cli.Main(ctx, args, os.Stdout, os.Stderr)
+}
+
+func serve() {
+	cfg := config.Load()
+
+	logger := logging.New(os.Stdout, logging.ParseLevel(cfg.LogLevel))
+	slog.SetDefault(logger)
+
 	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
-	r.Use(middleware.RequestBodyLimiter)
+	r := gin.New()
+	r.Use(
+		middleware.RequestID(),
+		middleware.AccessLog(logger),
+		gin.Recovery(),
+		middleware.RequestBodyLimiter(cfg.MaxBodyBytes, handler.TusUploadRoute),
+	)
+
+	workerPool := worker.New(cfg)
+	deps := handler.Dependencies{Config: cfg, Logger: logger, Workers: workerPool}
+	if err := handler.SetupImageRoute(r, deps); err != nil {
+		logger.Error("failed to set up routes", "error", err)
+		os.Exit(1)
+	}
 
-	handler.SetupImageRoute(r)
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening", "port", cfg.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process right away.
+	stop()
+
+	// Fail readiness first so that load balancers stop sending requests
+	// before the listener closes.
+	workerPool.Drain()
+	logger.Info("draining", "delay", cfg.DrainDelay, "timeout", cfg.DrainTimeout)
+	time.Sleep(cfg.DrainDelay)
+
+	if err := shutdown(srv, cfg.DrainTimeout); err != nil {
+		logger.Error("failed to drain in-flight requests", "error", err, "pool", workerPool.Stats())
+		os.Exit(1)
+	}
+
+	logger.Info("server stopped")
+}
+
+// shutdown stops accepting connections and waits up to timeout for the
+// in-flight and queued requests to complete, closing the remaining
+// connections once it expires. A zero timeout waits without limit.
+func shutdown(srv *http.Server, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	port := "8080"
-	envPort := os.Getenv("PORT")
-	if envPort != "" {
-		port = envPort
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.Join(err, srv.Close())
 	}
 
-	_ = r.Run(":" + port)
+	return err
 }
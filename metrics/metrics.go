@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	RejectBodyTooLarge    = "body_too_large"
+	RejectUnsupportedType = "unsupported_type"
+	RejectUnauthorized    = "unauthorized"
+	RejectRateLimited     = "rate_limited"
+)
+
+// Metrics holds the collectors of the service in a registry of its own, so
+// that several routers can live in the same process.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	rejected        *prometheus.CounterVec
+
+	operationDuration *prometheus.HistogramVec
+	stageDuration     *prometheus.HistogramVec
+	inputBytes        *prometheus.HistogramVec
+	outputBytes       *prometheus.HistogramVec
+	compressionRatio  *prometheus.HistogramVec
+	imagesProcessed   *prometheus.CounterVec
+	inFlight          *prometheus.GaugeVec
+}
+
+func New() *Metrics {
+	byteBuckets := prometheus.ExponentialBuckets(1<<10, 4, 10)
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_rejected_total",
+			Help: "Requests rejected because of their body, key or rate, by reason.",
+		}, []string{"reason"}),
+
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_operation_duration_seconds",
+			Help:    "Duration of an operation call, made once per image of a batch (twice for a comparison).",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"operation", "status"}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_stage_duration_seconds",
+			Help:    "Duration of the decode, process and encode stages of a single image.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		}, []string{"operation", "stage"}),
+		inputBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_input_bytes",
+			Help:    "Size of the images given to an operation.",
+			Buckets: byteBuckets,
+		}, []string{"operation"}),
+		outputBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_output_bytes",
+			Help:    "Size of the images produced by an operation.",
+			Buckets: byteBuckets,
+		}, []string{"operation"}),
+		compressionRatio: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_compression_ratio",
+			Help:    "Output size divided by input size of a single image.",
+			Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1, 1.5, 2, 4},
+		}, []string{"operation"}),
+		imagesProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "images_processed_total",
+			Help: "Images successfully processed by operation and input format.",
+		}, []string{"operation", "format"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "image_operations_in_flight",
+			Help: "Operation calls currently running, one per image being processed.",
+		}, []string{"operation"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.rejected,
+		m.operationDuration, m.stageDuration, m.inputBytes, m.outputBytes,
+		m.compressionRatio, m.imagesProcessed, m.inFlight,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and their latency by route. Requests refused
+// with 401, 413, 415 or 429 are also counted as rejected, once.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := c.Writer.Status()
+		labels := prometheus.Labels{
+			"route":  route,
+			"method": c.Request.Method,
+			"status": strconv.Itoa(status),
+		}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+
+		switch status {
+		case http.StatusUnauthorized:
+			m.Reject(RejectUnauthorized)
+		case http.StatusRequestEntityTooLarge:
+			m.Reject(RejectBodyTooLarge)
+		case http.StatusUnsupportedMediaType:
+			m.Reject(RejectUnsupportedType)
+		case http.StatusTooManyRequests:
+			m.Reject(RejectRateLimited)
+		}
+	}
+}
+
+func (m *Metrics) Reject(reason string) {
+	m.rejected.WithLabelValues(reason).Inc()
+}
+
+// ObserveStage implements usecase.StageObserver.
+func (m *Metrics) ObserveStage(operation, stage string, duration time.Duration) {
+	m.stageDuration.WithLabelValues(operation, stage).Observe(duration.Seconds())
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+// scrape returns the metrics of m in the exposition format.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   []string
+	}{
+		{
+			name:   "created",
+			path:   "/compress",
+			status: http.StatusCreated,
+			want:   []string{`http_requests_total{method="POST",route="/compress",status="201"} 1`},
+		},
+		{
+			name:   "unsupported type",
+			path:   "/compress",
+			status: http.StatusUnsupportedMediaType,
+			want: []string{
+				`http_requests_total{method="POST",route="/compress",status="415"} 1`,
+				`http_requests_rejected_total{reason="unsupported_type"} 1`,
+			},
+		},
+		{
+			name:   "body too large",
+			path:   "/compress",
+			status: http.StatusRequestEntityTooLarge,
+			want:   []string{`http_requests_rejected_total{reason="body_too_large"} 1`},
+		},
+		{
+			name:   "unauthorized",
+			path:   "/compress",
+			status: http.StatusUnauthorized,
+			want:   []string{`http_requests_rejected_total{reason="unauthorized"} 1`},
+		},
+		{
+			name:   "rate limited",
+			path:   "/compress",
+			status: http.StatusTooManyRequests,
+			want:   []string{`http_requests_rejected_total{reason="rate_limited"} 1`},
+		},
+		{
+			name:   "unmatched route",
+			path:   "/missing",
+			status: http.StatusNotFound,
+			want: []string{
+				`http_requests_total{method="POST",route="unmatched",status="404"} 1`,
+				`http_request_duration_seconds_count{method="POST",route="unmatched",status="404"} 1`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			router := gin.New()
+			router.Use(m.Middleware())
+			router.POST("/compress", func(c *gin.Context) {
+				c.Status(tt.status)
+			})
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tt.path, nil))
+
+			body := scrape(t, m)
+			for _, want := range tt.want {
+				assert.Equal(t, true, strings.Contains(body, want))
+			}
+			if tt.status < http.StatusBadRequest {
+				assert.Equal(t, false, strings.Contains(body, "http_requests_rejected_total{"))
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+)
+
+// ImageUsecase wraps a usecase.Service, recording the duration, sizes,
+// compression ratio and formats of every operation.
+type ImageUsecase struct {
+	next    usecase.Service
+	metrics *Metrics
+}
+
+// InstrumentUsecase wraps uc and, when it is a usecase.ImageUsecase, makes it
+// report its stage durations to m.
+func (m *Metrics) InstrumentUsecase(uc usecase.Service) ImageUsecase {
+	if imageUsecase, ok := uc.(usecase.ImageUsecase); ok {
+		uc = imageUsecase.WithObserver(m)
+	}
+
+	return ImageUsecase{next: uc, metrics: m}
+}
+
+// ValidateAndProcessFilesRequest is not instrumented: the middleware counts
+// the rejected requests, once, from their status.
+func (uc ImageUsecase) ValidateAndProcessFilesRequest(ctx context.Context, files []dto.File, allowedContentTypes ...string) ([]dto.ImageData, error) {
+	return uc.next.ValidateAndProcessFilesRequest(ctx, files, allowedContentTypes...)
+}
+
+// ValidateAndProcessReader is not instrumented either, archive entries it
+// refuses are skipped rather than rejected.
+func (uc ImageUsecase) ValidateAndProcessReader(ctx context.Context, filename string, r io.Reader, allowedContentTypes ...string) (dto.ImageData, error) {
+	return uc.next.ValidateAndProcessReader(ctx, filename, r, allowedContentTypes...)
+}
+
+func (uc ImageUsecase) ConvertPngToJpeg(ctx context.Context, req dto.ImageDataEncode) error {
+	return uc.instrument(usecase.OperationPngToJpeg, req.ImageDatas, func() error {
+		return uc.next.ConvertPngToJpeg(ctx, req)
+	})
+}
+
+func (uc ImageUsecase) CompressImages(ctx context.Context, req dto.ImageDataEncode) error {
+	return uc.instrument(usecase.OperationCompress, req.ImageDatas, func() error {
+		return uc.next.CompressImages(ctx, req)
+	})
+}
+
+func (uc ImageUsecase) ResizeImages(ctx context.Context, req dto.ImageDataResize) error {
+	return uc.instrument(usecase.OperationResize, req.ImageDatas, func() error {
+		return uc.next.ResizeImages(ctx, req)
+	})
+}
+
+func (uc ImageUsecase) ProcessImages(ctx context.Context, req dto.ImageDataResize) error {
+	return uc.instrument(usecase.OperationProcess, req.ImageDatas, func() error {
+		return uc.next.ProcessImages(ctx, req)
+	})
+}
+
+func (uc ImageUsecase) CropImages(ctx context.Context, req dto.ImageDataCrop) error {
+	return uc.instrument(usecase.OperationCrop, req.ImageDatas, func() error {
+		return uc.next.CropImages(ctx, req)
+	})
+}
+
+// ExtractFrames records the size of the frames, which replace the images.
+func (uc ImageUsecase) ExtractFrames(ctx context.Context, req dto.ImageDataFrames) ([]dto.ImageData, error) {
+	var frames []dto.ImageData
+	err := uc.instrumentOutputs(usecase.OperationFrames, req.ImageDatas, func() ([]dto.ImageData, error) {
+		var err error
+		frames, err = uc.next.ExtractFrames(ctx, req)
+		return frames, err
+	})
+
+	return frames, err
+}
+
+// SplitPages records the size of the pages, which replace the images.
+func (uc ImageUsecase) SplitPages(ctx context.Context, req dto.ImageDataPages) ([]dto.ImageData, error) {
+	var pages []dto.ImageData
+	err := uc.instrumentOutputs(usecase.OperationPages, req.ImageDatas, func() ([]dto.ImageData, error) {
+		var err error
+		pages, err = uc.next.SplitPages(ctx, req)
+		return pages, err
+	})
+
+	return pages, err
+}
+
+// Compare records the images compared, which have no output.
+func (uc ImageUsecase) Compare(ctx context.Context, reference, img dto.ImageData) (dto.CompareResponse, error) {
+	var resp dto.CompareResponse
+	err := uc.instrumentOutputs(usecase.OperationCompare, []dto.ImageData{reference, img}, func() ([]dto.ImageData, error) {
+		var err error
+		resp, err = uc.next.Compare(ctx, reference, img)
+		return nil, err
+	})
+
+	return resp, err
+}
+
+func (uc ImageUsecase) BackendName() string {
+	return uc.next.BackendName()
+}
+
+func (uc ImageUsecase) Capabilities() dto.Capabilities {
+	return uc.next.Capabilities()
+}
+
+func (uc ImageUsecase) SelfCheck() ([]string, error) {
+	return uc.next.SelfCheck()
+}
+
+// instrument runs operation, which processes images in place.
+func (uc ImageUsecase) instrument(operation string, images []dto.ImageData, run func() error) error {
+	return uc.instrumentOutputs(operation, images, func() ([]dto.ImageData, error) {
+		return images, run()
+	})
+}
+
+// instrumentOutputs runs operation, which processes images into the images
+// it returns. The compression ratio is only recorded when every image has
+// a single output.
+func (uc ImageUsecase) instrumentOutputs(operation string, images []dto.ImageData, run func() ([]dto.ImageData, error)) error {
+	m := uc.metrics
+	inFlight := m.inFlight.WithLabelValues(operation)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	inputSizes := make([]int, len(images))
+	formats := make([]string, len(images))
+	for i, image := range images {
+		inputSizes[i] = len(image.ImageBytes)
+		formats[i] = strings.TrimPrefix(image.ContentType, "image/")
+		m.inputBytes.WithLabelValues(operation).Observe(float64(inputSizes[i]))
+	}
+
+	start := time.Now()
+	outputs, err := run()
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.operationDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+
+	for i, output := range outputs {
+		m.outputBytes.WithLabelValues(operation).Observe(float64(len(output.ImageBytes)))
+		if len(outputs) == len(images) && inputSizes[i] > 0 {
+			m.compressionRatio.WithLabelValues(operation).Observe(float64(len(output.ImageBytes)) / float64(inputSizes[i]))
+		}
+	}
+	for _, format := range formats {
+		m.imagesProcessed.WithLabelValues(operation, format).Inc()
+	}
+
+	return nil
+}
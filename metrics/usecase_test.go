@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+	"github.com/rizqo46/image-processing-go/usecase/usecasetest"
+)
+
+func TestImageUsecase_instrument(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "processed",
+			want: []string{
+				`image_operation_duration_seconds_count{operation="compress",status="ok"} 1`,
+				`image_input_bytes_count{operation="compress"} 2`,
+				`image_output_bytes_count{operation="compress"} 2`,
+				`image_compression_ratio_count{operation="compress"} 2`,
+				`images_processed_total{format="jpeg",operation="compress"} 1`,
+				`images_processed_total{format="png",operation="compress"} 1`,
+				`image_operations_in_flight{operation="compress"} 0`,
+			},
+		},
+		{
+			name: "failed",
+			err:  errors.New("boom"),
+			want: []string{
+				`image_operation_duration_seconds_count{operation="compress",status="error"} 1`,
+				`image_input_bytes_count{operation="compress"} 2`,
+				`image_operations_in_flight{operation="compress"} 0`,
+			},
+			notWant: []string{"image_output_bytes_count{", "images_processed_total{"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			uc := m.InstrumentUsecase(&usecasetest.Fake{Err: tt.err})
+
+			err := uc.CompressImages(context.Background(), dto.ImageDataEncode{ImageDatas: []dto.ImageData{
+				{Filename: "flower.png", ContentType: constants.ContentTypeImagePng, ImageBytes: []byte("png")},
+				{Filename: "cat.jpg", ContentType: constants.ContentTypeImageJpeg, ImageBytes: []byte("jpeg")},
+			}})
+			assert.Equal(t, tt.err, err)
+
+			body := scrape(t, m)
+			for _, want := range tt.want {
+				assert.Equal(t, true, strings.Contains(body, want))
+			}
+			for _, notWant := range tt.notWant {
+				assert.Equal(t, false, strings.Contains(body, notWant))
+			}
+		})
+	}
+}
+
+func TestImageUsecase_validationIsNotRejection(t *testing.T) {
+	m := New()
+	uc := m.InstrumentUsecase(&usecasetest.Fake{})
+
+	_, err := uc.ValidateAndProcessReader(context.Background(), "notes.txt", strings.NewReader("notes"), constants.ContentTypeImagePng)
+	assert.Equal(t, true, errors.Is(err, usecase.ErrContentTypeNotAllowed))
+	assert.Equal(t, false, strings.Contains(scrape(t, m), "http_requests_rejected_total{"))
+}
@@ -2,10 +2,19 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RequestBodyLimiter(c *gin.Context) {
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(2<<20))
+// RequestBodyLimiter caps request bodies at maxBytes, except on the exempt
+// routes, given as registered, which bound their bodies themselves.
+func RequestBodyLimiter(maxBytes int64, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(exempt, c.FullPath()) {
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	}
 }
@@ -0,0 +1,208 @@
+// Package ratelimit limits, per API key, the rate of requests and of
+// megapixels processed with token buckets, and the requests per UTC day.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+var (
+	ErrRateLimited   = errors.New("rate limit exceeded")
+	ErrQuotaExceeded = errors.New("daily quota exceeded")
+)
+
+// LimitError is returned when a limit is reached, telling when to retry.
+type LimitError struct {
+	Err        error
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s, retry in %s", e.Err, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// Status describes a limit after a request. Reset is the time until the
+// limit is fully restored. A zero Limit means the limit is disabled.
+type Status struct {
+	Limit     int64
+	Remaining int64
+	Reset     time.Duration
+}
+
+// Result is the state of the limits of a key after a request.
+type Result struct {
+	Requests Status
+	Daily    Status
+}
+
+// Limiter keeps the buckets and quotas of every key seen. Zero rates and
+// quotas disable the corresponding limit.
+type Limiter struct {
+	requestRate    float64
+	requestBurst   float64
+	megapixelRate  float64
+	megapixelBurst float64
+	dailyQuota     int64
+	now            func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+type client struct {
+	requests   bucket
+	megapixels bucket
+	day        time.Time
+	dayCount   int64
+}
+
+func New(cfg config.Config) *Limiter {
+	return &Limiter{
+		requestRate:    cfg.RateLimitRequests,
+		requestBurst:   float64(cfg.RateLimitBurst),
+		megapixelRate:  cfg.RateLimitMegapixels,
+		megapixelBurst: cfg.RateLimitMegapixelsBurst,
+		dailyQuota:     cfg.DailyQuota,
+		now:            time.Now,
+		clients:        map[string]*client{},
+	}
+}
+
+func (l *Limiter) client(key string, now time.Time) *client {
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{
+			requests:   newBucket(l.requestRate, l.requestBurst, now),
+			megapixels: newBucket(l.megapixelRate, l.megapixelBurst, now),
+		}
+		l.clients[key] = c
+	}
+
+	if day := now.UTC().Truncate(24 * time.Hour); !c.day.Equal(day) {
+		c.day, c.dayCount = day, 0
+	}
+
+	return c
+}
+
+// Allow counts a request of key. The result is returned even when the
+// request is refused, so that clients always get the state of their limits.
+func (l *Limiter) Allow(key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	c := l.client(key, now)
+
+	untilTomorrow := c.day.Add(24 * time.Hour).Sub(now)
+	if l.dailyQuota > 0 && c.dayCount >= l.dailyQuota {
+		return l.result(c, now), &LimitError{
+			Err:        ErrQuotaExceeded,
+			Limit:      fmt.Sprintf("%d requests per day", l.dailyQuota),
+			RetryAfter: untilTomorrow,
+		}
+	}
+
+	if wait := c.requests.take(now, 1); wait > 0 {
+		return l.result(c, now), &LimitError{
+			Err:        ErrRateLimited,
+			Limit:      fmt.Sprintf("%g requests per second", l.requestRate),
+			RetryAfter: wait,
+		}
+	}
+
+	c.dayCount++
+	return l.result(c, now), nil
+}
+
+// AllowMegapixels takes megapixels from the bucket of key.
+func (l *Limiter) AllowMegapixels(key string, megapixels float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if wait := l.client(key, now).megapixels.take(now, megapixels); wait > 0 {
+		return &LimitError{
+			Err:        ErrRateLimited,
+			Limit:      fmt.Sprintf("%g megapixels per second", l.megapixelRate),
+			RetryAfter: wait,
+		}
+	}
+
+	return nil
+}
+
+func (l *Limiter) result(c *client, now time.Time) Result {
+	var result Result
+	if c.requests.enabled() {
+		result.Requests = Status{
+			Limit:     int64(c.requests.burst),
+			Remaining: int64(math.Max(0, math.Floor(c.requests.tokens))),
+			Reset:     c.requests.untilFull(),
+		}
+	}
+	if l.dailyQuota > 0 {
+		result.Daily = Status{
+			Limit:     l.dailyQuota,
+			Remaining: max(0, l.dailyQuota-c.dayCount),
+			Reset:     c.day.Add(24 * time.Hour).Sub(now),
+		}
+	}
+
+	return result
+}
+
+// bucket holds up to burst tokens, refilled at rate tokens per second.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst float64, now time.Time) bucket {
+	if burst <= 0 {
+		burst = math.Max(1, rate)
+	}
+
+	return bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) enabled() bool {
+	return b.rate > 0
+}
+
+// take takes n tokens, or returns how long to wait for them. Taking more
+// than burst tokens only needs a full bucket and leaves it in debt, so that
+// large requests are slowed down rather than refused forever.
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	if !b.enabled() {
+		return 0
+	}
+
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	needed := math.Min(n, b.burst)
+	if b.tokens < needed {
+		return time.Duration((needed - b.tokens) / b.rate * float64(time.Second))
+	}
+
+	b.tokens -= n
+	return 0
+}
+
+func (b *bucket) untilFull() time.Duration {
+	return time.Duration((b.burst - b.tokens) / b.rate * float64(time.Second))
+}
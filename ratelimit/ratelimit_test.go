@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(cfg config.Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)}
+	l := New(cfg)
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l, clock := newTestLimiter(config.Config{RateLimitRequests: 1, RateLimitBurst: 2})
+
+	for remaining := int64(1); remaining >= 0; remaining-- {
+		result, err := l.Allow("team-a")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, Status{Limit: 2, Remaining: remaining, Reset: time.Duration(2-remaining) * time.Second}, result.Requests)
+	}
+
+	result, err := l.Allow("team-a")
+	var limitErr *LimitError
+	assert.Equal(t, true, errors.As(err, &limitErr))
+	assert.Equal(t, true, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, time.Second, limitErr.RetryAfter)
+	assert.Equal(t, int64(0), result.Requests.Remaining)
+
+	// Keys have their own buckets.
+	_, err = l.Allow("team-b")
+	assert.Equal(t, nil, err)
+
+	clock.now = clock.now.Add(time.Second)
+	_, err = l.Allow("team-a")
+	assert.Equal(t, nil, err)
+}
+
+func TestLimiter_DailyQuota(t *testing.T) {
+	l, clock := newTestLimiter(config.Config{DailyQuota: 2})
+
+	for remaining := int64(1); remaining >= 0; remaining-- {
+		result, err := l.Allow("team-a")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, Status{Limit: 2, Remaining: remaining, Reset: time.Minute}, result.Daily)
+		assert.Equal(t, Status{}, result.Requests)
+	}
+
+	_, err := l.Allow("team-a")
+	var limitErr *LimitError
+	assert.Equal(t, true, errors.As(err, &limitErr))
+	assert.Equal(t, true, errors.Is(err, ErrQuotaExceeded))
+	assert.Equal(t, time.Minute, limitErr.RetryAfter)
+
+	// The quota is reset at midnight UTC.
+	clock.now = clock.now.Add(time.Minute)
+	result, err := l.Allow("team-a")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1), result.Daily.Remaining)
+}
+
+func TestLimiter_AllowMegapixels(t *testing.T) {
+	l, clock := newTestLimiter(config.Config{RateLimitMegapixels: 2, RateLimitMegapixelsBurst: 4})
+
+	assert.Equal(t, nil, l.AllowMegapixels("team-a", 3))
+
+	err := l.AllowMegapixels("team-a", 3)
+	var limitErr *LimitError
+	assert.Equal(t, true, errors.As(err, &limitErr))
+	assert.Equal(t, time.Second, limitErr.RetryAfter)
+
+	// Batches larger than the burst wait for a full bucket and leave it in
+	// debt.
+	clock.now = clock.now.Add(2 * time.Second)
+	assert.Equal(t, nil, l.AllowMegapixels("team-a", 10))
+	err = l.AllowMegapixels("team-a", 1)
+	assert.Equal(t, true, errors.As(err, &limitErr))
+	assert.Equal(t, 3500*time.Millisecond, limitErr.RetryAfter)
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l, _ := newTestLimiter(config.Config{})
+	for i := 0; i < 100; i++ {
+		result, err := l.Allow("team-a")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, Result{}, result)
+		assert.Equal(t, nil, l.AllowMegapixels("team-a", 1000))
+	}
+}
@@ -0,0 +1,386 @@
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	ErrExceedsLength  = errors.New("upload exceeds its declared length")
+	ErrIncomplete     = errors.New("upload is not complete")
+)
+
+// errExpired is the ErrNotFound of an expired upload, not removed yet.
+var errExpired = fmt.Errorf("%w: expired", ErrNotFound)
+
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type Info struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"-"`
+	Metadata  map[string]string `json:"metadata"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+func (i Info) Complete() bool {
+	return i.Offset == i.Length
+}
+
+// Filename is the name given by the client in the filename (or name)
+// metadata, falling back to the upload ID.
+func (i Info) Filename() string {
+	for _, key := range []string{"filename", "name"} {
+		if name := filepath.Base(i.Metadata[key]); i.Metadata[key] != "" && name != "." && name != "/" {
+			return name
+		}
+	}
+
+	return i.ID
+}
+
+// Store keeps uploads on local disk as a data file and a JSON info file per
+// upload. The current offset is the size of the data file.
+type Store struct {
+	dir    string
+	expiry time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+// uploadLock is the lock of an upload, dropped from Store.locks once its
+// last user is done with it.
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// New returns the store configured by cfg, or nil when resumable uploads
+// are disabled.
+func New(cfg config.Config) (*Store, error) {
+	if cfg.TusDir == "" {
+		return nil, nil
+	}
+
+	return NewStore(cfg.TusDir, cfg.TusExpiry)
+}
+
+func NewStore(dir string, expiry time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir, expiry: expiry, locks: map[string]*uploadLock{}}, nil
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *Store) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// lock serializes writes to a single upload, and its removal.
+func (s *Store) lock(id string) func() {
+	l := s.acquireLock(id)
+	l.Lock()
+	return func() { s.unlock(id, l) }
+}
+
+// tryLock is lock, failing instead of waiting for the upload to be
+// unlocked.
+func (s *Store) tryLock(id string) (func(), bool) {
+	l := s.acquireLock(id)
+	if !l.TryLock() {
+		s.releaseLock(id, l)
+		return nil, false
+	}
+
+	return func() { s.unlock(id, l) }, true
+}
+
+func (s *Store) unlock(id string, l *uploadLock) {
+	l.Unlock()
+	s.releaseLock(id, l)
+}
+
+// acquireLock returns the lock of an upload, shared by everyone holding or
+// waiting for it until they release it.
+func (s *Store) acquireLock(id string) *uploadLock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.locks[id]
+	if !ok {
+		l = &uploadLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+
+	return l
+}
+
+func (s *Store) releaseLock(id string, l *uploadLock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(s.locks, id)
+	}
+}
+
+func (s *Store) Create(length int64, metadata map[string]string) (Info, error) {
+	s.Sweep()
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return Info{}, err
+	}
+
+	info := Info{
+		ID:        hex.EncodeToString(idBytes),
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(s.expiry).UTC(),
+	}
+
+	data, err := os.OpenFile(s.dataPath(info.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return Info{}, err
+	}
+	data.Close()
+
+	if err := s.saveInfo(info); err != nil {
+		_ = os.Remove(s.dataPath(info.ID))
+		return Info{}, err
+	}
+
+	return info, nil
+}
+
+func (s *Store) saveInfo(info Info) error {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.infoPath(info.ID) + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.infoPath(info.ID))
+}
+
+// Info returns the state of an upload. Expired uploads are removed and
+// reported as not found.
+func (s *Store) Info(id string) (Info, error) {
+	info, err := s.load(id)
+	if errors.Is(err, errExpired) {
+		s.removeExpired(id)
+		return Info{}, ErrNotFound
+	}
+
+	return info, err
+}
+
+// load reads the state of an upload, failing with errExpired once it has
+// expired.
+func (s *Store) load(id string) (Info, error) {
+	if !idPattern.MatchString(id) {
+		return Info{}, ErrNotFound
+	}
+
+	raw, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	var info Info
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return Info{}, err
+	}
+
+	if time.Now().After(info.ExpiresAt) {
+		return Info{}, errExpired
+	}
+
+	stat, err := os.Stat(s.dataPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	info.Offset = stat.Size()
+	return info, nil
+}
+
+// Write appends r to the upload, which must currently be at offset. It
+// stops at the declared length and returns ErrExceedsLength if r has more
+// data. Every write extends the expiry of the upload.
+func (s *Store) Write(id string, offset int64, r io.Reader) (Info, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	info, err := s.loadLocked(id)
+	if err != nil {
+		return Info{}, err
+	}
+
+	if info.Offset != offset {
+		return info, ErrOffsetMismatch
+	}
+
+	data, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return info, err
+	}
+
+	// Whatever was received is kept even if the connection drops midway,
+	// so that the client can resume from there.
+	n, copyErr := io.Copy(data, io.LimitReader(r, info.Length-info.Offset))
+	closeErr := data.Close()
+	info.Offset += n
+
+	if copyErr == nil && closeErr == nil && info.Complete() {
+		var probe [1]byte
+		if m, _ := r.Read(probe[:]); m > 0 {
+			copyErr = ErrExceedsLength
+		}
+	}
+
+	info.ExpiresAt = time.Now().Add(s.expiry).UTC()
+	if err := s.saveInfo(info); err != nil {
+		return info, err
+	}
+
+	if copyErr != nil {
+		return info, copyErr
+	}
+
+	return info, closeErr
+}
+
+// Open returns a completed upload for reading.
+func (s *Store) Open(id string) (Info, *os.File, error) {
+	info, err := s.Info(id)
+	if err != nil {
+		return Info{}, nil, err
+	}
+
+	if !info.Complete() {
+		return info, nil, ErrIncomplete
+	}
+
+	file, err := os.Open(s.dataPath(id))
+	return info, file, err
+}
+
+func (s *Store) Delete(id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	if _, err := s.loadLocked(id); err != nil {
+		return err
+	}
+
+	return s.remove(id)
+}
+
+// loadLocked is load for the holder of the lock of the upload, removing it
+// once expired.
+func (s *Store) loadLocked(id string) (Info, error) {
+	info, err := s.load(id)
+	if errors.Is(err, errExpired) {
+		_ = s.remove(id)
+		return Info{}, ErrNotFound
+	}
+
+	return info, err
+}
+
+// removeExpired removes an upload if it is still expired once locked. An
+// upload locked by a write is left alone, the write extends its expiry.
+func (s *Store) removeExpired(id string) {
+	unlock, ok := s.tryLock(id)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	_, _ = s.loadLocked(id)
+}
+
+func (s *Store) remove(id string) error {
+	err := os.Remove(s.infoPath(id))
+	if dataErr := os.Remove(s.dataPath(id)); err == nil {
+		err = dataErr
+	}
+
+	return err
+}
+
+// Sweep removes expired uploads, but the ones being written.
+func (s *Store) Sweep() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			if _, err := s.load(id); errors.Is(err, errExpired) {
+				s.removeExpired(id)
+			}
+		}
+	}
+}
+
+// ParseMetadata decodes an Upload-Metadata header, a comma separated list of
+// keys each optionally followed by a space and a base64 encoded value.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("upload metadata key cannot be empty")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("upload metadata %q is not base64: %w", key, err)
+		}
+
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,206 @@
+package tus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestStore_Write(t *testing.T) {
+	var tests = []struct {
+		name       string
+		length     int64
+		chunks     []string
+		offsets    []int64
+		wantErr    error
+		wantOffset int64
+	}{
+		{
+			name:       "success in chunks",
+			length:     6,
+			chunks:     []string{"abc", "def"},
+			offsets:    []int64{0, 3},
+			wantOffset: 6,
+		},
+		{
+			name:       "error offset mismatch",
+			length:     6,
+			chunks:     []string{"abc", "def"},
+			offsets:    []int64{0, 1},
+			wantErr:    ErrOffsetMismatch,
+			wantOffset: 3,
+		},
+		{
+			name:       "error exceeds length keeps declared bytes",
+			length:     4,
+			chunks:     []string{"abcdef"},
+			offsets:    []int64{0},
+			wantErr:    ErrExceedsLength,
+			wantOffset: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(t.TempDir(), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := store.Create(tt.length, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, chunk := range tt.chunks {
+				info, err = store.Write(info.ID, tt.offsets[i], strings.NewReader(chunk))
+			}
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantOffset, info.Offset)
+		})
+	}
+}
+
+func TestStore_Open(t *testing.T) {
+	store, err := NewStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Create(5, map[string]string{"filename": "../scan.tiff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = store.Open(info.ID)
+	assert.Equal(t, ErrIncomplete, err)
+
+	if _, err := store.Write(info.ID, 0, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, file, err := store.Open(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	body, _ := io.ReadAll(file)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "scan.tiff", info.Filename())
+
+	_, _, err = store.Open("../" + info.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestStore_Expiry(t *testing.T) {
+	store, err := NewStore(t.TempDir(), -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Create(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Write(info.ID, 0, bytes.NewReader([]byte{1}))
+	assert.Equal(t, ErrNotFound, err)
+
+	store.Sweep()
+	_, err = store.Info(info.ID)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestStore_SweepLocked(t *testing.T) {
+	store, err := NewStore(t.TempDir(), -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Create(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An upload being written is not swept, even once expired.
+	unlock := store.lock(info.ID)
+	store.Sweep()
+	_, err = os.Stat(store.dataPath(info.ID))
+	assert.Equal(t, nil, err)
+	unlock()
+
+	store.Sweep()
+	_, err = os.Stat(store.dataPath(info.ID))
+	assert.Equal(t, true, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestStore_LockRemoved(t *testing.T) {
+	store, err := NewStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := store.Create(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing an upload keeps its lock until released, so that nobody else
+	// gets a second lock for it in the meantime.
+	unlock := store.lock(info.ID)
+	assert.Equal(t, nil, store.remove(info.ID))
+	_, ok := store.tryLock(info.ID)
+	assert.Equal(t, false, ok)
+	unlock()
+
+	assert.Equal(t, 0, len(store.locks))
+	unlock, ok = store.tryLock(info.ID)
+	assert.Equal(t, true, ok)
+	unlock()
+	assert.Equal(t, 0, len(store.locks))
+}
+
+func TestParseMetadata(t *testing.T) {
+	var tests = []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "success",
+			header: "filename c2Nhbi5wbmc=, is_confidential",
+			want:   map[string]string{"filename": "scan.png", "is_confidential": ""},
+		},
+		{
+			name:   "success empty",
+			header: "",
+			want:   map[string]string{},
+		},
+		{
+			name:    "error not base64",
+			header:  "filename scan.png",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetadata(tt.header)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+)
+
+var (
+	ErrTooManyParts  = errors.New("multipart form has too many parts")
+	ErrValueTooLarge = errors.New("multipart form values are too large")
+)
+
+const (
+	DefaultMaxValueBytes = 1 << 20
+	DefaultMaxParts      = 1000
+)
+
+type Options struct {
+	// SpoolThreshold is how many bytes of file content a single request may
+	// keep in memory; everything past it is written to temporary files.
+	SpoolThreshold int64
+	// MaxValueBytes caps the total size of the non-file fields, zero means
+	// DefaultMaxValueBytes.
+	MaxValueBytes int64
+	// MaxParts caps the number of parts, zero means DefaultMaxParts.
+	MaxParts int
+	TempDir  string
+}
+
+// File is an uploaded file held in memory or, past the spool threshold, in
+// a temporary file. It implements dto.File.
+type File struct {
+	name    string
+	size    int64
+	content []byte
+	tmpfile string
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Size() int64 {
+	return f.size
+}
+
+func (f *File) Open() (multipart.File, error) {
+	if f.tmpfile != "" {
+		return os.Open(f.tmpfile)
+	}
+
+	return sectionReadCloser{io.NewSectionReader(bytes.NewReader(f.content), 0, f.size)}, nil
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+}
+
+func (sectionReadCloser) Close() error {
+	return nil
+}
+
+// Form is a parsed multipart form. Its spooler keeps the files the request
+// goes on to spool within the same memory budget, until RemoveAll.
+type Form struct {
+	Value map[string][]string
+	File  map[string][]*File
+	*Spooler
+}
+
+// NewForm returns an empty form, for the files of requests that are not
+// multipart forms.
+func NewForm(opts Options) *Form {
+	return &Form{
+		Value:   map[string][]string{},
+		File:    map[string][]*File{},
+		Spooler: NewSpooler(opts.SpoolThreshold, opts.TempDir),
+	}
+}
+
+// RemoveAll deletes the temporary files of the form. It is safe to call on
+// a nil form.
+func (f *Form) RemoveAll() error {
+	if f == nil {
+		return nil
+	}
+
+	return f.Spooler.RemoveAll()
+}
+
+// Spooler keeps files in memory up to a budget shared by all of them, and
+// the rest in temporary files.
+type Spooler struct {
+	memoryLeft int64
+	tempDir    string
+	files      []*File
+}
+
+func NewSpooler(threshold int64, tempDir string) *Spooler {
+	return &Spooler{memoryLeft: threshold, tempDir: tempDir}
+}
+
+// Spool copies r to a new file named name.
+func (s *Spooler) Spool(name string, r io.Reader) (*File, error) {
+	w := s.Create(name)
+	if _, err := io.Copy(w, r); err != nil {
+		_, _ = w.Close()
+		return nil, err
+	}
+
+	return w.Close()
+}
+
+// Create returns a writer of a new file named name, available once the
+// writer is closed.
+func (s *Spooler) Create(name string) *Writer {
+	file := &File{name: name}
+	// Registered before anything is written so a partially written
+	// temporary file is still cleaned up.
+	s.files = append(s.files, file)
+	return &Writer{spooler: s, file: file}
+}
+
+// RemoveAll deletes the temporary files of the spooled files.
+func (s *Spooler) RemoveAll() error {
+	var err error
+	for _, file := range s.files {
+		if file.tmpfile == "" {
+			continue
+		}
+
+		if removeErr := os.Remove(file.tmpfile); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+
+	return err
+}
+
+// Writer writes a spooled file, in memory while the budget of its spooler
+// lasts and in a temporary file past it.
+type Writer struct {
+	spooler *Spooler
+	file    *File
+	buf     bytes.Buffer
+	tmp     *os.File
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.tmp == nil && int64(len(p)) <= w.spooler.memoryLeft {
+		w.spooler.memoryLeft -= int64(len(p))
+		w.file.size += int64(len(p))
+		return w.buf.Write(p)
+	}
+
+	if w.tmp == nil {
+		tmp, err := os.CreateTemp(w.spooler.tempDir, "upload-*")
+		if err != nil {
+			return 0, err
+		}
+		w.tmp = tmp
+		w.file.tmpfile = tmp.Name()
+
+		w.spooler.memoryLeft += int64(w.buf.Len())
+		if _, err := w.tmp.Write(w.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		w.buf = bytes.Buffer{}
+	}
+
+	n, err := w.tmp.Write(p)
+	w.file.size += int64(n)
+	return n, err
+}
+
+// Close completes the file.
+func (w *Writer) Close() (*File, error) {
+	if w.tmp == nil {
+		w.file.content = w.buf.Bytes()
+		return w.file, nil
+	}
+
+	return w.file, w.tmp.Close()
+}
+
+// Parse consumes r part by part. Unlike multipart.Reader.ReadForm it bounds
+// the memory of the whole request rather than per part kind: at most
+// opts.SpoolThreshold bytes of files and opts.MaxValueBytes of values are
+// kept in memory. On error the temporary files written so far are removed.
+func Parse(r *multipart.Reader, opts Options) (form *Form, err error) {
+	form = NewForm(opts)
+	defer func() {
+		if err != nil {
+			_ = form.RemoveAll()
+			form = nil
+		}
+	}()
+
+	if opts.MaxValueBytes <= 0 {
+		opts.MaxValueBytes = DefaultMaxValueBytes
+	}
+	if opts.MaxParts <= 0 {
+		opts.MaxParts = DefaultMaxParts
+	}
+
+	valueBytesLeft := opts.MaxValueBytes
+	for parts := 0; ; parts++ {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return form, err
+		}
+
+		if parts >= opts.MaxParts {
+			part.Close()
+			return form, ErrTooManyParts
+		}
+
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+
+		if part.FileName() == "" {
+			var value bytes.Buffer
+			n, err := io.CopyN(&value, part, valueBytesLeft+1)
+			part.Close()
+			if err != nil && err != io.EOF {
+				return form, err
+			}
+
+			valueBytesLeft -= n
+			if valueBytesLeft < 0 {
+				return form, ErrValueTooLarge
+			}
+
+			form.Value[name] = append(form.Value[name], value.String())
+			continue
+		}
+
+		file, err := form.Spool(part.FileName(), part)
+		part.Close()
+		if err != nil {
+			return form, err
+		}
+
+		form.File[name] = append(form.File[name], file)
+	}
+}
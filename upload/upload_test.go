@@ -0,0 +1,143 @@
+package upload
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+type part struct {
+	name     string
+	filename string
+	content  string
+}
+
+func multipartReader(parts ...part) *multipart.Reader {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var w io.Writer
+		if p.filename != "" {
+			w, _ = mw.CreateFormFile(p.name, p.filename)
+		} else {
+			w, _ = mw.CreateFormField(p.name)
+		}
+		_, _ = io.WriteString(w, p.content)
+	}
+	mw.Close()
+
+	return multipart.NewReader(&body, mw.Boundary())
+}
+
+func readFile(t *testing.T, f *File) string {
+	file, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestParse(t *testing.T) {
+	t.Run("spools files past the threshold", func(t *testing.T) {
+		dir := t.TempDir()
+		form, err := Parse(multipartReader(
+			part{name: "height[]", content: "30"},
+			part{name: "files[]", filename: "small.png", content: "0123"},
+			part{name: "files[]", filename: "large.png", content: "0123456789"},
+			part{name: "files[]", filename: "fits.png", content: "01"},
+			part{name: "width[]", content: "40"},
+		), Options{SpoolThreshold: 8, TempDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, map[string][]string{"height[]": {"30"}, "width[]": {"40"}}, form.Value)
+
+		files := form.File["files[]"]
+		assert.Equal(t, 3, len(files))
+		assert.Equal(t, "", files[0].tmpfile)
+		assert.NotEqual(t, "", files[1].tmpfile)
+		assert.Equal(t, "", files[2].tmpfile)
+
+		for i, want := range []string{"0123", "0123456789", "01"} {
+			assert.Equal(t, want, readFile(t, files[i]))
+			assert.Equal(t, int64(len(want)), files[i].Size())
+		}
+		assert.Equal(t, "large.png", files[1].Name())
+
+		assert.Equal(t, nil, form.RemoveAll())
+		entries, _ := os.ReadDir(dir)
+		assert.Equal(t, 0, len(entries))
+	})
+
+	t.Run("too many parts", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := Parse(multipartReader(
+			part{name: "files[]", filename: "a.png", content: "0123456789"},
+			part{name: "files[]", filename: "b.png", content: "0123456789"},
+		), Options{MaxParts: 1, TempDir: dir})
+		assert.Equal(t, ErrTooManyParts, err)
+
+		entries, _ := os.ReadDir(dir)
+		assert.Equal(t, 0, len(entries))
+	})
+
+	t.Run("values too large", func(t *testing.T) {
+		_, err := Parse(multipartReader(
+			part{name: "height[]", content: strings.Repeat("1", 8)},
+			part{name: "width[]", content: strings.Repeat("1", 8)},
+		), Options{MaxValueBytes: 10})
+		assert.Equal(t, ErrValueTooLarge, err)
+	})
+}
+
+func TestSpooler(t *testing.T) {
+	dir := t.TempDir()
+	spooler := NewSpooler(8, dir)
+
+	// Written in chunks, a file moves to disk once past the budget, which it
+	// gives back.
+	w := spooler.Create("response.zip")
+	for _, chunk := range []string{"0123", "4567", "89"} {
+		if _, err := io.WriteString(w, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	large, err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, "", large.tmpfile)
+	assert.Equal(t, int64(10), large.Size())
+	assert.Equal(t, "0123456789", readFile(t, large))
+
+	small, err := spooler.Spool("entry.png", strings.NewReader("01234567"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", small.tmpfile)
+	assert.Equal(t, "01234567", readFile(t, small))
+
+	// The budget is spent.
+	spilled, err := spooler.Spool("next.png", strings.NewReader("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, "", spilled.tmpfile)
+
+	assert.Equal(t, nil, spooler.RemoveAll())
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 0, len(entries))
+}
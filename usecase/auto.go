@@ -0,0 +1,210 @@
+package usecase
+
+import (
+	"fmt"
+	"image"
+	"slices"
+
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// autoMinSSIM is the structural similarity to the image the lossy
+// encodings chosen by the auto format keep at least, unless the request
+// asks for another.
+const autoMinSSIM = 0.98
+
+// autoQualities are the qualities the auto format tries for lossy formats,
+// from the smallest output up.
+var autoQualities = []int{40, 55, 70, 80, 90}
+
+// autoFormats are the formats the auto format chooses from, the first
+// winning outputs of the same size. Only png is lossless, and jpeg can't
+// hold transparency.
+var autoFormats = []string{
+	constants.ContentTypeImageJpeg, constants.ContentTypeImagePng,
+	constants.ContentTypeImageWebp, constants.ContentTypeImageAvif,
+}
+
+// universalFormats are accepted by every client, whatever its Accept
+// header.
+var universalFormats = []string{constants.ContentTypeImageJpeg, constants.ContentTypeImagePng}
+
+// lossyFormats are the formats that degrade the images they encode.
+var lossyFormats = []string{
+	constants.ContentTypeImageJpeg, constants.ContentTypeImageWebp, constants.ContentTypeImageAvif,
+}
+
+// encoding is an encoded image. Auto is set by the auto format, quality when
+// it was chosen for an SSIM, and score compares lossy outputs to the image
+// encoded.
+type encoding struct {
+	data    []byte
+	opts    EncodeOptions
+	auto    bool
+	quality int
+	score   *qualityScore
+}
+
+// encodeOutput encodes img with opts, with the quality keeping the SSIM req
+// asks for, or with the encoding the auto format chooses when req asks for
+// it. Lossy outputs are scored when req asks for it. Images whose pixels
+// can't be read are left unscored, and encoded with opts.
+func encodeOutput(backend Backend, img Image, opts EncodeOptions, req dto.EncodeRequest) (encoding, error) {
+	if req.Format == dto.EncodeFormatAuto {
+		return encodeAuto(backend, img, req)
+	}
+	if req.SSIM > 0 && slices.Contains(targetFormats, opts.ContentType) {
+		if pixels, err := backend.Pixels(img); err == nil {
+			return searchQuality(backend, img, opts, newLumaPlane(pixels), req.SSIM)
+		}
+	}
+
+	data, err := backend.Encode(img, opts)
+	if err != nil {
+		return encoding{}, err
+	}
+
+	out := encoding{data: data, opts: opts}
+	if !req.Score || !slices.Contains(lossyFormats, opts.ContentType) {
+		return out, nil
+	}
+	if pixels, err := backend.Pixels(img); err == nil {
+		if score, err := scoreEncoded(backend, data, newLumaPlane(pixels)); err == nil {
+			out.score = &score
+		}
+	}
+
+	return out, nil
+}
+
+// encodeAuto encodes img in every format of autoFormats that req accepts and
+// backend encodes, lossy ones at the lowest of autoQualities keeping
+// autoMinSSIM or the SSIM of req, and returns the smallest output. Without the pixels of img,
+// lossy formats can't be scored and png is chosen.
+func encodeAuto(backend Backend, img Image, req dto.EncodeRequest) (encoding, error) {
+	var reference *lumaPlane
+	opaque := false
+	if pixels, err := backend.Pixels(img); err == nil {
+		plane := newLumaPlane(pixels)
+		reference, opaque = &plane, isOpaque(pixels)
+	}
+
+	minSSIM := autoMinSSIM
+	if req.SSIM > 0 {
+		minSSIM = req.SSIM
+	}
+
+	var best encoding
+	for _, contentType := range autoFormats {
+		if !slices.Contains(universalFormats, contentType) && !slices.Contains(req.Accept, contentType) ||
+			!backend.CanEncode(contentType) ||
+			contentType == constants.ContentTypeImageJpeg && !opaque {
+			continue
+		}
+
+		opts, ok := compressOptions[contentType]
+		if !ok {
+			opts = EncodeOptions{ContentType: contentType}
+		}
+		if req.Speed > 0 {
+			opts.AvifSpeed = req.Speed
+		}
+
+		if contentType == constants.ContentTypeImagePng {
+			data, err := backend.Encode(img, opts)
+			if err != nil {
+				return encoding{}, err
+			}
+			best = smallest(best, encoding{data: data, opts: opts, auto: true})
+			continue
+		}
+		if reference == nil {
+			continue
+		}
+
+		for _, quality := range autoQualities {
+			lossy := withQuality(opts, quality)
+			data, err := backend.Encode(img, lossy)
+			if err != nil {
+				return encoding{}, err
+			}
+			// Higher qualities only get larger.
+			if best.data != nil && len(data) >= len(best.data) {
+				break
+			}
+
+			score, err := scoreEncoded(backend, data, *reference)
+			if err != nil {
+				return encoding{}, err
+			}
+			if score.ssim >= minSSIM {
+				best = smallest(best, encoding{data: data, opts: lossy, auto: true, quality: quality, score: &score})
+				break
+			}
+		}
+	}
+
+	if best.data == nil {
+		return encoding{}, fmt.Errorf("%w: no format for auto", ErrEncodeFormat)
+	}
+
+	return best, nil
+}
+
+// smallest returns the smallest of a and b, b only when strictly smaller.
+func smallest(a, b encoding) encoding {
+	if a.data == nil || len(b.data) < len(a.data) {
+		return b
+	}
+
+	return a
+}
+
+// withQuality returns opts with the quality of its lossy format.
+func withQuality(opts EncodeOptions, quality int) EncodeOptions {
+	switch opts.ContentType {
+	case constants.ContentTypeImageJpeg:
+		opts.JpegQuality = quality
+	case constants.ContentTypeImageWebp:
+		opts.WebpQuality = quality
+	case constants.ContentTypeImageAvif:
+		opts.AvifQuality = quality
+	}
+
+	return opts
+}
+
+// scoreEncoded compares the image encoded as data to reference.
+func scoreEncoded(backend Backend, data []byte, reference lumaPlane) (qualityScore, error) {
+	decoded, err := backend.Decode(data, DecodeUnchanged)
+	if err != nil {
+		return qualityScore{}, fmt.Errorf("decode encoded image: %w", err)
+	}
+	defer decoded.Close()
+
+	pixels, err := backend.Pixels(decoded)
+	if err != nil {
+		return qualityScore{}, err
+	}
+
+	return score(reference, newLumaPlane(pixels)), nil
+}
+
+// isOpaque tells whether every pixel of img is opaque.
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+
+	return true
+}
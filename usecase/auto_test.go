@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+func Test_ssim(t *testing.T) {
+	gradient := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range gradient.Pix {
+		gradient.Pix[i] = uint8(i % 256)
+	}
+	noisy := image.NewGray(gradient.Rect)
+	copy(noisy.Pix, gradient.Pix)
+	for i := 0; i < len(noisy.Pix); i += 3 {
+		noisy.Pix[i] ^= 0x40
+	}
+
+	assert.Equal(t, 1.0, ssim(newLumaPlane(gradient), newLumaPlane(gradient)))
+	assert.Equal(t, true, ssim(newLumaPlane(gradient), newLumaPlane(noisy)) < 0.9)
+
+	// Transparent pixels are drawn over white.
+	transparent := newLumaPlane(image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	assert.Equal(t, 255.0, transparent.pix[0])
+	// Images smaller than a window are a single window.
+	assert.Equal(t, 1.0, ssim(transparent, transparent))
+}
+
+func TestImageUsecase_autoFormat(t *testing.T) {
+	var tests = []struct {
+		name      string
+		path      string
+		accept    []string
+		wantTypes []string
+	}{
+		{
+			name:      "photo",
+			path:      "../imagetest/cat.jpg",
+			accept:    []string{constants.ContentTypeImageWebp, constants.ContentTypeImageAvif},
+			wantTypes: []string{constants.ContentTypeImageJpeg, constants.ContentTypeImageWebp, constants.ContentTypeImageAvif},
+		},
+		{
+			name:      "photo without accept",
+			path:      "../imagetest/cat.jpg",
+			wantTypes: []string{constants.ContentTypeImageJpeg, constants.ContentTypeImagePng},
+		},
+		{
+			name:      "transparent image",
+			path:      "../imagetest/flower.png",
+			accept:    []string{constants.ContentTypeImageWebp},
+			wantTypes: []string{constants.ContentTypeImagePng, constants.ContentTypeImageWebp},
+		},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				images := generateImageDatas(t, tt.path)
+				inputBytes := len(images[0].ImageBytes)
+				req := dto.ImageDataEncode{
+					EncodeRequest: dto.EncodeRequest{Format: dto.EncodeFormatAuto, Accept: tt.accept},
+					ImageDatas:    images,
+				}
+				if err := NewImageUsecase().WithBackend(backend).CompressImages(context.Background(), req); err != nil {
+					t.Fatal(err)
+				}
+
+				output := req.ImageDatas[0]
+				choice := output.AutoFormat
+				assert.NotEqual(t, nil, choice)
+				assert.Equal(t, true, slices.Contains(tt.wantTypes, choice.ContentType))
+				assert.Equal(t, choice.ContentType, output.ContentType)
+				assert.Equal(t, choice.ContentType, DetectContentType(output.ImageBytes))
+				assert.Equal(t, choice.Filename, output.Filename)
+				assert.Equal(t, inputBytes, choice.InputBytes)
+				assert.Equal(t, len(output.ImageBytes), choice.OutputBytes)
+				assert.Equal(t, 1-float64(choice.OutputBytes)/float64(inputBytes), choice.Savings)
+				assert.Equal(t, true, choice.SSIM >= autoMinSSIM)
+				if choice.ContentType == constants.ContentTypeImagePng {
+					assert.Equal(t, 0, choice.Quality)
+				} else {
+					assert.Equal(t, true, slices.Contains(autoQualities, choice.Quality))
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// AVIF files are ISO base media files: boxes, each a 32-bit size and a
+// 4 byte type, nested. The size of the images they hold is in the image
+// spatial extents (ispe) properties of the item properties (iprp, ipco)
+// of the meta box. There is no Go AVIF decoder to read it.
+
+// avifSize returns the size of the largest image of an avif file, to count
+// grids by their full size rather than by a tile.
+func avifSize(data []byte) (width, height int, err error) {
+	meta, ok := findBox(data, "meta")
+	if !ok || len(meta) < 4 {
+		return 0, 0, fmt.Errorf("%w: avif has no meta box", ErrDecodeImage)
+	}
+	// Meta is a full box, starting with a version and flags.
+	iprp, ok := findBox(meta[4:], "iprp")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: avif has no item properties", ErrDecodeImage)
+	}
+	ipco, ok := findBox(iprp, "ipco")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: avif has no item properties", ErrDecodeImage)
+	}
+
+	eachBox(ipco, func(boxType string, payload []byte) {
+		if boxType != "ispe" || len(payload) < 12 {
+			return
+		}
+		w, h := int(binary.BigEndian.Uint32(payload[4:8])), int(binary.BigEndian.Uint32(payload[8:12]))
+		if w*h > width*height {
+			width, height = w, h
+		}
+	})
+	if width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("%w: avif has no image size", ErrDecodeImage)
+	}
+
+	return width, height, nil
+}
+
+// findBox returns the payload of the first box of data of type boxType.
+func findBox(data []byte, boxType string) ([]byte, bool) {
+	var found []byte
+	ok := false
+	eachBox(data, func(t string, payload []byte) {
+		if !ok && t == boxType {
+			found, ok = payload, true
+		}
+	})
+
+	return found, ok
+}
+
+// eachBox calls box with the type and payload of every box of data, up to
+// the first truncated one.
+func eachBox(data []byte, box func(boxType string, payload []byte)) {
+	for len(data) >= 8 {
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+
+		box(string(data[4:8]), data[header:size])
+		data = data[size:]
+	}
+}
@@ -0,0 +1,49 @@
+package usecase
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	var tests = []struct {
+		path       string
+		wantWidth  int
+		wantHeight int
+		wantErr    bool
+	}{
+		{path: "../imagetest/photo.avif", wantWidth: 320, wantHeight: 180},
+		{path: "probe.webp", wantWidth: 150, wantHeight: 100},
+		{path: "../imagetest/flower.png", wantWidth: 640, wantHeight: 609},
+		{path: "../imagetest/text.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := DecodeConfig(data)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantWidth, config.Width)
+			assert.Equal(t, tt.wantHeight, config.Height)
+		})
+	}
+}
+
+func Test_avifSize(t *testing.T) {
+	data, err := os.ReadFile("../imagetest/photo.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncated files have no size, whatever the box sizes claim.
+	for _, n := range []int{12, 64, 200} {
+		_, _, err := avifSize(data[:n])
+		assert.NotEqual(t, nil, err)
+	}
+}
@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+)
+
+const (
+	BackendOpenCV = "opencv"
+	BackendGo     = "go"
+)
+
+var (
+	ErrUnknownBackend   = errors.New("unknown image backend")
+	ErrEncodeFormat     = errors.New("no encoder for the format")
+	ErrCodecUnavailable = errors.New("codec not available in this build")
+)
+
+// DecodeMode tells a Backend how to decode an image.
+type DecodeMode int
+
+const (
+	// DecodeUnchanged keeps the channels and depth of the image.
+	DecodeUnchanged DecodeMode = iota
+	// DecodeColor converts the image to 8-bit color, dropping its alpha.
+	DecodeColor
+)
+
+// Image is a decoded image, only usable with the Backend that decoded it.
+type Image interface {
+	Size() (width, height int)
+	Close() error
+}
+
+// EncodeOptions are the format, a content type, and its parameters. Zero
+// parameters leave the codec default.
+type EncodeOptions struct {
+	ContentType string
+	// JpegQuality is the quality of jpeg images, from 1 to 100.
+	JpegQuality int
+	// PngCompression is the compression level of png images, from 1 to 9.
+	PngCompression int
+	// WebpQuality is the quality of webp images, from 1 to 100.
+	WebpQuality int
+	// AvifQuality is the quality of avif images, from 1 to 100.
+	AvifQuality int
+	// AvifSpeed is the encoding speed of avif images, from 1, the slowest
+	// and smallest, to 10.
+	AvifSpeed int
+}
+
+// Backend decodes, transforms and encodes the images of ImageUsecase. Decode
+// fails with ErrDecodeImage on data it can't decode and Encode with
+// ErrEncodeFormat on formats it has no encoder for.
+type Backend interface {
+	Name() string
+	// CanDecode and CanEncode tell whether the backend, as built, has a
+	// decoder and an encoder for contentType.
+	CanDecode(contentType string) bool
+	CanEncode(contentType string) bool
+	Decode(data []byte, mode DecodeMode) (Image, error)
+	// Resize scales img to width and height with bicubic interpolation.
+	Resize(img Image, width, height int) (Image, error)
+	// Crop returns the part of img within rect, which lies within img.
+	Crop(img Image, rect image.Rectangle) (Image, error)
+	Encode(img Image, opts EncodeOptions) ([]byte, error)
+	// Pixels returns the pixels of img, failing on depths image.Image
+	// can't hold.
+	Pixels(img Image) (image.Image, error)
+}
+
+// backends are the backends compiled in, by name. The OpenCV one needs cgo
+// and is left out by the purego build tag.
+var backends = map[string]Backend{
+	BackendGo: goBackend{},
+}
+
+// Backends returns the names of the backends compiled in.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewBackend returns the backend called name. Without a name it is the
+// OpenCV backend when compiled in, the Go one otherwise.
+func NewBackend(name string) (Backend, error) {
+	if name == "" {
+		name = BackendGo
+		if _, ok := backends[BackendOpenCV]; ok {
+			name = BackendOpenCV
+		}
+	}
+
+	backend, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, compiled in are %v", ErrUnknownBackend, name, Backends())
+	}
+
+	return backend, nil
+}
@@ -0,0 +1,150 @@
+package usecase
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/rizqo46/image-processing-go/constants"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+)
+
+// goBackend processes images with the standard library codecs and the
+// scalers of golang.org/x/image/draw, without cgo.
+type goBackend struct{}
+
+type goImage struct {
+	img image.Image
+}
+
+func (img goImage) Size() (width, height int) {
+	return img.img.Bounds().Dx(), img.img.Bounds().Dy()
+}
+
+func (goImage) Close() error {
+	return nil
+}
+
+// goDefaultJpegQuality matches the default of OpenCV rather than the one
+// of image/jpeg.
+const goDefaultJpegQuality = 95
+
+func (goBackend) Name() string {
+	return BackendGo
+}
+
+func (goBackend) CanDecode(contentType string) bool {
+	switch contentType {
+	case constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageGif,
+		constants.ContentTypeImageTiff, constants.ContentTypeImageBmp:
+		return true
+	}
+
+	return false
+}
+
+// CanEncode is false for gif, encoded by ImageUsecase itself, and for avif,
+// which has no Go encoder.
+func (goBackend) CanEncode(contentType string) bool {
+	switch contentType {
+	case constants.ContentTypeImagePng, constants.ContentTypeImageJpeg,
+		constants.ContentTypeImageTiff, constants.ContentTypeImageBmp:
+		return true
+	}
+
+	return false
+}
+
+func (goBackend) Decode(data []byte, mode DecodeMode) (Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecodeImage, err)
+	}
+
+	if mode == DecodeColor {
+		img = dropAlpha(img)
+	}
+
+	return goImage{img: img}, nil
+}
+
+// dropAlpha returns the colors of img, made opaque.
+func dropAlpha(img image.Image) image.Image {
+	bounds := img.Bounds()
+	opaque := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(opaque, opaque.Bounds(), img, bounds.Min, draw.Src)
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 0xff
+	}
+
+	return opaque
+}
+
+func (goBackend) Resize(img Image, width, height int) (Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+
+	src := img.(goImage).img
+	resized := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	return goImage{img: resized}, nil
+}
+
+func (goBackend) Crop(img Image, rect image.Rectangle) (Image, error) {
+	src := img.(goImage).img
+	rect = rect.Add(src.Bounds().Min)
+	cropped := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), src, rect.Min, draw.Src)
+
+	return goImage{img: cropped}, nil
+}
+
+func (goBackend) Encode(img Image, opts EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch opts.ContentType {
+	case constants.ContentTypeImagePng:
+		encoder := png.Encoder{CompressionLevel: goPngCompression(opts.PngCompression)}
+		err = encoder.Encode(&buf, img.(goImage).img)
+	case constants.ContentTypeImageJpeg:
+		quality := opts.JpegQuality
+		if quality <= 0 {
+			quality = goDefaultJpegQuality
+		}
+		err = jpeg.Encode(&buf, img.(goImage).img, &jpeg.Options{Quality: quality})
+	case constants.ContentTypeImageTiff:
+		err = tiff.Encode(&buf, img.(goImage).img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	case constants.ContentTypeImageBmp:
+		err = bmp.Encode(&buf, img.(goImage).img)
+	default:
+		return nil, fmt.Errorf("%w %s", ErrEncodeFormat, opts.ContentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// goPngCompression maps the zlib levels of OpenCV to the fewer levels of
+// image/png. Like OpenCV, it defaults to the fastest.
+func goPngCompression(level int) png.CompressionLevel {
+	switch {
+	case level <= 3:
+		return png.BestSpeed
+	case level <= 6:
+		return png.DefaultCompression
+	default:
+		return png.BestCompression
+	}
+}
+
+func (goBackend) Pixels(img Image) (image.Image, error) {
+	return img.(goImage).img, nil
+}
@@ -0,0 +1,182 @@
+//go:build !purego
+
+package usecase
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/rizqo46/image-processing-go/constants"
+	"gocv.io/x/gocv"
+)
+
+func init() {
+	backends[BackendOpenCV] = opencvBackend{}
+}
+
+// opencvBackend processes images with OpenCV, through cgo.
+type opencvBackend struct{}
+
+type matImage struct {
+	mat gocv.Mat
+}
+
+func (img matImage) Size() (width, height int) {
+	return img.mat.Cols(), img.mat.Rows()
+}
+
+func (img matImage) Close() error {
+	return img.mat.Close()
+}
+
+var opencvDecodeFlags = map[DecodeMode]gocv.IMReadFlag{
+	DecodeUnchanged: gocv.IMReadUnchanged,
+	DecodeColor:     gocv.IMReadAnyColor,
+}
+
+// opencvFileExts are the encoders by content type. gocv only has constants
+// for some of the extensions OpenCV knows.
+var opencvFileExts = map[string]gocv.FileExt{
+	constants.ContentTypeImagePng:  gocv.PNGFileExt,
+	constants.ContentTypeImageJpeg: gocv.JPEGFileExt,
+	constants.ContentTypeImageTiff: gocv.FileExt(".tiff"),
+	constants.ContentTypeImageBmp:  gocv.FileExt(".bmp"),
+	constants.ContentTypeImageWebp: gocv.FileExt(".webp"),
+	constants.ContentTypeImageAvif: gocv.FileExt(".avif"),
+}
+
+// The avif parameters of cv::imwrite, which gocv has no constants for.
+const (
+	opencvImwriteAvifQuality = 512
+	opencvImwriteAvifSpeed   = 514
+)
+
+// probe.webp and probe.avif are small images of the formats OpenCV has only
+// when built with their library, which gocv can't tell: cv::imencode aborts
+// the process on formats it has no encoder for, while cv::imdecode returns
+// an empty image. The decoder and the encoder are built together, so
+// decoding a probe tells whether both are there.
+var (
+	//go:embed probe.webp
+	probeWebp []byte
+	//go:embed probe.avif
+	probeAvif []byte
+)
+
+// opencvOptionalCodecs tell, by content type, whether the codecs OpenCV
+// may be built without are there.
+var opencvOptionalCodecs = map[string]func() bool{
+	constants.ContentTypeImageWebp: sync.OnceValue(func() bool { return opencvDecodes(probeWebp) }),
+	constants.ContentTypeImageAvif: sync.OnceValue(func() bool { return opencvDecodes(probeAvif) }),
+}
+
+func opencvDecodes(data []byte) bool {
+	mat, err := gocv.IMDecode(data, gocv.IMReadUnchanged)
+	if err != nil {
+		return false
+	}
+	defer mat.Close()
+
+	return !mat.Empty()
+}
+
+func (opencvBackend) Name() string {
+	return BackendOpenCV
+}
+
+func (opencvBackend) CanDecode(contentType string) bool {
+	return opencvBackend{}.CanEncode(contentType)
+}
+
+func (opencvBackend) CanEncode(contentType string) bool {
+	if available, ok := opencvOptionalCodecs[contentType]; ok {
+		return available()
+	}
+
+	_, ok := opencvFileExts[contentType]
+	return ok
+}
+
+func (opencvBackend) Decode(data []byte, mode DecodeMode) (Image, error) {
+	mat, err := gocv.IMDecode(data, opencvDecodeFlags[mode])
+	if err != nil {
+		return nil, err
+	}
+	if mat.Empty() {
+		return nil, ErrDecodeImage
+	}
+
+	return matImage{mat: mat}, nil
+}
+
+func (opencvBackend) Resize(img Image, width, height int) (Image, error) {
+	resized := gocv.NewMat()
+	gocv.Resize(img.(matImage).mat, &resized, image.Pt(width, height), 0, 0, gocv.InterpolationCubic)
+
+	return matImage{mat: resized}, nil
+}
+
+func (opencvBackend) Crop(img Image, rect image.Rectangle) (Image, error) {
+	// The region shares the pixels of img, which may be closed first.
+	mat := img.(matImage).mat
+	region := mat.Region(rect)
+	defer region.Close()
+
+	return matImage{mat: region.Clone()}, nil
+}
+
+func (opencvBackend) Encode(img Image, opts EncodeOptions) ([]byte, error) {
+	fileExt, ok := opencvFileExts[opts.ContentType]
+	if !ok || !(opencvBackend{}).CanEncode(opts.ContentType) {
+		return nil, fmt.Errorf("%w %s", ErrEncodeFormat, opts.ContentType)
+	}
+
+	var params []int
+	if fileExt == gocv.JPEGFileExt && opts.JpegQuality > 0 {
+		params = []int{gocv.IMWriteJpegQuality, opts.JpegQuality}
+	}
+	if fileExt == gocv.PNGFileExt && opts.PngCompression > 0 {
+		params = []int{gocv.IMWritePngCompression, opts.PngCompression}
+	}
+	if opts.ContentType == constants.ContentTypeImageWebp && opts.WebpQuality > 0 {
+		params = []int{gocv.IMWriteWebpQuality, opts.WebpQuality}
+	}
+	if opts.ContentType == constants.ContentTypeImageAvif {
+		if opts.AvifQuality > 0 {
+			params = append(params, opencvImwriteAvifQuality, opts.AvifQuality)
+		}
+		if opts.AvifSpeed > 0 {
+			params = append(params, opencvImwriteAvifSpeed, opts.AvifSpeed)
+		}
+	}
+
+	mat := img.(matImage).mat
+	var nativeBuffer *gocv.NativeByteBuffer
+	var err error
+	// IMEncodeWithParams requires at least one parameter.
+	if len(params) > 0 {
+		nativeBuffer, err = gocv.IMEncodeWithParams(fileExt, mat, params)
+	} else {
+		nativeBuffer, err = gocv.IMEncode(fileExt, mat)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer nativeBuffer.Close()
+
+	// The buffer is owned by OpenCV and freed on Close.
+	return append([]byte(nil), nativeBuffer.GetBytes()...), nil
+}
+
+func (opencvBackend) Pixels(img Image) (image.Image, error) {
+	mat := img.(matImage).mat
+	return mat.ToImage()
+}
+
+// LibraryVersions returns the versions of gocv and of the OpenCV it is
+// linked against.
+func LibraryVersions() (gocvVersion, openCVVersion string) {
+	return gocv.Version(), gocv.OpenCVVersion()
+}
@@ -0,0 +1,8 @@
+//go:build purego
+
+package usecase
+
+// LibraryVersions returns no versions, OpenCV is left out of purego builds.
+func LibraryVersions() (gocvVersion, openCVVersion string) {
+	return "", ""
+}
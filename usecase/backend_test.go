@@ -0,0 +1,255 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// forEachBackend runs test against every backend compiled in, so that they
+// all behave the same.
+func forEachBackend(t *testing.T, test func(t *testing.T, backend Backend)) {
+	for _, name := range Backends() {
+		backend, err := NewBackend(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			test(t, backend)
+		})
+	}
+}
+
+func readTestImage(t *testing.T, path string) ([]byte, image.Config) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imgConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data, imgConfig
+}
+
+func TestNewBackend(t *testing.T) {
+	backend, err := NewBackend("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BackendGo
+	if slices.Contains(Backends(), BackendOpenCV) {
+		want = BackendOpenCV
+	}
+	assert.Equal(t, want, backend.Name())
+
+	backend, err = NewBackend(BackendGo)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, BackendGo, backend.Name())
+
+	_, err = NewBackend("vips")
+	assert.Equal(t, true, errors.Is(err, ErrUnknownBackend))
+}
+
+func TestBackend_Decode(t *testing.T) {
+	var tests = []struct {
+		name string
+		path string
+		mode DecodeMode
+	}{
+		{name: "png", path: "../imagetest/flower.png", mode: DecodeUnchanged},
+		{name: "png as color", path: "../imagetest/flower.png", mode: DecodeColor},
+		{name: "jpeg", path: "../imagetest/cat.jpg", mode: DecodeUnchanged},
+		{name: "tiff", path: "../imagetest/scan.tiff", mode: DecodeUnchanged},
+		{name: "bmp", path: "../imagetest/legacy.bmp", mode: DecodeColor},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				data, imgConfig := readTestImage(t, tt.path)
+
+				img, err := backend.Decode(data, tt.mode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer img.Close()
+
+				width, height := img.Size()
+				assert.Equal(t, imgConfig.Width, width)
+				assert.Equal(t, imgConfig.Height, height)
+			})
+		}
+
+		t.Run("not an image", func(t *testing.T) {
+			_, err := backend.Decode([]byte("not an image"), DecodeUnchanged)
+			assert.Equal(t, true, errors.Is(err, ErrDecodeImage))
+		})
+	})
+}
+
+func TestBackend_Resize(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		data, _ := readTestImage(t, "../imagetest/cat.jpg")
+		img, err := backend.Decode(data, DecodeUnchanged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer img.Close()
+
+		resized, err := backend.Resize(img, 64, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resized.Close()
+
+		width, height := resized.Size()
+		assert.Equal(t, 64, width)
+		assert.Equal(t, 32, height)
+	})
+}
+
+func TestBackend_Encode(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts EncodeOptions
+	}{
+		{name: "png", opts: EncodeOptions{ContentType: constants.ContentTypeImagePng}},
+		{name: "png compressed", opts: EncodeOptions{ContentType: constants.ContentTypeImagePng, PngCompression: 9}},
+		{name: "jpeg", opts: EncodeOptions{ContentType: constants.ContentTypeImageJpeg}},
+		{name: "jpeg quality", opts: EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 50}},
+		{name: "tiff", opts: EncodeOptions{ContentType: constants.ContentTypeImageTiff}},
+		{name: "bmp", opts: EncodeOptions{ContentType: constants.ContentTypeImageBmp}},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		data, imgConfig := readTestImage(t, "../imagetest/flower.png")
+		img, err := backend.Decode(data, DecodeColor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer img.Close()
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				encoded, err := backend.Encode(img, tt.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.opts.ContentType, DetectContentType(encoded))
+
+				encodedConfig, _, err := image.DecodeConfig(bytes.NewReader(encoded))
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, imgConfig.Width, encodedConfig.Width)
+				assert.Equal(t, imgConfig.Height, encodedConfig.Height)
+			})
+		}
+
+		t.Run("lower jpeg quality is smaller", func(t *testing.T) {
+			low, err := backend.Encode(img, EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			high, err := backend.Encode(img, EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, true, len(low) < len(high))
+		})
+
+		t.Run("unsupported format", func(t *testing.T) {
+			_, err := backend.Encode(img, EncodeOptions{ContentType: "image/x-unknown"})
+			assert.Equal(t, true, errors.Is(err, ErrEncodeFormat))
+		})
+
+		// Webp and avif are only encoded by the OpenCV builds that have them.
+		for _, opts := range []EncodeOptions{
+			{ContentType: constants.ContentTypeImageWebp, WebpQuality: 50},
+			{ContentType: constants.ContentTypeImageAvif, AvifQuality: 50, AvifSpeed: 8},
+		} {
+			t.Run(opts.ContentType, func(t *testing.T) {
+				encoded, err := backend.Encode(img, opts)
+				if !backend.CanEncode(opts.ContentType) {
+					assert.Equal(t, true, errors.Is(err, ErrEncodeFormat))
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, opts.ContentType, DetectContentType(encoded))
+			})
+		}
+
+		t.Run("pixels", func(t *testing.T) {
+			pixels, err := backend.Pixels(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, image.Rect(0, 0, imgConfig.Width, imgConfig.Height), pixels.Bounds())
+		})
+	})
+}
+
+func TestImageUsecase_backends(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		uc := NewImageUsecase().WithBackend(backend)
+
+		codecs, err := uc.SelfCheck()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, []string{"png", "jpeg", "tiff", "bmp"}, codecs)
+
+		data, _ := readTestImage(t, "../imagetest/cat.jpg")
+		req := dto.ImageDataResize{
+			ImageDatas:    []dto.ImageData{{Filename: "cat.jpg", ContentType: constants.ContentTypeImageJpeg, ImageBytes: data}},
+			ResizeRequest: dto.ResizeRequest{Width: []int{40}, Height: []int{30}},
+		}
+		if err := uc.ResizeImages(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		resizedConfig, _, err := image.DecodeConfig(bytes.NewReader(req.ImageDatas[0].ImageBytes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 40, resizedConfig.Width)
+		assert.Equal(t, 30, resizedConfig.Height)
+
+		processed := dto.ImageDataResize{
+			ImageDatas:    []dto.ImageData{{Filename: "flower.png", ContentType: constants.ContentTypeImagePng}},
+			ResizeRequest: dto.ResizeRequest{Width: []int{40}, Height: []int{30}},
+		}
+		processed.ImageDatas[0].ImageBytes, _ = readTestImage(t, "../imagetest/flower.png")
+		if err := uc.ProcessImages(context.Background(), processed); err != nil {
+			t.Fatal(err)
+		}
+
+		processedConfig, _, err := image.DecodeConfig(bytes.NewReader(processed.ImageDatas[0].ImageBytes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 40, processedConfig.Width)
+		assert.Equal(t, 30, processedConfig.Height)
+
+		images := []dto.ImageData{{Filename: "flower.png", ContentType: constants.ContentTypeImagePng}}
+		images[0].ImageBytes, _ = readTestImage(t, "../imagetest/flower.png")
+		if err := uc.ConvertPngToJpeg(context.Background(), dto.ImageDataEncode{ImageDatas: images}); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "flower.jpeg", images[0].Filename)
+		assert.Equal(t, constants.ContentTypeImageJpeg, http.DetectContentType(images[0].ImageBytes))
+	})
+}
@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// Compare scores img against reference with PSNR and SSIM, resizing img to
+// the size of reference when they differ. Alpha is drawn over white.
+func (uc ImageUsecase) Compare(ctx context.Context, reference, img dto.ImageData) (dto.CompareResponse, error) {
+	backend := uc.imageBackend()
+	images := []dto.ImageData{reference, img}
+	planes := make([]lumaPlane, len(images))
+	resp := dto.CompareResponse{Reference: reference.Filename, Image: img.Filename}
+	err := uc.eachImage(ctx, OperationCompare, images, func(ctx context.Context, i int) error {
+		start := time.Now()
+		decoded, err := backend.Decode(images[i].ImageBytes, DecodeUnchanged)
+		if err != nil {
+			return uc.logFailure(ctx, OperationCompare, StageDecode, i, images[i].Filename, err)
+		}
+		defer decoded.Close()
+		uc.observe(OperationCompare, StageDecode, start)
+
+		if err := checkpoint(ctx); err != nil {
+			return err
+		}
+
+		start = time.Now()
+		width, height := decoded.Size()
+		if i == 0 {
+			resp.Width, resp.Height = width, height
+		} else if width != resp.Width || height != resp.Height {
+			resized, err := backend.Resize(decoded, resp.Width, resp.Height)
+			if err != nil {
+				return uc.logFailure(ctx, OperationCompare, StageProcess, i, images[i].Filename, err)
+			}
+			defer resized.Close()
+			decoded, resp.Resized = resized, true
+		}
+
+		pixels, err := backend.Pixels(decoded)
+		if err != nil {
+			return uc.logFailure(ctx, OperationCompare, StageProcess, i, images[i].Filename, err)
+		}
+		planes[i] = newLumaPlane(pixels)
+		uc.observe(OperationCompare, StageProcess, start)
+		return nil
+	})
+	if err != nil {
+		return dto.CompareResponse{}, err
+	}
+
+	s := score(planes[0], planes[1])
+	resp.PSNR, resp.SSIM = s.psnr, s.ssim
+	return resp, nil
+}
@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"context"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+func Test_psnr(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	lighter := image.NewGray(gray.Rect)
+	for i := range lighter.Pix {
+		lighter.Pix[i] = 1
+	}
+
+	assert.Equal(t, float64(maxPSNR), psnr(newLumaPlane(gray), newLumaPlane(gray)))
+	// A mean squared error of 1 is 20*log10(255) dB.
+	assert.Equal(t, 48.13, math.Round(psnr(newLumaPlane(gray), newLumaPlane(lighter))*100)/100)
+}
+
+func TestImageUsecase_quality(t *testing.T) {
+	var tests = []struct {
+		name        string
+		path        string
+		format      string
+		score       bool
+		wantQuality bool
+	}{
+		{
+			name:        "jpeg",
+			path:        "../imagetest/cat.jpg",
+			format:      dto.EncodeFormatJpeg,
+			score:       true,
+			wantQuality: true,
+		},
+		{
+			name:   "jpeg is not scored unless asked",
+			path:   "../imagetest/cat.jpg",
+			format: dto.EncodeFormatJpeg,
+		},
+		{
+			name:   "png is lossless",
+			path:   "../imagetest/flower.png",
+			format: dto.EncodeFormatPng,
+			score:  true,
+		},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := dto.ImageDataEncode{
+					EncodeRequest: dto.EncodeRequest{Format: tt.format, Quality: 50, Score: tt.score},
+					ImageDatas:    generateImageDatas(t, tt.path),
+				}
+				if err := NewImageUsecase().WithBackend(backend).CompressImages(context.Background(), req); err != nil {
+					t.Fatal(err)
+				}
+
+				quality := req.ImageDatas[0].Quality
+				assert.Equal(t, tt.wantQuality, quality != nil)
+				if quality == nil {
+					return
+				}
+				assert.Equal(t, req.ImageDatas[0].Filename, quality.Filename)
+				assert.Equal(t, true, quality.SSIM > 0.8 && quality.SSIM < 1)
+				assert.Equal(t, true, quality.PSNR > 25 && quality.PSNR < maxPSNR)
+			})
+		}
+	})
+}
+
+func TestImageUsecase_Compare(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		uc := NewImageUsecase().WithBackend(backend)
+		reference := generateImageDatas(t, "../imagetest/cat.jpg")[0]
+		_, config := readTestImage(t, "../imagetest/cat.jpg")
+
+		t.Run("identical", func(t *testing.T) {
+			resp, err := uc.Compare(context.Background(), reference, reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, dto.CompareResponse{
+				Reference: reference.Filename,
+				Image:     reference.Filename,
+				Width:     config.Width,
+				Height:    config.Height,
+				PSNR:      maxPSNR,
+				SSIM:      1,
+			}, resp)
+		})
+
+		t.Run("smaller image is resized", func(t *testing.T) {
+			req := dto.ImageDataResize{
+				ResizeRequest: dto.ResizeRequest{Width: []int{config.Width / 2}, Height: []int{config.Height / 2}},
+				ImageDatas:    generateImageDatas(t, "../imagetest/cat.jpg"),
+			}
+			if err := uc.ResizeImages(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := uc.Compare(context.Background(), reference, req.ImageDatas[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, true, resp.Resized)
+			assert.Equal(t, config.Width, resp.Width)
+			assert.Equal(t, config.Height, resp.Height)
+			assert.Equal(t, true, resp.SSIM > 0.5 && resp.SSIM < 1)
+			assert.Equal(t, true, resp.PSNR < maxPSNR)
+		})
+
+		t.Run("undecodable image", func(t *testing.T) {
+			_, err := uc.Compare(context.Background(), reference, dto.ImageData{Filename: "broken.png", ImageBytes: []byte("broken")})
+			assert.NotEqual(t, nil, err)
+		})
+	})
+}
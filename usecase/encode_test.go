@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+func Test_outputOptions(t *testing.T) {
+	jpeg := EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 100}
+
+	var tests = []struct {
+		name string
+		req  dto.EncodeRequest
+		want EncodeOptions
+	}{
+		{name: "defaults", want: jpeg},
+		{
+			name: "same format",
+			req:  dto.EncodeRequest{Format: dto.EncodeFormatJpeg},
+			want: jpeg,
+		},
+		{
+			name: "quality",
+			req:  dto.EncodeRequest{Quality: 80},
+			want: EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 80, WebpQuality: 80, AvifQuality: 80},
+		},
+		{
+			name: "other format",
+			req:  dto.EncodeRequest{Format: dto.EncodeFormatPng},
+			want: EncodeOptions{ContentType: constants.ContentTypeImagePng},
+		},
+		{
+			name: "avif quality and speed",
+			req:  dto.EncodeRequest{Format: dto.EncodeFormatAvif, Quality: 40, Speed: 9},
+			want: EncodeOptions{ContentType: constants.ContentTypeImageAvif, JpegQuality: 40, WebpQuality: 40, AvifQuality: 40, AvifSpeed: 9},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, outputOptions(tt.req, jpeg))
+		})
+	}
+}
+
+func TestOutputFilename(t *testing.T) {
+	assert.Equal(t, "cat.jpg", OutputFilename("cat.jpg", constants.ContentTypeImageJpeg, constants.ContentTypeImageJpeg))
+	assert.Equal(t, "flower.jpeg", OutputFilename("flower.png", constants.ContentTypeImagePng, constants.ContentTypeImageJpeg))
+	assert.Equal(t, "cat.png", OutputFilename("cat.jpg", constants.ContentTypeImageJpeg, constants.ContentTypeImagePng))
+	assert.Equal(t, "scan.avif", OutputFilename("scan.tiff", constants.ContentTypeImageTiff, constants.ContentTypeImageAvif))
+}
+
+func TestImageUsecase_Capabilities(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		capabilities := NewImageUsecase().WithBackend(backend).Capabilities()
+
+		for _, contentType := range []string{constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageGif} {
+			assert.Equal(t, true, slices.Contains(capabilities.Decode, contentType))
+			assert.Equal(t, true, slices.Contains(capabilities.Encode, contentType))
+		}
+		assert.Equal(t, backend.CanEncode(constants.ContentTypeImageAvif), slices.Contains(capabilities.Encode, constants.ContentTypeImageAvif))
+	})
+}
+
+func TestImageUsecase_outputFormat(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		uc := NewImageUsecase().WithBackend(backend)
+
+		t.Run("compress to png", func(t *testing.T) {
+			req := dto.ImageDataEncode{
+				EncodeRequest: dto.EncodeRequest{Format: dto.EncodeFormatPng},
+				ImageDatas:    generateImageDatas(t, "../imagetest/cat.jpg"),
+			}
+			if err := uc.CompressImages(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "../imagetest/cat.png", req.ImageDatas[0].Filename)
+			assert.Equal(t, constants.ContentTypeImagePng, req.ImageDatas[0].ContentType)
+			assert.Equal(t, constants.ContentTypeImagePng, DetectContentType(req.ImageDatas[0].ImageBytes))
+		})
+
+		t.Run("resize to jpeg", func(t *testing.T) {
+			req := dto.ImageDataResize{
+				ResizeRequest: dto.ResizeRequest{Width: []int{40}, Height: []int{30}},
+				EncodeRequest: dto.EncodeRequest{Format: dto.EncodeFormatJpeg, Quality: 50},
+				ImageDatas:    generateImageDatas(t, "../imagetest/flower.png"),
+			}
+			if err := uc.ResizeImages(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "../imagetest/flower.jpeg", req.ImageDatas[0].Filename)
+			assert.Equal(t, constants.ContentTypeImageJpeg, DetectContentType(req.ImageDatas[0].ImageBytes))
+		})
+
+		t.Run("convert to avif", func(t *testing.T) {
+			req := dto.ImageDataEncode{
+				EncodeRequest: dto.EncodeRequest{Format: dto.EncodeFormatAvif, Quality: 50, Speed: 8},
+				ImageDatas:    generateImageDatas(t, "../imagetest/flower.png"),
+			}
+			err := uc.ConvertPngToJpeg(context.Background(), req)
+			if !backend.CanEncode(constants.ContentTypeImageAvif) {
+				var appErr *apperror.Error
+				assert.Equal(t, true, errors.As(err, &appErr))
+				assert.Equal(t, apperror.CodeCodecUnavailable, appErr.Code)
+				assert.Equal(t, "format", appErr.Field)
+				assert.Equal(t, true, errors.Is(err, ErrCodecUnavailable))
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "../imagetest/flower.avif", req.ImageDatas[0].Filename)
+			assert.Equal(t, constants.ContentTypeImageAvif, DetectContentType(req.ImageDatas[0].ImageBytes))
+		})
+	})
+}
@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"time"
+
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"golang.org/x/image/draw"
+)
+
+// Animated GIFs are processed in Go whatever the backend, since OpenCV only
+// reads their first frame. Frames are transformed one by one, keeping
+// their delays and disposal methods, the loop count and the global palette.
+
+// processGIF replaces img, the GIF at index i, by its transformation.
+// Errors of transform are returned as is.
+func (uc ImageUsecase) processGIF(
+	ctx context.Context, operation string, i int, img *dto.ImageData, transform func(g *gif.GIF) (*gif.GIF, error),
+) error {
+	start := time.Now()
+	g, err := decodeGIF(img.ImageBytes)
+	if err != nil {
+		return uc.logFailure(ctx, operation, StageDecode, i, img.Filename, err)
+	}
+	uc.observe(operation, StageDecode, start)
+
+	if err := checkpoint(ctx); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	transformed, err := transform(g)
+	if err != nil {
+		return err
+	}
+	uc.observe(operation, StageProcess, start)
+
+	if err := checkpoint(ctx); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	encoded, err := encodeGIF(transformed)
+	if err != nil {
+		return uc.logFailure(ctx, operation, StageEncode, i, img.Filename, err)
+	}
+	uc.observe(operation, StageEncode, start)
+
+	uc.logProcessed(ctx, operation, i, img.Filename, len(img.ImageBytes), len(encoded))
+	img.ImageBytes = encoded
+	return nil
+}
+
+func decodeGIF(data []byte) (*gif.GIF, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecodeImage, err)
+	}
+
+	return g, nil
+}
+
+func encodeGIF(g *gif.GIF) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// transformGIF returns g sized width by height, with every frame replaced
+// by transform. Frames are placed on the new canvas by transform.
+func transformGIF(g *gif.GIF, width, height int, transform func(frame *image.Paletted) *image.Paletted) *gif.GIF {
+	transformed := *g
+	transformed.Config.Width, transformed.Config.Height = width, height
+	transformed.Image = make([]*image.Paletted, len(g.Image))
+	for i, frame := range g.Image {
+		transformed.Image[i] = transform(frame)
+	}
+
+	return &transformed
+}
+
+// resizeGIF scales every frame of g, and its position on the canvas, to a
+// width by height canvas.
+func resizeGIF(g *gif.GIF, width, height int) *gif.GIF {
+	canvas := image.Rect(0, 0, width, height)
+	scaleX := float64(width) / float64(g.Config.Width)
+	scaleY := float64(height) / float64(g.Config.Height)
+
+	return transformGIF(g, width, height, func(frame *image.Paletted) *image.Paletted {
+		bounds := frame.Bounds()
+		rect := image.Rect(
+			int(float64(bounds.Min.X)*scaleX), int(float64(bounds.Min.Y)*scaleY),
+			int(math.Ceil(float64(bounds.Max.X)*scaleX)), int(math.Ceil(float64(bounds.Max.Y)*scaleY)),
+		).Intersect(canvas)
+		if rect.Empty() {
+			return emptyFrame(canvas)
+		}
+
+		resized := image.NewPaletted(rect, frame.Palette)
+		draw.CatmullRom.Scale(resized, rect, frame, bounds, draw.Src, nil)
+		return resized
+	})
+}
+
+// cropGIF keeps the part of every frame of g within rect, which lies within
+// the canvas.
+func cropGIF(g *gif.GIF, rect image.Rectangle) *gif.GIF {
+	return transformGIF(g, rect.Dx(), rect.Dy(), func(frame *image.Paletted) *image.Paletted {
+		kept := frame.Bounds().Intersect(rect)
+		if kept.Empty() {
+			return emptyFrame(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		}
+
+		cropped := image.NewPaletted(kept.Sub(rect.Min), frame.Palette)
+		for y := kept.Min.Y; y < kept.Max.Y; y++ {
+			copy(
+				cropped.Pix[cropped.PixOffset(kept.Min.X-rect.Min.X, y-rect.Min.Y):],
+				frame.Pix[frame.PixOffset(kept.Min.X, y):frame.PixOffset(kept.Max.X, y)],
+			)
+		}
+		return cropped
+	})
+}
+
+// emptyFrame is a transparent pixel at the corner of canvas, standing for a
+// frame falling out of it so that the other frames keep their timing.
+func emptyFrame(canvas image.Rectangle) *image.Paletted {
+	return image.NewPaletted(image.Rectangle{Min: canvas.Min, Max: canvas.Min.Add(image.Pt(1, 1))}, color.Palette{color.Transparent})
+}
+
+// composeGIF calls frame with every frame of g as displayed, drawn over the
+// previous ones according to their disposal, until frame returns false.
+func composeGIF(g *gif.GIF, frame func(i int, img image.Image) bool) {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, paletted := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, paletted.Bounds(), paletted, paletted.Bounds().Min, draw.Over)
+		if !frame(i, cloneRGBA(canvas)) {
+			return
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			// Like browsers, restore the background as transparent.
+			draw.Draw(canvas, paletted.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	cloned := *img
+	cloned.Pix = append([]uint8(nil), img.Pix...)
+	return &cloned
+}
+
+// encodeFrame encodes a frame to png, or to jpeg over a white background.
+func encodeFrame(frame image.Image, contentType string) ([]byte, error) {
+	if contentType == constants.ContentTypeImageJpeg {
+		opaque := image.NewRGBA(frame.Bounds())
+		draw.Draw(opaque, opaque.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(opaque, opaque.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frame = opaque
+	}
+
+	return goBackend{}.Encode(goImage{img: frame}, EncodeOptions{ContentType: contentType})
+}
@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// sticker.gif is a 24x16 animation looping twice: red and blue stripes for
+// 10cs, a green square at (4,4)-(12,12) disposed to the background after
+// 20cs, then a yellow rectangle at (8,2)-(20,10), with a transparent top
+// left pixel, disposed to the previous frame after 30cs.
+func readSticker(t *testing.T) dto.ImageData {
+	data, err := os.ReadFile("../imagetest/sticker.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dto.ImageData{Filename: "sticker.gif", ContentType: constants.ContentTypeImageGif, ImageBytes: data}
+}
+
+func decodeTestGIF(t *testing.T, data []byte) *gif.GIF {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+func frameBounds(g *gif.GIF) []image.Rectangle {
+	bounds := make([]image.Rectangle, len(g.Image))
+	for i, frame := range g.Image {
+		bounds[i] = frame.Bounds()
+	}
+
+	return bounds
+}
+
+func TestImageUsecase_ResizeImages_gif(t *testing.T) {
+	req := dto.ImageDataResize{
+		ResizeRequest: dto.ResizeRequest{Width: []int{12}, Height: []int{8}},
+		ImageDatas:    []dto.ImageData{readSticker(t)},
+	}
+	if err := NewImageUsecase().ResizeImages(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	g := decodeTestGIF(t, req.ImageDatas[0].ImageBytes)
+	assert.Equal(t, 12, g.Config.Width)
+	assert.Equal(t, 8, g.Config.Height)
+	assert.Equal(t, []int{10, 20, 30}, g.Delay)
+	assert.Equal(t, []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious}, g.Disposal)
+	assert.Equal(t, 2, g.LoopCount)
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 12, 8),
+		image.Rect(2, 2, 6, 6),
+		image.Rect(4, 1, 10, 5),
+	}, frameBounds(g))
+}
+
+func TestImageUsecase_CropImages(t *testing.T) {
+	flower, err := os.ReadFile("../imagetest/flower.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowerImage := dto.ImageData{Filename: "flower.png", ContentType: constants.ContentTypeImagePng, ImageBytes: flower}
+	flowerConfig, _, err := image.DecodeConfig(bytes.NewReader(flower))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crop := func(x, y, width, height int) dto.CropRequest {
+		return dto.CropRequest{X: []int{x}, Y: []int{y}, Width: []int{width}, Height: []int{height}}
+	}
+
+	var tests = []struct {
+		name       string
+		image      dto.ImageData
+		crop       dto.CropRequest
+		wantWidth  int
+		wantHeight int
+		wantCode   apperror.Code
+	}{
+		{
+			name:       "png",
+			image:      flowerImage,
+			crop:       crop(10, 20, 30, 40),
+			wantWidth:  30,
+			wantHeight: 40,
+		},
+		{
+			name:       "cut at the edges",
+			image:      flowerImage,
+			crop:       crop(flowerConfig.Width-10, flowerConfig.Height-5, 100, 100),
+			wantWidth:  10,
+			wantHeight: 5,
+		},
+		{
+			name:     "out of the image",
+			image:    flowerImage,
+			crop:     crop(flowerConfig.Width, 0, 10, 10),
+			wantCode: apperror.CodeInvalidRequest,
+		},
+		{
+			name:       "gif",
+			image:      readSticker(t),
+			crop:       crop(6, 0, 12, 16),
+			wantWidth:  12,
+			wantHeight: 16,
+		},
+		{
+			name:     "gif out of the image",
+			image:    readSticker(t),
+			crop:     crop(30, 0, 10, 10),
+			wantCode: apperror.CodeInvalidRequest,
+		},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := dto.ImageDataCrop{CropRequest: tt.crop, ImageDatas: []dto.ImageData{tt.image}}
+				err := NewImageUsecase().WithBackend(backend).CropImages(context.Background(), req)
+				if tt.wantCode != "" {
+					var appErr *apperror.Error
+					assert.Equal(t, true, errors.As(err, &appErr))
+					assert.Equal(t, tt.wantCode, appErr.Code)
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				croppedConfig, _, err := image.DecodeConfig(bytes.NewReader(req.ImageDatas[0].ImageBytes))
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantWidth, croppedConfig.Width)
+				assert.Equal(t, tt.wantHeight, croppedConfig.Height)
+			})
+		}
+	})
+
+	t.Run("gif frames", func(t *testing.T) {
+		req := dto.ImageDataCrop{CropRequest: crop(6, 0, 12, 16), ImageDatas: []dto.ImageData{readSticker(t)}}
+		if err := NewImageUsecase().CropImages(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		g := decodeTestGIF(t, req.ImageDatas[0].ImageBytes)
+		assert.Equal(t, []int{10, 20, 30}, g.Delay)
+		assert.Equal(t, []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious}, g.Disposal)
+		assert.Equal(t, 2, g.LoopCount)
+		assert.Equal(t, []image.Rectangle{
+			image.Rect(0, 0, 12, 16),
+			image.Rect(0, 4, 6, 12),
+			image.Rect(2, 2, 12, 10),
+		}, frameBounds(g))
+	})
+}
+
+func TestImageUsecase_ExtractFrames(t *testing.T) {
+	var (
+		red         = color.RGBA{R: 0xff, A: 0xff}
+		blue        = color.RGBA{B: 0xff, A: 0xff}
+		green       = color.RGBA{G: 0xff, A: 0xff}
+		yellow      = color.RGBA{R: 0xff, G: 0xff, A: 0xff}
+		transparent = color.RGBA{}
+	)
+
+	uc := NewImageUsecase()
+
+	t.Run("every frame", func(t *testing.T) {
+		frames, err := uc.ExtractFrames(context.Background(), dto.ImageDataFrames{ImageDatas: []dto.ImageData{readSticker(t)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var filenames []string
+		var pixels [][]color.Color
+		for _, frame := range frames {
+			filenames = append(filenames, frame.Filename)
+			assert.Equal(t, constants.ContentTypeImagePng, frame.ContentType)
+
+			img, err := png.Decode(bytes.NewReader(frame.ImageBytes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pixels = append(pixels, []color.Color{
+				color.RGBAModel.Convert(img.At(0, 0)),
+				color.RGBAModel.Convert(img.At(5, 5)),
+				color.RGBAModel.Convert(img.At(8, 2)),
+				color.RGBAModel.Convert(img.At(10, 5)),
+			})
+		}
+
+		assert.Equal(t, []string{"sticker-000.png", "sticker-001.png", "sticker-002.png"}, filenames)
+		assert.Equal(t, [][]color.Color{
+			{red, blue, red, blue},
+			{red, green, red, green},
+			// The green square was disposed to the background, the
+			// transparent pixel shows the stripes.
+			{red, transparent, red, yellow},
+		}, pixels)
+	})
+
+	t.Run("single frame", func(t *testing.T) {
+		frame := 1
+		frames, err := uc.ExtractFrames(context.Background(), dto.ImageDataFrames{
+			FramesRequest: dto.FramesRequest{Format: dto.FrameFormatJpeg, Frame: &frame},
+			ImageDatas:    []dto.ImageData{readSticker(t)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, 1, len(frames))
+		assert.Equal(t, "sticker.jpeg", frames[0].Filename)
+		assert.Equal(t, constants.ContentTypeImageJpeg, http.DetectContentType(frames[0].ImageBytes))
+	})
+
+	t.Run("frame out of range", func(t *testing.T) {
+		frame := 3
+		_, err := uc.ExtractFrames(context.Background(), dto.ImageDataFrames{
+			FramesRequest: dto.FramesRequest{Frame: &frame},
+			ImageDatas:    []dto.ImageData{readSticker(t)},
+		})
+
+		var appErr *apperror.Error
+		assert.Equal(t, true, errors.As(err, &appErr))
+		assert.Equal(t, apperror.CodeInvalidRequest, appErr.Code)
+		assert.Equal(t, "frame", appErr.Field)
+	})
+}
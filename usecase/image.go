@@ -2,167 +2,944 @@ package usecase
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
-	"mime/multipart"
+	"log/slog"
 	"net/http"
+	"path"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/rizqo46/image-processing-go/apperror"
 	"github.com/rizqo46/image-processing-go/constants"
 	"github.com/rizqo46/image-processing-go/dto"
-	"gocv.io/x/gocv"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
 )
 
-type ImageUsecase struct{}
+const (
+	OperationPngToJpeg = "png_to_jpeg"
+	OperationCompress  = "compress"
+	OperationResize    = "resize"
+	OperationProcess   = "process"
+	OperationCrop      = "crop"
+	OperationFrames    = "gif_frames"
+	OperationPages     = "tiff_pages"
+	OperationCompare   = "compare"
+)
+
+const (
+	StageDecode  = "decode"
+	StageProcess = "process"
+	StageEncode  = "encode"
+)
+
+// StageObserver is told how long each stage of an operation took for every
+// image, stage being one of StageDecode, StageProcess or StageEncode.
+type StageObserver interface {
+	ObserveStage(operation, stage string, duration time.Duration)
+}
+
+// Service is the image processing service behind the API. ImageUsecase
+// implements it with OpenCV.
+type Service interface {
+	ValidateAndProcessFilesRequest(ctx context.Context, files []dto.File, allowedContentTypes ...string) ([]dto.ImageData, error)
+	ValidateAndProcessReader(ctx context.Context, filename string, r io.Reader, allowedContentTypes ...string) (dto.ImageData, error)
+	ConvertPngToJpeg(ctx context.Context, req dto.ImageDataEncode) error
+	CompressImages(ctx context.Context, req dto.ImageDataEncode) error
+	ResizeImages(ctx context.Context, req dto.ImageDataResize) error
+	ProcessImages(ctx context.Context, req dto.ImageDataResize) error
+	CropImages(ctx context.Context, req dto.ImageDataCrop) error
+	ExtractFrames(ctx context.Context, req dto.ImageDataFrames) ([]dto.ImageData, error)
+	SplitPages(ctx context.Context, req dto.ImageDataPages) ([]dto.ImageData, error)
+	// Compare scores img against reference with PSNR and SSIM.
+	Compare(ctx context.Context, reference, img dto.ImageData) (dto.CompareResponse, error)
+	// BackendName returns the name of the backend processing the images,
+	// one of Backends.
+	BackendName() string
+	// Capabilities returns the formats decoded and encoded, which depend
+	// on the backend and on how it was built.
+	Capabilities() dto.Capabilities
+	// SelfCheck returns the codecs that work, and an error naming the
+	// first that doesn't.
+	SelfCheck() ([]string, error)
+}
 
+type ImageUsecase struct {
+	backend      Backend
+	observer     StageObserver
+	logger       *slog.Logger
+	imageTimeout time.Duration
+}
+
+// NewImageUsecase returns a usecase processing images with the default
+// backend, see NewBackend.
 func NewImageUsecase() ImageUsecase {
 	return ImageUsecase{}
 }
 
+// WithBackend returns a copy of uc processing images with backend.
+func (uc ImageUsecase) WithBackend(backend Backend) ImageUsecase {
+	uc.backend = backend
+	return uc
+}
+
+// WithObserver returns a copy of uc reporting stage durations to observer.
+func (uc ImageUsecase) WithObserver(observer StageObserver) ImageUsecase {
+	uc.observer = observer
+	return uc
+}
+
+// WithLogger returns a copy of uc logging to logger. A nil logger logs to
+// slog.Default().
+func (uc ImageUsecase) WithLogger(logger *slog.Logger) ImageUsecase {
+	uc.logger = logger
+	return uc
+}
+
+// WithImageTimeout returns a copy of uc giving up on an image, and on the
+// rest of the batch, once it took longer than timeout. Zero means no limit.
+func (uc ImageUsecase) WithImageTimeout(timeout time.Duration) ImageUsecase {
+	uc.imageTimeout = timeout
+	return uc
+}
+
+func (uc ImageUsecase) imageBackend() Backend {
+	if uc.backend != nil {
+		return uc.backend
+	}
+
+	backend, _ := NewBackend("")
+	return backend
+}
+
+// imageContentTypes are the formats ImageUsecase may process.
+var imageContentTypes = []string{
+	constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageGif,
+	constants.ContentTypeImageTiff, constants.ContentTypeImageBmp, constants.ContentTypeImageWebp,
+	constants.ContentTypeImageAvif,
+}
+
+func (uc ImageUsecase) BackendName() string {
+	return uc.imageBackend().Name()
+}
+
+func (uc ImageUsecase) Capabilities() dto.Capabilities {
+	backend := uc.imageBackend()
+	var capabilities dto.Capabilities
+	for _, contentType := range imageContentTypes {
+		// GIFs are processed in Go whatever the backend.
+		if contentType == constants.ContentTypeImageGif || backend.CanDecode(contentType) {
+			capabilities.Decode = append(capabilities.Decode, contentType)
+		}
+		if contentType == constants.ContentTypeImageGif || backend.CanEncode(contentType) {
+			capabilities.Encode = append(capabilities.Encode, contentType)
+		}
+	}
+
+	return capabilities
+}
+
+func (uc ImageUsecase) log() *slog.Logger {
+	if uc.logger != nil {
+		return uc.logger
+	}
+
+	return slog.Default()
+}
+
+func (uc ImageUsecase) observe(operation, stage string, start time.Time) {
+	if uc.observer != nil {
+		uc.observer.ObserveStage(operation, stage, time.Since(start))
+	}
+}
+
 var (
 	ErrOpenFile          = fmt.Errorf("failed to open a file")
 	ErrReadFile          = fmt.Errorf("failed to read a file")
 	ErrDetectContentType = fmt.Errorf("failed to detect content type")
+
+	ErrContentTypeNotAllowed = fmt.Errorf("filetype not allowed")
+
+	ErrDecodeImage  = fmt.Errorf("failed to decode image")
+	ErrImageTimeout = fmt.Errorf("image processing timed out: %w", context.DeadlineExceeded)
 )
 
-func (uc ImageUsecase) ValidateAndProcessFilesRequest(files []*multipart.FileHeader, allowedContentTypes ...string) ([]dto.ImageData, error) {
+// ProgressError reports that an operation was interrupted, because its
+// context was done, before processing every image. The first Processed
+// images are done, Filename is the image that was being processed.
+type ProgressError struct {
+	Operation string
+	Processed int
+	Total     int
+	Filename  string
+	Err       error
+}
+
+func (e *ProgressError) Error() string {
+	return fmt.Sprintf("%s interrupted after %d of %d images, at %s: %s",
+		e.Operation, e.Processed, e.Total, e.Filename, e.Err)
+}
+
+func (e *ProgressError) Unwrap() error {
+	return e.Err
+}
+
+func (uc ImageUsecase) ValidateAndProcessFilesRequest(ctx context.Context, files []dto.File, allowedContentTypes ...string) ([]dto.ImageData, error) {
 	images := make([]dto.ImageData, 0, len(files))
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
+	for i, uploadedFile := range files {
+		if err := checkpoint(ctx); err != nil {
+			return nil, err
+		}
+
+		file, err := uploadedFile.Open()
 		if err != nil {
-			return nil, ErrOpenFile
+			return nil, apperror.WithFile(ErrOpenFile, "files[]", i, uploadedFile.Name())
 		}
 		defer file.Close()
 
-		bufReader := bufio.NewReader(file)
-		sniff, err := bufReader.Peek(512)
+		image, err := uc.ValidateAndProcessReader(ctx, uploadedFile.Name(), file, allowedContentTypes...)
 		if err != nil {
-			return nil, ErrDetectContentType
+			return nil, apperror.WithFile(err, "files[]", i, uploadedFile.Name())
 		}
 
-		contentType := http.DetectContentType(sniff)
-		if !slices.Contains(allowedContentTypes, contentType) {
-			return nil, fmt.Errorf("filetype not allowed, only allow %+v", allowedContentTypes)
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func (uc ImageUsecase) ValidateAndProcessReader(ctx context.Context, filename string, r io.Reader, allowedContentTypes ...string) (dto.ImageData, error) {
+	if err := checkpoint(ctx); err != nil {
+		return dto.ImageData{}, err
+	}
+
+	bufReader := bufio.NewReader(r)
+	sniff, err := bufReader.Peek(512)
+	if err != nil && err != io.EOF {
+		return dto.ImageData{}, fmt.Errorf("%w: %w", ErrDetectContentType, err)
+	}
+
+	contentType := DetectContentType(sniff)
+	if !slices.Contains(allowedContentTypes, contentType) {
+		uc.log().DebugContext(ctx, "image rejected", "filename", filename, "content_type", contentType)
+		return dto.ImageData{}, apperror.Wrap(
+			apperror.CodeUnsupportedType, fmt.Errorf("%w, only allow %+v", ErrContentTypeNotAllowed, allowedContentTypes),
+		)
+	}
+
+	data, err := io.ReadAll(bufReader)
+	if err != nil {
+		return dto.ImageData{}, fmt.Errorf("%w: %w", ErrReadFile, err)
+	}
+
+	if err := checkDimensions(data, filename); err != nil {
+		return dto.ImageData{}, err
+	}
+
+	return dto.ImageData{
+		Filename:    filename,
+		ContentType: contentType,
+		ImageBytes:  data,
+	}, nil
+}
+
+// DetectContentType is http.DetectContentType, also recognizing TIFF and
+// AVIF images.
+func DetectContentType(data []byte) string {
+	switch {
+	case isTIFF(data):
+		return constants.ContentTypeImageTiff
+	case isAVIF(data):
+		return constants.ContentTypeImageAvif
+	}
+
+	return http.DetectContentType(data)
+}
+
+// isAVIF tells whether data starts with the file type box of an avif image
+// or image sequence.
+func isAVIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+
+	brand := string(data[8:12])
+	return brand == "avif" || brand == "avis"
+}
+
+// DecodeConfig reads the size of an image without decoding its pixels,
+// also for the webp and avif images the standard library can't parse.
+func DecodeConfig(data []byte) (image.Config, error) {
+	switch {
+	case isAVIF(data):
+		width, height, err := avifSize(data)
+		return image.Config{Width: width, Height: height}, err
+	case http.DetectContentType(data) == constants.ContentTypeImageWebp:
+		return webp.DecodeConfig(bytes.NewReader(data))
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return config, err
+}
+
+// checkDimensions refuses oversized images before their pixels get decoded.
+// Images whose size can't be read are left to the decoder.
+func checkDimensions(data []byte, filename string) error {
+	config, err := DecodeConfig(data)
+	if err == nil && (config.Width > constants.MaxImageDimension || config.Height > constants.MaxImageDimension) {
+		return &apperror.Error{
+			Code: apperror.CodeDimensionTooLarge,
+			Message: fmt.Sprintf("image is %dx%d, width and height must not exceed %d",
+				config.Width, config.Height, constants.MaxImageDimension),
+			Filename: filename,
 		}
+	}
 
-		bytes, err := io.ReadAll(bufReader)
-		if err != nil {
-			return nil, ErrReadFile
+	return nil
+}
+
+// eachImage calls process for every image, each under the per-image
+// timeout. It stops at the first error, wrapping the cause of a done context
+// in a *ProgressError.
+func (uc ImageUsecase) eachImage(
+	ctx context.Context, operation string, images []dto.ImageData, process func(ctx context.Context, i int) error,
+) error {
+	for i := range images {
+		err := uc.processImage(ctx, i, process)
+		if err == nil {
+			continue
 		}
 
-		images = append(images, dto.ImageData{
-			Filename:    fileHeader.Filename,
-			ContentType: contentType,
-			ImageBytes:  bytes,
-		})
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			index := batchIndex(ctx, i)
+			uc.log().WarnContext(ctx, "image processing interrupted",
+				"operation", operation, "index", index, "filename", images[i].Filename, "error", err,
+			)
+			return &ProgressError{
+				Operation: operation,
+				Processed: index,
+				Total:     batchTotal(ctx, len(images)),
+				Filename:  images[i].Filename,
+				Err:       err,
+			}
+		}
+
+		return err
 	}
 
-	return images, nil
+	return nil
+}
+
+type batchKey struct{}
+
+// batchPart places the images of an operation within a larger batch.
+type batchPart struct {
+	offset int
+	total  int
+}
+
+// WithBatchOffset tells the operations run with ctx that their images start
+// at offset in a batch of total images, processed a part at a time, so that
+// logs, errors and progress count the images of the whole batch.
+func WithBatchOffset(ctx context.Context, offset, total int) context.Context {
+	return context.WithValue(ctx, batchKey{}, batchPart{offset: offset, total: total})
+}
+
+// batchIndex is the index in the whole batch of the image at index i of an
+// operation.
+func batchIndex(ctx context.Context, i int) int {
+	part, _ := ctx.Value(batchKey{}).(batchPart)
+	return part.offset + i
+}
+
+// batchTotal is the size of the whole batch of an operation on n images.
+func batchTotal(ctx context.Context, n int) int {
+	if part, ok := ctx.Value(batchKey{}).(batchPart); ok {
+		return part.total
+	}
+
+	return n
+}
+
+func (uc ImageUsecase) processImage(ctx context.Context, i int, process func(ctx context.Context, i int) error) error {
+	if err := checkpoint(ctx); err != nil {
+		return err
+	}
+
+	if uc.imageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, uc.imageTimeout, ErrImageTimeout)
+		defer cancel()
+	}
+
+	return process(ctx, i)
+}
+
+// checkpoint returns the cause of ctx being done, if it is. The codecs can't
+// be interrupted, so it is called between them.
+func checkpoint(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+
+	return nil
+}
+
+func (uc ImageUsecase) logProcessed(ctx context.Context, operation string, index int, filename string, inputBytes, outputBytes int) {
+	uc.log().DebugContext(ctx, "image processed",
+		"operation", operation, "index", batchIndex(ctx, index), "filename", filename,
+		"input_bytes", inputBytes, "output_bytes", outputBytes,
+	)
+}
+
+// logFailure logs that the image at index failed at stage and returns err,
+// typed after the stage.
+func (uc ImageUsecase) logFailure(ctx context.Context, operation, stage string, index int, filename string, err error) error {
+	index = batchIndex(ctx, index)
+	uc.log().WarnContext(ctx, "image processing failed",
+		"operation", operation, "stage", stage, "index", index, "filename", filename, "error", err,
+	)
+
+	code := apperror.CodeInternal
+	switch stage {
+	case StageDecode:
+		code = apperror.CodeDecodeFailed
+	case StageEncode:
+		code = apperror.CodeEncodeFailed
+	}
+
+	return &apperror.Error{Code: code, FileIndex: &index, Filename: filename, Err: err}
 }
 
 func convretFilenameFromPngToJpeg(name string) string {
 	return strings.TrimSuffix(name, "png") + "jpeg"
 }
 
-func (uc ImageUsecase) ConvertPngToJpeg(req []dto.ImageData) error {
-	for i := range req {
-		img, err := gocv.IMDecode(req[i].ImageBytes, gocv.IMReadAnyColor)
+// OutputFilename is the name of an image encoded from one format to
+// another, name when the format is kept.
+func OutputFilename(name, from, to string) string {
+	switch {
+	case from == to:
+		return name
+	case from == constants.ContentTypeImagePng && to == constants.ContentTypeImageJpeg:
+		return convretFilenameFromPngToJpeg(name)
+	}
+
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + strings.TrimPrefix(to, "image/")
+}
+
+// outputOptions overrides defaults, the encode options of an operation,
+// with the format, quality and speed of req. Another format starts from the
+// defaults of its codec.
+func outputOptions(req dto.EncodeRequest, defaults EncodeOptions) EncodeOptions {
+	opts := defaults
+	if contentType := req.ContentType(); contentType != "" && contentType != defaults.ContentType {
+		opts = EncodeOptions{ContentType: contentType}
+	}
+	if req.Quality > 0 {
+		opts.JpegQuality, opts.WebpQuality, opts.AvifQuality = req.Quality, req.Quality, req.Quality
+	}
+	if req.Speed > 0 {
+		opts.AvifSpeed = req.Speed
+	}
+
+	return opts
+}
+
+// checkFormat fails with CodeCodecUnavailable when backend can't encode the
+// format req asks for. Auto only picks formats the backend encodes.
+func checkFormat(backend Backend, req dto.EncodeRequest) error {
+	if req.Format == "" || req.Format == dto.EncodeFormatAuto || backend.CanEncode(req.ContentType()) {
+		return nil
+	}
+
+	return &apperror.Error{
+		Code:    apperror.CodeCodecUnavailable,
+		Message: fmt.Sprintf("%s encoding is not available with the %s backend of this build", req.Format, backend.Name()),
+		Field:   "format",
+		Err:     ErrCodecUnavailable,
+	}
+}
+
+// setOutput replaces img by out, recording its quality score and the choice
+// of the auto format.
+func setOutput(img *dto.ImageData, out encoding) {
+	filename := OutputFilename(img.Filename, img.ContentType, out.opts.ContentType)
+	ssim := 1.0
+	if out.score != nil {
+		ssim = out.score.ssim
+		img.Quality = &dto.ImageQuality{
+			Filename: filename, Quality: out.quality, PSNR: out.score.psnr, SSIM: out.score.ssim,
+		}
+	}
+	if out.auto {
+		img.AutoFormat = &dto.AutoFormat{
+			Filename:    filename,
+			ContentType: out.opts.ContentType,
+			Quality:     out.quality,
+			SSIM:        ssim,
+			InputBytes:  len(img.ImageBytes),
+			OutputBytes: len(out.data),
+			Savings:     1 - float64(len(out.data))/float64(max(len(img.ImageBytes), 1)),
+		}
+	}
+
+	img.Filename = filename
+	img.ContentType = out.opts.ContentType
+	img.ImageBytes = out.data
+}
+
+// ConvertPngToJpeg converts images to jpeg, or to the format of req.
+func (uc ImageUsecase) ConvertPngToJpeg(ctx context.Context, req dto.ImageDataEncode) error {
+	backend := uc.imageBackend()
+	if err := checkFormat(backend, req.EncodeRequest); err != nil {
+		return err
+	}
+
+	opts := outputOptions(req.EncodeRequest, EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 100})
+	mode := DecodeColor
+	if opts.ContentType != constants.ContentTypeImageJpeg || req.Format == dto.EncodeFormatAuto {
+		mode = DecodeUnchanged
+	}
+
+	images := req.ImageDatas
+	return uc.eachImage(ctx, OperationPngToJpeg, images, func(ctx context.Context, i int) error {
+		start := time.Now()
+		img, err := backend.Decode(images[i].ImageBytes, mode)
 		if err != nil {
+			return uc.logFailure(ctx, OperationPngToJpeg, StageDecode, i, images[i].Filename, err)
+		}
+		defer img.Close()
+		uc.observe(OperationPngToJpeg, StageDecode, start)
+
+		if err := checkpoint(ctx); err != nil {
 			return err
 		}
 
-		params := []int{gocv.IMWriteJpegQuality, 100}
-		nativeBuffer, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, img, params)
+		start = time.Now()
+		out, err := encodeOutput(backend, img, opts, req.EncodeRequest)
 		if err != nil {
-			return err
+			return uc.logFailure(ctx, OperationPngToJpeg, StageEncode, i, images[i].Filename, err)
 		}
+		uc.observe(OperationPngToJpeg, StageEncode, start)
+
+		uc.logProcessed(ctx, OperationPngToJpeg, i, images[i].Filename, len(images[i].ImageBytes), len(out.data))
+		setOutput(&images[i], out)
+		return nil
+	})
+}
 
-		req[i].Filename = convretFilenameFromPngToJpeg(req[i].Filename)
-		req[i].ImageBytes = nativeBuffer.GetBytes()
+// decodeModeFor is the decode mode of images encoded as req asks, dropping
+// the alpha of images converted to jpeg.
+func decodeModeFor(req dto.EncodeRequest) DecodeMode {
+	if req.ContentType() == constants.ContentTypeImageJpeg {
+		return DecodeColor
 	}
 
-	return nil
+	return DecodeUnchanged
+}
+
+// compressOptions are the encode options of CompressImages, by content
+// type, and the ones the auto format starts from.
+var compressOptions = map[string]EncodeOptions{
+	constants.ContentTypeImagePng:  {ContentType: constants.ContentTypeImagePng, PngCompression: 3},
+	constants.ContentTypeImageJpeg: {ContentType: constants.ContentTypeImageJpeg, JpegQuality: 95},
+	constants.ContentTypeImageWebp: {ContentType: constants.ContentTypeImageWebp, WebpQuality: 80},
+	constants.ContentTypeImageAvif: {ContentType: constants.ContentTypeImageAvif, AvifQuality: 60, AvifSpeed: 6},
 }
 
-func (uc ImageUsecase) CompressImages(req []dto.ImageData) error {
-	imWriteContentTypeMapping := map[string]gocv.FileExt{
-		constants.ContentTypeImagePng:  gocv.PNGFileExt,
-		constants.ContentTypeImageJpeg: gocv.JPEGFileExt,
+// CompressImages re-encodes images in their format, or in the format of
+// req, with the options of compressOptions.
+func (uc ImageUsecase) CompressImages(ctx context.Context, req dto.ImageDataEncode) error {
+	backend := uc.imageBackend()
+	if err := checkFormat(backend, req.EncodeRequest); err != nil {
+		return err
 	}
 
-	encodeParamFileExtMapping := map[gocv.FileExt][]int{
-		gocv.PNGFileExt:  {gocv.IMWritePngCompression, 3},
-		gocv.JPEGFileExt: {gocv.IMWriteJpegQuality, 95},
+	mode := decodeModeFor(req.EncodeRequest)
+	images := req.ImageDatas
+	return uc.eachImage(ctx, OperationCompress, images, func(ctx context.Context, i int) error {
+		start := time.Now()
+		img, err := backend.Decode(images[i].ImageBytes, mode)
+		if err != nil {
+			return uc.logFailure(ctx, OperationCompress, StageDecode, i, images[i].Filename, err)
+		}
+		defer img.Close()
+		uc.observe(OperationCompress, StageDecode, start)
+
+		if err := checkpoint(ctx); err != nil {
+			return err
+		}
+
+		start = time.Now()
+		contentType := images[i].ContentType
+		if req.ContentType() != "" {
+			contentType = req.ContentType()
+		}
+		opts, ok := compressOptions[contentType]
+		if !ok {
+			opts = EncodeOptions{ContentType: contentType}
+		}
+		out, err := encodeOutput(backend, img, outputOptions(req.EncodeRequest, opts), req.EncodeRequest)
+		if err != nil {
+			return uc.logFailure(ctx, OperationCompress, StageEncode, i, images[i].Filename, err)
+		}
+		uc.observe(OperationCompress, StageEncode, start)
+
+		uc.logProcessed(ctx, OperationCompress, i, images[i].Filename, len(images[i].ImageBytes), len(out.data))
+		setOutput(&images[i], out)
+		return nil
+	})
+}
+
+// ResizeImages resizes images, keeping their format unless req has one.
+// Animated GIFs keep their format, and their animation, whatever req.
+func (uc ImageUsecase) ResizeImages(ctx context.Context, req dto.ImageDataResize) error {
+	backend := uc.imageBackend()
+	if err := checkFormat(backend, req.EncodeRequest); err != nil {
+		return err
 	}
 
-	for i := range req {
-		img, err := gocv.IMDecode(req[i].ImageBytes, gocv.IMReadUnchanged)
+	mode := decodeModeFor(req.EncodeRequest)
+	return uc.eachImage(ctx, OperationResize, req.ImageDatas, func(ctx context.Context, i int) error {
+		if req.ImageDatas[i].ContentType == constants.ContentTypeImageGif {
+			return uc.processGIF(ctx, OperationResize, i, &req.ImageDatas[i], func(g *gif.GIF) (*gif.GIF, error) {
+				return resizeGIF(g, req.Width[i], req.Height[i]), nil
+			})
+		}
+
+		start := time.Now()
+		img, err := backend.Decode(req.ImageDatas[i].ImageBytes, mode)
 		if err != nil {
+			return uc.logFailure(ctx, OperationResize, StageDecode, i, req.ImageDatas[i].Filename, err)
+		}
+		defer img.Close()
+		uc.observe(OperationResize, StageDecode, start)
+
+		if err := checkpoint(ctx); err != nil {
 			return err
 		}
 
-		fileExt := imWriteContentTypeMapping[req[i].ContentType]
-		params := encodeParamFileExtMapping[fileExt]
-		nativeBuffer, err := gocv.IMEncodeWithParams(fileExt, img, params)
+		start = time.Now()
+		newImage, err := backend.Resize(img, req.Width[i], req.Height[i])
 		if err != nil {
+			return uc.logFailure(ctx, OperationResize, StageProcess, i, req.ImageDatas[i].Filename, err)
+		}
+		defer newImage.Close()
+		uc.observe(OperationResize, StageProcess, start)
+
+		if err := checkpoint(ctx); err != nil {
 			return err
 		}
 
-		req[i].ImageBytes = nativeBuffer.GetBytes()
-	}
+		start = time.Now()
+		opts := outputOptions(req.EncodeRequest, EncodeOptions{ContentType: req.ImageDatas[i].ContentType})
+		out, err := encodeOutput(backend, newImage, opts, req.EncodeRequest)
+		if err != nil {
+			return uc.logFailure(ctx, OperationResize, StageEncode, i, req.ImageDatas[i].Filename, err)
+		}
+		uc.observe(OperationResize, StageEncode, start)
 
-	return nil
+		uc.logProcessed(ctx, OperationResize, i, req.ImageDatas[i].Filename, len(req.ImageDatas[i].ImageBytes), len(out.data))
+		setOutput(&req.ImageDatas[i], out)
+		return nil
+	})
 }
 
-func (uc ImageUsecase) ResizeImages(req dto.ImageDataResize) error {
-	imWriteContentTypeMapping := map[string]gocv.FileExt{
-		constants.ContentTypeImagePng:  gocv.PNGFileExt,
-		constants.ContentTypeImageJpeg: gocv.JPEGFileExt,
+// ProcessImages resizes, then converts images to jpeg, or to the format of
+// req.
+func (uc ImageUsecase) ProcessImages(ctx context.Context, req dto.ImageDataResize) error {
+	backend := uc.imageBackend()
+	if err := checkFormat(backend, req.EncodeRequest); err != nil {
+		return err
 	}
 
-	for i := range req.ImageDatas {
-		img, err := gocv.IMDecode(req.ImageDatas[i].ImageBytes, gocv.IMReadUnchanged)
+	opts := outputOptions(req.EncodeRequest, EncodeOptions{ContentType: constants.ContentTypeImageJpeg, JpegQuality: 100})
+	return uc.eachImage(ctx, OperationProcess, req.ImageDatas, func(ctx context.Context, i int) error {
+		start := time.Now()
+		img, err := backend.Decode(req.ImageDatas[i].ImageBytes, DecodeUnchanged)
+		if err != nil {
+			return uc.logFailure(ctx, OperationProcess, StageDecode, i, req.ImageDatas[i].Filename, err)
+		}
+		defer img.Close()
+		uc.observe(OperationProcess, StageDecode, start)
+
+		if err := checkpoint(ctx); err != nil {
+			return err
+		}
+
+		start = time.Now()
+		newImage, err := backend.Resize(img, req.Width[i], req.Height[i])
 		if err != nil {
+			return uc.logFailure(ctx, OperationProcess, StageProcess, i, req.ImageDatas[i].Filename, err)
+		}
+		defer newImage.Close()
+		uc.observe(OperationProcess, StageProcess, start)
+
+		if err := checkpoint(ctx); err != nil {
 			return err
 		}
 
-		interpolationMethod := gocv.InterpolationCubic
-		newImage := gocv.NewMat()
-		gocv.Resize(img, &newImage, image.Pt(req.Width[i], req.Height[i]), 0, 0, interpolationMethod)
+		start = time.Now()
+		out, err := encodeOutput(backend, newImage, opts, req.EncodeRequest)
+		if err != nil {
+			return uc.logFailure(ctx, OperationProcess, StageEncode, i, req.ImageDatas[i].Filename, err)
+		}
+		uc.observe(OperationProcess, StageEncode, start)
+
+		uc.logProcessed(ctx, OperationProcess, i, req.ImageDatas[i].Filename, len(req.ImageDatas[i].ImageBytes), len(out.data))
+		setOutput(&req.ImageDatas[i], out)
+		return nil
+	})
+}
+
+func (uc ImageUsecase) CropImages(ctx context.Context, req dto.ImageDataCrop) error {
+	backend := uc.imageBackend()
+	return uc.eachImage(ctx, OperationCrop, req.ImageDatas, func(ctx context.Context, i int) error {
+		img := &req.ImageDatas[i]
+		rect := image.Rect(req.X[i], req.Y[i], req.X[i]+req.Width[i], req.Y[i]+req.Height[i])
+
+		if img.ContentType == constants.ContentTypeImageGif {
+			return uc.processGIF(ctx, OperationCrop, i, img, func(g *gif.GIF) (*gif.GIF, error) {
+				rect, err := clipCrop(rect, g.Config.Width, g.Config.Height, batchIndex(ctx, i), img.Filename)
+				if err != nil {
+					return nil, err
+				}
+				return cropGIF(g, rect), nil
+			})
+		}
 
-		fileExt := imWriteContentTypeMapping[req.ImageDatas[i].ContentType]
-		nativeBuffer, err := gocv.IMEncode(fileExt, newImage)
+		start := time.Now()
+		decoded, err := backend.Decode(img.ImageBytes, DecodeUnchanged)
+		if err != nil {
+			return uc.logFailure(ctx, OperationCrop, StageDecode, i, img.Filename, err)
+		}
+		defer decoded.Close()
+		uc.observe(OperationCrop, StageDecode, start)
+
+		if err := checkpoint(ctx); err != nil {
+			return err
+		}
+
+		start = time.Now()
+		decodedWidth, decodedHeight := decoded.Size()
+		rect, err = clipCrop(rect, decodedWidth, decodedHeight, batchIndex(ctx, i), img.Filename)
+		if err != nil {
+			return err
+		}
+		cropped, err := backend.Crop(decoded, rect)
 		if err != nil {
+			return uc.logFailure(ctx, OperationCrop, StageProcess, i, img.Filename, err)
+		}
+		defer cropped.Close()
+		uc.observe(OperationCrop, StageProcess, start)
+
+		if err := checkpoint(ctx); err != nil {
 			return err
 		}
 
-		req.ImageDatas[i].ImageBytes = nativeBuffer.GetBytes()
+		start = time.Now()
+		encoded, err := backend.Encode(cropped, EncodeOptions{ContentType: img.ContentType})
+		if err != nil {
+			return uc.logFailure(ctx, OperationCrop, StageEncode, i, img.Filename, err)
+		}
+		uc.observe(OperationCrop, StageEncode, start)
+
+		uc.logProcessed(ctx, OperationCrop, i, img.Filename, len(img.ImageBytes), len(encoded))
+		img.ImageBytes = encoded
+		return nil
+	})
+}
+
+// clipCrop cuts rect at the edges of a width by height image, failing when
+// nothing is left.
+func clipCrop(rect image.Rectangle, width, height, index int, filename string) (image.Rectangle, error) {
+	clipped := rect.Intersect(image.Rect(0, 0, width, height))
+	if clipped.Empty() {
+		return clipped, &apperror.Error{
+			Code:      apperror.CodeInvalidRequest,
+			Message:   fmt.Sprintf("crop rectangle %v is out of the %dx%d image", rect, width, height),
+			Field:     "x[]",
+			FileIndex: &index,
+			Filename:  filename,
+		}
 	}
 
-	return nil
+	return clipped, nil
 }
 
-func (uc ImageUsecase) ProcessImages(req dto.ImageDataResize) error {
-	for i := range req.ImageDatas {
-		img, err := gocv.IMDecode(req.ImageDatas[i].ImageBytes, gocv.IMReadUnchanged)
+// ExtractFrames exports the frames of animated GIFs, as displayed, to png
+// or jpeg. Other images have a single frame. Frames are named after their
+// image, with their index unless a single frame is requested.
+func (uc ImageUsecase) ExtractFrames(ctx context.Context, req dto.ImageDataFrames) ([]dto.ImageData, error) {
+	contentType := req.ContentType()
+	ext := strings.TrimPrefix(contentType, "image/")
+
+	var frames []dto.ImageData
+	err := uc.eachImage(ctx, OperationFrames, req.ImageDatas, func(ctx context.Context, i int) error {
+		img := req.ImageDatas[i]
+
+		start := time.Now()
+		frameCount, eachFrame, err := decodeFrames(img)
+		if err != nil {
+			return uc.logFailure(ctx, OperationFrames, StageDecode, i, img.Filename, err)
+		}
+		uc.observe(OperationFrames, StageDecode, start)
+
+		if req.Frame != nil && *req.Frame >= frameCount {
+			index := batchIndex(ctx, i)
+			return &apperror.Error{
+				Code:      apperror.CodeInvalidRequest,
+				Message:   fmt.Sprintf("frame %d is out of range, the image has %d frames", *req.Frame, frameCount),
+				Field:     "frame",
+				FileIndex: &index,
+				Filename:  img.Filename,
+			}
+		}
+
+		base := strings.TrimSuffix(img.Filename, path.Ext(img.Filename))
+		outputBytes := 0
+		eachFrame(func(index int, frame image.Image) bool {
+			if req.Frame != nil && index != *req.Frame {
+				return true
+			}
+			if err = checkpoint(ctx); err != nil {
+				return false
+			}
+
+			start := time.Now()
+			var encoded []byte
+			encoded, err = encodeFrame(frame, contentType)
+			if err != nil {
+				err = uc.logFailure(ctx, OperationFrames, StageEncode, i, img.Filename, err)
+				return false
+			}
+			uc.observe(OperationFrames, StageEncode, start)
+
+			filename := fmt.Sprintf("%s-%03d.%s", base, index, ext)
+			if req.Frame != nil {
+				filename = base + "." + ext
+			}
+			frames = append(frames, dto.ImageData{Filename: filename, ContentType: contentType, ImageBytes: encoded})
+			outputBytes += len(encoded)
+			return req.Frame == nil
+		})
 		if err != nil {
 			return err
 		}
 
-		interpolationMethod := gocv.InterpolationCubic
-		newImage := gocv.NewMat()
-		gocv.Resize(img, &newImage, image.Pt(req.Width[i], req.Height[i]), 0, 0, interpolationMethod)
+		uc.logProcessed(ctx, OperationFrames, i, img.Filename, len(img.ImageBytes), outputBytes)
+		return nil
+	})
+
+	return frames, err
+}
 
-		params := []int{gocv.IMWriteJpegQuality, 100}
-		nativeBuffer, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, img, params)
+// decodeFrames decodes img, returning its number of frames and a function
+// calling frame with every frame as displayed until it returns false. Only
+// GIFs have several frames.
+func decodeFrames(img dto.ImageData) (int, func(frame func(i int, img image.Image) bool), error) {
+	if img.ContentType == constants.ContentTypeImageGif {
+		g, err := decodeGIF(img.ImageBytes)
 		if err != nil {
-			return err
+			return 0, nil, err
 		}
 
-		req.ImageDatas[i].ImageBytes = nativeBuffer.GetBytes()
+		return len(g.Image), func(frame func(i int, img image.Image) bool) { composeGIF(g, frame) }, nil
 	}
 
-	return nil
+	decoded, _, err := image.Decode(bytes.NewReader(img.ImageBytes))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", ErrDecodeImage, err)
+	}
+
+	return 1, func(frame func(i int, img image.Image) bool) { frame(0, decoded) }, nil
+}
+
+// SplitPages exports every page of multi-page TIFF images to png or jpeg.
+// Other images have a single page. Pages are named after their image and
+// numbered from 1.
+func (uc ImageUsecase) SplitPages(ctx context.Context, req dto.ImageDataPages) ([]dto.ImageData, error) {
+	backend := uc.imageBackend()
+	contentType := req.ContentType()
+	ext := strings.TrimPrefix(contentType, "image/")
+	mode := DecodeUnchanged
+	if contentType == constants.ContentTypeImageJpeg {
+		mode = DecodeColor
+	}
+
+	var pages []dto.ImageData
+	err := uc.eachImage(ctx, OperationPages, req.ImageDatas, func(ctx context.Context, i int) error {
+		img := req.ImageDatas[i]
+		pageCount, page, err := imagePages(img)
+		if err != nil {
+			return uc.logFailure(ctx, OperationPages, StageDecode, i, img.Filename, err)
+		}
+
+		base := strings.TrimSuffix(img.Filename, path.Ext(img.Filename))
+		outputBytes := 0
+		for p := 0; p < pageCount; p++ {
+			if err := checkpoint(ctx); err != nil {
+				return err
+			}
+
+			encoded, err := uc.splitPage(ctx, backend, page(p), mode, contentType, i, img.Filename)
+			if err != nil {
+				return err
+			}
+
+			pages = append(pages, dto.ImageData{
+				Filename:    fmt.Sprintf("%s-%03d.%s", base, p+1, ext),
+				ContentType: contentType,
+				ImageBytes:  encoded,
+			})
+			outputBytes += len(encoded)
+		}
+
+		uc.logProcessed(ctx, OperationPages, i, img.Filename, len(img.ImageBytes), outputBytes)
+		return nil
+	})
+
+	return pages, err
+}
+
+// splitPage encodes the page data of the image at index to contentType.
+func (uc ImageUsecase) splitPage(
+	ctx context.Context, backend Backend, data []byte, mode DecodeMode, contentType string, index int, filename string,
+) ([]byte, error) {
+	// Only the first page was checked when the image was read.
+	if err := checkDimensions(data, filename); err != nil {
+		return nil, apperror.WithFile(err, "files[]", batchIndex(ctx, index), filename)
+	}
+
+	start := time.Now()
+	decoded, err := backend.Decode(data, mode)
+	if err != nil {
+		return nil, uc.logFailure(ctx, OperationPages, StageDecode, index, filename, err)
+	}
+	defer decoded.Close()
+	uc.observe(OperationPages, StageDecode, start)
+
+	if err := checkpoint(ctx); err != nil {
+		return nil, err
+	}
+
+	start = time.Now()
+	encoded, err := backend.Encode(decoded, EncodeOptions{ContentType: contentType})
+	if err != nil {
+		return nil, uc.logFailure(ctx, OperationPages, StageEncode, index, filename, err)
+	}
+	uc.observe(OperationPages, StageEncode, start)
+
+	return encoded, nil
 }
@@ -2,6 +2,8 @@ package usecase
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"log"
 	"mime/multipart"
@@ -9,14 +11,16 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/apperror"
 	"github.com/rizqo46/image-processing-go/constants"
 	"github.com/rizqo46/image-processing-go/dto"
 )
 
 func TestImageUsecase_ValidateAndProcessFilesRequest(t *testing.T) {
-	createMultipartFileheaders := func(filePaths ...string) []*multipart.FileHeader {
+	createMultipartFileheaders := func(filePaths ...string) []dto.File {
 		var buff bytes.Buffer
 		buffWriter := io.Writer(&buff)
 		formWriter := multipart.NewWriter(buffWriter)
@@ -49,12 +53,15 @@ func TestImageUsecase_ValidateAndProcessFilesRequest(t *testing.T) {
 			log.Fatal(err)
 		}
 
-		files := multipartForm.File["file"]
+		files := []dto.File{}
+		for _, fileHeader := range multipartForm.File["file"] {
+			files = append(files, dto.FileHeader{Header: fileHeader})
+		}
 		return files
 	}
 
 	type args struct {
-		files               []*multipart.FileHeader
+		files               []dto.File
 		allowedContentTypes []string
 	}
 	tests := []struct {
@@ -89,7 +96,7 @@ func TestImageUsecase_ValidateAndProcessFilesRequest(t *testing.T) {
 		{
 			name: "failed error on open file",
 			args: args{
-				files:               []*multipart.FileHeader{{}},
+				files:               []dto.File{dto.FileHeader{Header: &multipart.FileHeader{}}},
 				allowedContentTypes: []string{constants.ContentTypeImagePng},
 			},
 			want:    []dto.ImageData{},
@@ -99,7 +106,7 @@ func TestImageUsecase_ValidateAndProcessFilesRequest(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uc := ImageUsecase{}
-			got, err := uc.ValidateAndProcessFilesRequest(tt.args.files, tt.args.allowedContentTypes...)
+			got, err := uc.ValidateAndProcessFilesRequest(context.Background(), tt.args.files, tt.args.allowedContentTypes...)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ImageUsecase.ValidateAndProcessFilesRequest() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -141,7 +148,7 @@ func generateImageDatas(t *testing.T, filePaths ...string) []dto.ImageData {
 
 func TestImageUsecase_ConvertPngToJpeg(t *testing.T) {
 	type args struct {
-		req []dto.ImageData
+		req dto.ImageDataEncode
 	}
 	tests := []struct {
 		name    string
@@ -151,14 +158,14 @@ func TestImageUsecase_ConvertPngToJpeg(t *testing.T) {
 		{
 			name: "success convert image from png to jpeg",
 			args: args{
-				req: generateImageDatas(t, ".././imagetest/flower.png"),
+				req: dto.ImageDataEncode{ImageDatas: generateImageDatas(t, ".././imagetest/flower.png")},
 			},
 			wantErr: false,
 		},
 		{
 			name: "failed on decode image",
 			args: args{
-				req: []dto.ImageData{{}},
+				req: dto.ImageDataEncode{ImageDatas: []dto.ImageData{{}}},
 			},
 			wantErr: true,
 		},
@@ -166,7 +173,7 @@ func TestImageUsecase_ConvertPngToJpeg(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uc := ImageUsecase{}
-			if err := uc.ConvertPngToJpeg(tt.args.req); (err != nil) != tt.wantErr {
+			if err := uc.ConvertPngToJpeg(context.Background(), tt.args.req); (err != nil) != tt.wantErr {
 				t.Errorf("ImageUsecase.ConvertPngToJpeg() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -175,7 +182,7 @@ func TestImageUsecase_ConvertPngToJpeg(t *testing.T) {
 
 func TestImageUsecase_CompressImages(t *testing.T) {
 	type args struct {
-		req []dto.ImageData
+		req dto.ImageDataEncode
 	}
 	tests := []struct {
 		name    string
@@ -185,14 +192,14 @@ func TestImageUsecase_CompressImages(t *testing.T) {
 		{
 			name: "success compress image",
 			args: args{
-				req: generateImageDatas(t, ".././imagetest/flower.png"),
+				req: dto.ImageDataEncode{ImageDatas: generateImageDatas(t, ".././imagetest/flower.png")},
 			},
 			wantErr: false,
 		},
 		{
 			name: "failed on decode image",
 			args: args{
-				req: []dto.ImageData{{}},
+				req: dto.ImageDataEncode{ImageDatas: []dto.ImageData{{}}},
 			},
 			wantErr: true,
 		},
@@ -200,7 +207,7 @@ func TestImageUsecase_CompressImages(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uc := ImageUsecase{}
-			if err := uc.CompressImages(tt.args.req); (err != nil) != tt.wantErr {
+			if err := uc.CompressImages(context.Background(), tt.args.req); (err != nil) != tt.wantErr {
 				t.Errorf("ImageUsecase.CompressImages() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -244,7 +251,7 @@ func TestImageUsecase_ResizeImages(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uc := ImageUsecase{}
-			if err := uc.ResizeImages(tt.args.req); (err != nil) != tt.wantErr {
+			if err := uc.ResizeImages(context.Background(), tt.args.req); (err != nil) != tt.wantErr {
 				t.Errorf("ImageUsecase.ResizeImages() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -288,9 +295,99 @@ func TestImageUsecase_ProcessImages(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uc := ImageUsecase{}
-			if err := uc.ProcessImages(tt.args.req); (err != nil) != tt.wantErr {
+			if err := uc.ProcessImages(context.Background(), tt.args.req); (err != nil) != tt.wantErr {
 				t.Errorf("ImageUsecase.ResizeImages() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+// cancelOnStage cancels a context the first time stage is observed.
+type cancelOnStage struct {
+	stage  string
+	cancel context.CancelFunc
+}
+
+func (o cancelOnStage) ObserveStage(operation, stage string, duration time.Duration) {
+	if stage == o.stage {
+		o.cancel()
+	}
+}
+
+func TestImageUsecase_Cancellation(t *testing.T) {
+	tests := []struct {
+		name          string
+		cancelOn      string
+		imageTimeout  time.Duration
+		wantErr       error
+		wantProcessed int
+		wantFilename  string
+	}{
+		{
+			name:          "cancelled between decode and encode",
+			cancelOn:      StageDecode,
+			wantErr:       context.Canceled,
+			wantProcessed: 0,
+			wantFilename:  ".././imagetest/flower.png",
+		},
+		{
+			name:          "cancelled between images",
+			cancelOn:      StageEncode,
+			wantErr:       context.Canceled,
+			wantProcessed: 1,
+			wantFilename:  ".././imagetest/cat.jpg",
+		},
+		{
+			name:          "image timeout",
+			imageTimeout:  time.Nanosecond,
+			wantErr:       ErrImageTimeout,
+			wantProcessed: 0,
+			wantFilename:  ".././imagetest/flower.png",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			uc := NewImageUsecase().
+				WithObserver(cancelOnStage{stage: tt.cancelOn, cancel: cancel}).
+				WithImageTimeout(tt.imageTimeout)
+			err := uc.CompressImages(ctx, dto.ImageDataEncode{
+				ImageDatas: generateImageDatas(t, ".././imagetest/flower.png", ".././imagetest/cat.jpg"),
+			})
+
+			var progressErr *ProgressError
+			if !errors.As(err, &progressErr) {
+				t.Fatalf("ImageUsecase.CompressImages() error = %v, want a *ProgressError", err)
+			}
+			assert.Equal(t, true, errors.Is(err, tt.wantErr))
+			assert.Equal(t, tt.wantProcessed, progressErr.Processed)
+			assert.Equal(t, 2, progressErr.Total)
+			assert.Equal(t, tt.wantFilename, progressErr.Filename)
+		})
+	}
+}
+
+func TestImageUsecase_WithBatchOffset(t *testing.T) {
+	ctx := WithBatchOffset(context.Background(), 3, 5)
+
+	err := NewImageUsecase().CompressImages(ctx, dto.ImageDataEncode{
+		ImageDatas: []dto.ImageData{{Filename: "broken.png", ImageBytes: []byte("\x89PNG broken")}},
+	})
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.FileIndex == nil {
+		t.Fatalf("ImageUsecase.CompressImages() error = %v, want a file error", err)
+	}
+	assert.Equal(t, 3, *appErr.FileIndex)
+
+	err = NewImageUsecase().WithImageTimeout(time.Nanosecond).CompressImages(ctx, dto.ImageDataEncode{
+		ImageDatas: generateImageDatas(t, ".././imagetest/cat.jpg"),
+	})
+	var progressErr *ProgressError
+	if !errors.As(err, &progressErr) {
+		t.Fatalf("ImageUsecase.CompressImages() error = %v, want a *ProgressError", err)
+	}
+	assert.Equal(t, 3, progressErr.Processed)
+	assert.Equal(t, 5, progressErr.Total)
+}
@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"image"
+	"math"
+)
+
+// qualityScore compares an image to a reference of the same size.
+type qualityScore struct {
+	// psnr is the peak signal-to-noise ratio of the luma, in dB, capped at
+	// maxPSNR for identical images.
+	psnr float64
+	ssim float64
+}
+
+// maxPSNR is the PSNR of identical images, infinite otherwise.
+const maxPSNR = 100
+
+// score compares img to reference.
+func score(reference, img lumaPlane) qualityScore {
+	return qualityScore{psnr: psnr(reference, img), ssim: ssim(reference, img)}
+}
+
+// psnr returns the peak signal-to-noise ratio of b to a, of the same size.
+func psnr(a, b lumaPlane) float64 {
+	var squaredError float64
+	for i := range a.pix {
+		diff := a.pix[i] - b.pix[i]
+		squaredError += diff * diff
+	}
+	if squaredError == 0 || len(a.pix) == 0 {
+		return maxPSNR
+	}
+
+	return min(10*math.Log10(255*255/(squaredError/float64(len(a.pix)))), maxPSNR)
+}
+
+// ssimWindow is the side of the windows SSIM is computed over, the windows
+// overlapping by half.
+const ssimWindow = 8
+
+// The stabilizing constants of SSIM, for 8-bit samples.
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// lumaPlane is the luma of an image, drawn over white, in 8-bit units.
+type lumaPlane struct {
+	width, height int
+	pix           []float64
+}
+
+func newLumaPlane(img image.Image) lumaPlane {
+	bounds := img.Bounds()
+	plane := lumaPlane{width: bounds.Dx(), height: bounds.Dy(), pix: make([]float64, bounds.Dx()*bounds.Dy())}
+	for y := 0; y < plane.height; y++ {
+		for x := 0; x < plane.width; x++ {
+			// Premultiplied colors are drawn over white by adding the
+			// missing alpha.
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			r, g, b = r+0xffff-a, g+0xffff-a, b+0xffff-a
+			plane.pix[y*plane.width+x] = float64(299*r+587*g+114*b) / (1000 * 0x101)
+		}
+	}
+
+	return plane
+}
+
+// ssim returns the mean structural similarity of the luma of a and b, of
+// the same size, from 1 for identical images down to -1. Images smaller
+// than a window are compared as a single window.
+func ssim(a, b lumaPlane) float64 {
+	windowWidth, windowHeight := min(ssimWindow, a.width), min(ssimWindow, a.height)
+	stepX, stepY := max(windowWidth/2, 1), max(windowHeight/2, 1)
+
+	var sum float64
+	var windows int
+	for y := 0; y+windowHeight <= a.height; y += stepY {
+		for x := 0; x+windowWidth <= a.width; x += stepX {
+			sum += windowSSIM(a, b, x, y, windowWidth, windowHeight)
+			windows++
+		}
+	}
+	if windows == 0 {
+		return 1
+	}
+
+	return sum / float64(windows)
+}
+
+func windowSSIM(a, b lumaPlane, x0, y0, width, height int) float64 {
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+	for y := y0; y < y0+height; y++ {
+		for x := x0; x < x0+width; x++ {
+			pa, pb := a.pix[y*a.width+x], b.pix[y*b.width+x]
+			sumA += pa
+			sumB += pb
+			sumAA += pa * pa
+			sumBB += pb * pb
+			sumAB += pa * pb
+		}
+	}
+
+	n := float64(width * height)
+	meanA, meanB := sumA/n, sumB/n
+	varA, varB := sumAA/n-meanA*meanA, sumBB/n-meanB*meanB
+	covariance := sumAB/n - meanA*meanB
+
+	return ((2*meanA*meanB + ssimC1) * (2*covariance + ssimC2)) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"github.com/rizqo46/image-processing-go/constants"
+)
+
+// selfCheckCodecs are the codecs the operations rely on.
+var selfCheckCodecs = []struct {
+	name        string
+	contentType string
+}{
+	{"png", constants.ContentTypeImagePng},
+	{"jpeg", constants.ContentTypeImageJpeg},
+	{"tiff", constants.ContentTypeImageTiff},
+	{"bmp", constants.ContentTypeImageBmp},
+}
+
+// SelfCheck encodes and decodes a tiny image with every codec the
+// operations rely on. It returns the codecs that worked, and an error
+// naming the first that didn't.
+func (uc ImageUsecase) SelfCheck() ([]string, error) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(1, 1, color.RGBA{R: 255, A: 255})
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		return nil, err
+	}
+
+	backend := uc.imageBackend()
+	img, err := backend.Decode(encoded.Bytes(), DecodeUnchanged)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	var codecs []string
+	var firstErr error
+	for _, codec := range selfCheckCodecs {
+		err := roundTrip(backend, img, codec.contentType)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s codec: %w", codec.name, err)
+			}
+			continue
+		}
+
+		codecs = append(codecs, codec.name)
+	}
+
+	return codecs, firstErr
+}
+
+func roundTrip(backend Backend, img Image, contentType string) error {
+	encoded, err := backend.Encode(img, EncodeOptions{ContentType: contentType})
+	if err != nil {
+		return err
+	}
+
+	decoded, err := backend.Decode(encoded, DecodeUnchanged)
+	if err != nil {
+		return err
+	}
+	defer decoded.Close()
+
+	width, height := img.Size()
+	decodedWidth, decodedHeight := decoded.Size()
+	if decodedWidth != width || decodedHeight != height {
+		return fmt.Errorf("decoded a %dx%d image, want %dx%d", decodedWidth, decodedHeight, width, height)
+	}
+
+	return nil
+}
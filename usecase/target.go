@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"github.com/rizqo46/image-processing-go/constants"
+)
+
+// maxQualitySteps caps the encodings searchQuality tries, enough to bisect
+// the qualities from 1 to 100.
+const maxQualitySteps = 7
+
+// targetFormats are the formats whose quality is searched for an SSIM
+// target. AVIF is too slow to encode that many times.
+var targetFormats = []string{constants.ContentTypeImageJpeg, constants.ContentTypeImageWebp}
+
+// searchQuality encodes img with the lowest quality keeping minSSIM to
+// reference, bisecting the qualities from 1 to 100 in at most
+// maxQualitySteps encodings. The SSIM is assumed to grow with the quality.
+// When no quality keeps minSSIM, the highest one tried is returned.
+func searchQuality(backend Backend, img Image, opts EncodeOptions, reference lumaPlane, minSSIM float64) (encoding, error) {
+	var best, highest encoding
+	low, high := 1, 100
+	for step := 0; step < maxQualitySteps && low <= high; step++ {
+		quality := (low + high) / 2
+		candidate := withQuality(opts, quality)
+		data, err := backend.Encode(img, candidate)
+		if err != nil {
+			return encoding{}, err
+		}
+
+		score, err := scoreEncoded(backend, data, reference)
+		if err != nil {
+			return encoding{}, err
+		}
+
+		out := encoding{data: data, opts: candidate, quality: quality, score: &score}
+		if score.ssim >= minSSIM {
+			best, high = out, quality-1
+		} else {
+			highest, low = out, quality+1
+		}
+	}
+
+	if best.data == nil {
+		return highest, nil
+	}
+
+	return best, nil
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// encodeCounter counts the encodings of the backend it wraps.
+type encodeCounter struct {
+	Backend
+	encodes int
+}
+
+func (b *encodeCounter) Encode(img Image, opts EncodeOptions) ([]byte, error) {
+	b.encodes++
+	return b.Backend.Encode(img, opts)
+}
+
+func TestImageUsecase_ssimTarget(t *testing.T) {
+	var tests = []struct {
+		name    string
+		minSSIM float64
+		reached bool
+	}{
+		{
+			name:    "low target",
+			minSSIM: 0.9,
+			reached: true,
+		},
+		{
+			name:    "high target",
+			minSSIM: 0.99,
+			reached: true,
+		},
+		{
+			name:    "unreachable target",
+			minSSIM: 1,
+		},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		sizes := map[float64]int{}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				counter := &encodeCounter{Backend: backend}
+				req := dto.ImageDataEncode{
+					EncodeRequest: dto.EncodeRequest{Format: dto.EncodeFormatJpeg, SSIM: tt.minSSIM},
+					ImageDatas:    generateImageDatas(t, "../imagetest/cat.jpg"),
+				}
+				if err := NewImageUsecase().WithBackend(counter).CompressImages(context.Background(), req); err != nil {
+					t.Fatal(err)
+				}
+
+				quality := req.ImageDatas[0].Quality
+				assert.NotEqual(t, nil, quality)
+				assert.Equal(t, true, counter.encodes <= maxQualitySteps)
+				assert.Equal(t, tt.reached, quality.SSIM >= tt.minSSIM)
+				if tt.reached {
+					assert.Equal(t, true, quality.Quality >= 1 && quality.Quality < 100)
+				} else {
+					assert.Equal(t, 100, quality.Quality)
+				}
+				sizes[tt.minSSIM] = len(req.ImageDatas[0].ImageBytes)
+			})
+		}
+
+		assert.Equal(t, true, sizes[0.9] < sizes[0.99])
+	})
+}
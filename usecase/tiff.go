@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// The pages of a TIFF are image file directories (IFDs) chained from its
+// header. Decoders only read the first one, the one the header points to,
+// so a page is decoded from a copy of the TIFF whose header points to the
+// page. gocv has no binding of cv::imreadmulti to do it with OpenCV.
+
+// maxTIFFPages bounds the pages split from a TIFF.
+const maxTIFFPages = 1000
+
+const tiffHeaderLen = 8
+
+func isTIFF(data []byte) bool {
+	return tiffByteOrder(data) != nil
+}
+
+// tiffByteOrder returns the byte order of a TIFF header, nil when data is
+// not a TIFF.
+func tiffByteOrder(data []byte) binary.ByteOrder {
+	if len(data) < 4 {
+		return nil
+	}
+
+	switch string(data[:4]) {
+	case "II*\x00":
+		return binary.LittleEndian
+	case "MM\x00*":
+		return binary.BigEndian
+	}
+
+	return nil
+}
+
+// tiffPageOffsets returns the offsets of the IFDs of data, one per page.
+func tiffPageOffsets(data []byte) ([]uint32, error) {
+	order := tiffByteOrder(data)
+	if order == nil || len(data) < tiffHeaderLen {
+		return nil, fmt.Errorf("%w: not a tiff", ErrDecodeImage)
+	}
+
+	var offsets []uint32
+	for offset := order.Uint32(data[4:tiffHeaderLen]); offset != 0; {
+		if slices.Contains(offsets, offset) {
+			return nil, fmt.Errorf("%w: tiff pages loop at offset %d", ErrDecodeImage, offset)
+		}
+		if len(offsets) == maxTIFFPages {
+			return nil, fmt.Errorf("%w: tiff has more than %d pages", ErrDecodeImage, maxTIFFPages)
+		}
+		if int(offset) < tiffHeaderLen || int64(offset)+2 > int64(len(data)) {
+			return nil, fmt.Errorf("%w: tiff page offset %d out of the file", ErrDecodeImage, offset)
+		}
+		offsets = append(offsets, offset)
+
+		// An IFD is its number of entries, the 12 byte entries, and the
+		// offset of the next IFD.
+		next := int64(offset) + 2 + 12*int64(order.Uint16(data[offset:]))
+		if next+4 > int64(len(data)) {
+			return nil, fmt.Errorf("%w: tiff page at offset %d is truncated", ErrDecodeImage, offset)
+		}
+		offset = order.Uint32(data[next:])
+	}
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("%w: tiff has no page", ErrDecodeImage)
+	}
+
+	return offsets, nil
+}
+
+// tiffPage returns data with its header pointing to the IFD at offset.
+func tiffPage(data []byte, offset uint32) []byte {
+	order := tiffByteOrder(data)
+	if order.Uint32(data[4:tiffHeaderLen]) == offset {
+		return data
+	}
+
+	page := slices.Clone(data)
+	order.PutUint32(page[4:tiffHeaderLen], offset)
+	return page
+}
+
+// imagePages returns the number of pages of img and a function returning
+// each page as an image of its own, copying the TIFF only once asked for a
+// page. Only TIFFs have several pages.
+func imagePages(img dto.ImageData) (int, func(page int) []byte, error) {
+	if img.ContentType != constants.ContentTypeImageTiff {
+		return 1, func(int) []byte { return img.ImageBytes }, nil
+	}
+
+	offsets, err := tiffPageOffsets(img.ImageBytes)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return len(offsets), func(page int) []byte { return tiffPage(img.ImageBytes, offsets[page]) }, nil
+}
@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+)
+
+// scan.tiff has 3 uncompressed pages: 20x10 red, 16x16 green and 8x12 blue.
+func readScan(t *testing.T) dto.ImageData {
+	data, err := os.ReadFile("../imagetest/scan.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dto.ImageData{Filename: "scan.tiff", ContentType: constants.ContentTypeImageTiff, ImageBytes: data}
+}
+
+func TestDetectContentType(t *testing.T) {
+	var tests = []struct {
+		path string
+		want string
+	}{
+		{path: "../imagetest/scan.tiff", want: constants.ContentTypeImageTiff},
+		{path: "../imagetest/legacy.bmp", want: constants.ContentTypeImageBmp},
+		{path: "../imagetest/photo.avif", want: constants.ContentTypeImageAvif},
+		{path: "../imagetest/flower.png", want: constants.ContentTypeImagePng},
+		{path: "../imagetest/text.txt", want: "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.want, DetectContentType(data))
+		})
+	}
+}
+
+func Test_tiffPageOffsets(t *testing.T) {
+	scan := readScan(t).ImageBytes
+	offsets, err := tiffPageOffsets(scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(offsets))
+
+	// The IFD of the last page points back to the first one.
+	looping := slices.Clone(scan)
+	last := offsets[2] + 2 + 12*uint32(binary.LittleEndian.Uint16(scan[offsets[2]:]))
+	binary.LittleEndian.PutUint32(looping[last:], offsets[0])
+
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{name: "not a tiff", data: []byte("II*")},
+		{name: "truncated", data: scan[:offsets[0]+4]},
+		{name: "page out of the file", data: append([]byte("II*\x00"), 0xff, 0xff, 0, 0)},
+		{name: "no page", data: []byte("II*\x00\x00\x00\x00\x00")},
+		{name: "looping pages", data: looping},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tiffPageOffsets(tt.data)
+			assert.Equal(t, true, errors.Is(err, ErrDecodeImage))
+		})
+	}
+}
+
+func TestImageUsecase_SplitPages(t *testing.T) {
+	flower, err := os.ReadFile("../imagetest/flower.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name          string
+		image         dto.ImageData
+		format        string
+		wantFilenames []string
+		wantSizes     []image.Point
+	}{
+		{
+			name:          "multi-page tiff",
+			image:         readScan(t),
+			wantFilenames: []string{"scan-001.png", "scan-002.png", "scan-003.png"},
+			wantSizes:     []image.Point{{20, 10}, {16, 16}, {8, 12}},
+		},
+		{
+			name:          "multi-page tiff to jpeg",
+			image:         readScan(t),
+			format:        dto.FrameFormatJpeg,
+			wantFilenames: []string{"scan-001.jpeg", "scan-002.jpeg", "scan-003.jpeg"},
+			wantSizes:     []image.Point{{20, 10}, {16, 16}, {8, 12}},
+		},
+		{
+			name:          "single page image",
+			image:         dto.ImageData{Filename: "flower.png", ContentType: constants.ContentTypeImagePng, ImageBytes: flower},
+			wantFilenames: []string{"flower-001.png"},
+		},
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				pages, err := NewImageUsecase().WithBackend(backend).SplitPages(context.Background(), dto.ImageDataPages{
+					PagesRequest: dto.PagesRequest{Format: tt.format},
+					ImageDatas:   []dto.ImageData{tt.image},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var filenames []string
+				var sizes []image.Point
+				for _, page := range pages {
+					filenames = append(filenames, page.Filename)
+					assert.Equal(t, page.ContentType, DetectContentType(page.ImageBytes))
+
+					pageConfig, _, err := image.DecodeConfig(bytes.NewReader(page.ImageBytes))
+					if err != nil {
+						t.Fatal(err)
+					}
+					sizes = append(sizes, image.Pt(pageConfig.Width, pageConfig.Height))
+				}
+
+				assert.Equal(t, tt.wantFilenames, filenames)
+				if tt.wantSizes != nil {
+					assert.Equal(t, tt.wantSizes, sizes)
+				}
+			})
+		}
+	})
+}
+
+func TestImageUsecase_ConvertPngToJpeg_tiffAndBmp(t *testing.T) {
+	bmp, err := os.ReadFile("../imagetest/legacy.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		images := []dto.ImageData{
+			readScan(t),
+			{Filename: "legacy.bmp", ContentType: constants.ContentTypeImageBmp, ImageBytes: bmp},
+		}
+		if err := NewImageUsecase().WithBackend(backend).ConvertPngToJpeg(context.Background(), dto.ImageDataEncode{ImageDatas: images}); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, wantFilename := range []string{"scan.jpeg", "legacy.jpeg"} {
+			assert.Equal(t, wantFilename, images[i].Filename)
+			assert.Equal(t, constants.ContentTypeImageJpeg, DetectContentType(images[i].ImageBytes))
+		}
+	})
+}
@@ -0,0 +1,207 @@
+// Package usecasetest provides a fake usecase.Service, so that its callers
+// can be tested without running OpenCV.
+package usecasetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rizqo46/image-processing-go/apperror"
+	"github.com/rizqo46/image-processing-go/constants"
+	"github.com/rizqo46/image-processing-go/dto"
+	"github.com/rizqo46/image-processing-go/usecase"
+)
+
+// Fake validates images by their content type like usecase.ImageUsecase,
+// but never decodes them: converted images are renamed and typed as jpeg,
+// the bytes of every image are kept as is. It records the operations called
+// and is safe for concurrent use once its fields are set.
+type Fake struct {
+	// Err, when set, is returned by every operation.
+	Err error
+	// SelfCheckErr, when set, is returned by SelfCheck.
+	SelfCheckErr error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// Calls returns the operations called so far, in order, each being one of
+// the usecase.Operation constants.
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return slices.Clone(f.calls)
+}
+
+func (f *Fake) ValidateAndProcessFilesRequest(ctx context.Context, files []dto.File, allowedContentTypes ...string) ([]dto.ImageData, error) {
+	images := make([]dto.ImageData, 0, len(files))
+	for i, uploadedFile := range files {
+		file, err := uploadedFile.Open()
+		if err != nil {
+			return nil, apperror.WithFile(usecase.ErrOpenFile, "files[]", i, uploadedFile.Name())
+		}
+		defer file.Close()
+
+		image, err := f.ValidateAndProcessReader(ctx, uploadedFile.Name(), file, allowedContentTypes...)
+		if err != nil {
+			return nil, apperror.WithFile(err, "files[]", i, uploadedFile.Name())
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func (f *Fake) ValidateAndProcessReader(ctx context.Context, filename string, r io.Reader, allowedContentTypes ...string) (dto.ImageData, error) {
+	if ctx.Err() != nil {
+		return dto.ImageData{}, context.Cause(ctx)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return dto.ImageData{}, fmt.Errorf("%w: %w", usecase.ErrReadFile, err)
+	}
+
+	contentType := usecase.DetectContentType(data)
+	if !slices.Contains(allowedContentTypes, contentType) {
+		return dto.ImageData{}, apperror.Wrap(
+			apperror.CodeUnsupportedType, fmt.Errorf("%w, only allow %+v", usecase.ErrContentTypeNotAllowed, allowedContentTypes),
+		)
+	}
+
+	return dto.ImageData{
+		Filename:    filename,
+		ContentType: contentType,
+		ImageBytes:  data,
+	}, nil
+}
+
+// ConvertPngToJpeg renames and types images after the requested format,
+// jpeg by default.
+func (f *Fake) ConvertPngToJpeg(ctx context.Context, req dto.ImageDataEncode) error {
+	if err := f.call(ctx, usecase.OperationPngToJpeg); err != nil {
+		return err
+	}
+
+	contentType := req.ContentType()
+	if contentType == "" {
+		contentType = constants.ContentTypeImageJpeg
+	}
+	for i, img := range req.ImageDatas {
+		switch {
+		case img.ContentType == constants.ContentTypeImagePng && contentType == constants.ContentTypeImageJpeg:
+			req.ImageDatas[i].Filename = strings.TrimSuffix(img.Filename, "png") + "jpeg"
+		case img.ContentType != contentType:
+			req.ImageDatas[i].Filename = strings.TrimSuffix(img.Filename, path.Ext(img.Filename)) + "." + strings.TrimPrefix(contentType, "image/")
+		}
+		req.ImageDatas[i].ContentType = contentType
+	}
+
+	return nil
+}
+
+func (f *Fake) CompressImages(ctx context.Context, req dto.ImageDataEncode) error {
+	return f.call(ctx, usecase.OperationCompress)
+}
+
+func (f *Fake) ResizeImages(ctx context.Context, req dto.ImageDataResize) error {
+	return f.call(ctx, usecase.OperationResize)
+}
+
+func (f *Fake) ProcessImages(ctx context.Context, req dto.ImageDataResize) error {
+	return f.call(ctx, usecase.OperationProcess)
+}
+
+func (f *Fake) CropImages(ctx context.Context, req dto.ImageDataCrop) error {
+	return f.call(ctx, usecase.OperationCrop)
+}
+
+// ExtractFrames returns every image as its single frame, renamed after the
+// requested format.
+func (f *Fake) ExtractFrames(ctx context.Context, req dto.ImageDataFrames) ([]dto.ImageData, error) {
+	if err := f.call(ctx, usecase.OperationFrames); err != nil {
+		return nil, err
+	}
+
+	frames := make([]dto.ImageData, len(req.ImageDatas))
+	for i, img := range req.ImageDatas {
+		frames[i] = dto.ImageData{
+			Filename:    strings.TrimSuffix(img.Filename, path.Ext(img.Filename)) + "." + strings.TrimPrefix(req.ContentType(), "image/"),
+			ContentType: req.ContentType(),
+			ImageBytes:  img.ImageBytes,
+		}
+	}
+
+	return frames, nil
+}
+
+// SplitPages returns every image as its single page, renamed after the
+// requested format.
+func (f *Fake) SplitPages(ctx context.Context, req dto.ImageDataPages) ([]dto.ImageData, error) {
+	if err := f.call(ctx, usecase.OperationPages); err != nil {
+		return nil, err
+	}
+
+	pages := make([]dto.ImageData, len(req.ImageDatas))
+	for i, img := range req.ImageDatas {
+		pages[i] = dto.ImageData{
+			Filename:    strings.TrimSuffix(img.Filename, path.Ext(img.Filename)) + "-001." + strings.TrimPrefix(req.ContentType(), "image/"),
+			ContentType: req.ContentType(),
+			ImageBytes:  img.ImageBytes,
+		}
+	}
+
+	return pages, nil
+}
+
+// Compare scores every pair of images as identical.
+func (f *Fake) Compare(ctx context.Context, reference, img dto.ImageData) (dto.CompareResponse, error) {
+	if err := f.call(ctx, usecase.OperationCompare); err != nil {
+		return dto.CompareResponse{}, err
+	}
+
+	return dto.CompareResponse{Reference: reference.Filename, Image: img.Filename, PSNR: 100, SSIM: 1}, nil
+}
+
+func (f *Fake) BackendName() string {
+	return "fake"
+}
+
+// Capabilities returns the formats of the pure Go backend, without avif.
+func (f *Fake) Capabilities() dto.Capabilities {
+	contentTypes := []string{
+		constants.ContentTypeImagePng, constants.ContentTypeImageJpeg, constants.ContentTypeImageGif,
+		constants.ContentTypeImageTiff, constants.ContentTypeImageBmp,
+	}
+
+	return dto.Capabilities{Decode: contentTypes, Encode: contentTypes}
+}
+
+func (f *Fake) SelfCheck() ([]string, error) {
+	if f.SelfCheckErr != nil {
+		return nil, f.SelfCheckErr
+	}
+
+	return []string{"png", "jpeg"}, nil
+}
+
+// call records operation and returns the error it fails with.
+func (f *Fake) call(ctx context.Context, operation string) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, operation)
+	f.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+
+	return f.Err
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+const DefaultQueueSize = 64
+
+var ErrQueueFull = errors.New("too many requests are waiting to be processed")
+
+// Pool bounds the number of requests processed at once. Requests past the
+// limit wait in a queue of bounded size and are refused once it is full.
+type Pool struct {
+	slots     chan struct{}
+	queueSize int64
+	queued    atomic.Int64
+	draining  atomic.Bool
+}
+
+// New returns the pool configured by cfg. Zero values mean one worker per
+// CPU and DefaultQueueSize.
+func New(cfg config.Config) *Pool {
+	workers := cfg.WorkerCount
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	queueSize := cfg.WorkerQueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	return &Pool{slots: make(chan struct{}, workers), queueSize: int64(queueSize)}
+}
+
+// Acquire waits for a free worker and returns the function releasing it. It
+// fails with ErrQueueFull when the queue is full, or with the cause of ctx
+// being done while waiting.
+func (p *Pool) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaseFunc(), nil
+	default:
+	}
+
+	if p.queued.Add(1) > p.queueSize {
+		p.queued.Add(-1)
+		return nil, ErrQueueFull
+	}
+	defer p.queued.Add(-1)
+
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaseFunc(), nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+func (p *Pool) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-p.slots })
+	}
+}
+
+type Stats struct {
+	Workers   int `json:"workers"`
+	Busy      int `json:"busy"`
+	QueueSize int `json:"queue_size"`
+	Queued    int `json:"queued"`
+}
+
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Workers:   cap(p.slots),
+		Busy:      len(p.slots),
+		QueueSize: int(p.queueSize),
+		Queued:    int(p.queued.Load()),
+	}
+}
+
+// Saturated tells whether new requests would be refused.
+func (p *Pool) Saturated() bool {
+	return p.queued.Load() >= p.queueSize
+}
+
+// Drain marks the pool as shutting down. Requests already accepted keep
+// being processed, it only makes the server report that it is not ready.
+func (p *Pool) Drain() {
+	p.draining.Store(true)
+}
+
+func (p *Pool) Draining() bool {
+	return p.draining.Load()
+}
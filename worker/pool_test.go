@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/rizqo46/image-processing-go/config"
+)
+
+func TestPool_Acquire(t *testing.T) {
+	pool := New(config.Config{WorkerCount: 1, WorkerQueueSize: 1})
+
+	release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Stats{Workers: 1, Busy: 1, QueueSize: 1}, pool.Stats())
+
+	// The second request waits in the queue until the first is released.
+	acquired := make(chan func())
+	go func() {
+		release, err := pool.Acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+
+	for pool.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, true, pool.Saturated())
+
+	_, err = pool.Acquire(context.Background())
+	assert.Equal(t, ErrQueueFull, err)
+
+	release()
+	release()
+	secondRelease := <-acquired
+	assert.Equal(t, Stats{Workers: 1, Busy: 1, QueueSize: 1}, pool.Stats())
+	assert.Equal(t, false, pool.Saturated())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pool.Acquire(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	secondRelease()
+	assert.Equal(t, 0, pool.Stats().Busy)
+}
+
+func TestPool_Drain(t *testing.T) {
+	pool := New(config.Config{})
+	assert.Equal(t, false, pool.Draining())
+
+	pool.Drain()
+	assert.Equal(t, true, pool.Draining())
+
+	// Requests accepted before the listener closes are still processed.
+	release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}